@@ -0,0 +1,351 @@
+// common_config.go
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The settings of one instance of the server.
+// Every setting is read, from lowest to highest priority, from the defaults
+// below, the JSON config file, UFMINGLE_* environment variables and flags
+type config struct {
+	// Address the HTTP server listens on, e.g. ":8080" or "127.0.0.1:8080"
+	ListenAddr string `json:"listen_addr"`
+	// Path of the SQLite database file
+	DBPath string `json:"db_path"`
+	// Directories where avatars and images inserted in posts are stored
+	AvatarDir string `json:"avatar_dir"`
+	ImageDir  string `json:"image_dir"`
+	// Origins of the frontend that may call the API with credentials
+	CORSOrigins []string `json:"cors_origins"`
+	// URL the server is reached at, used to build links to uploaded files
+	PublicBaseURL string `json:"public_base_url"`
+	// Domain of the session cookie, empty for the host of the request
+	CookieDomain string `json:"cookie_domain"`
+	// IPs or CIDR ranges of the reverse proxies whose X-Forwarded-For header
+	// gives the client IP. Without any, the client IP is the address of the
+	// peer, so that clients can't pick their own rate limit keys
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	// How emails are sent: "log", "file" (one file per email in mail_dir)
+	// or "smtp"
+	Mailer   string `json:"mailer"`
+	MailDir  string `json:"mail_dir"`
+	MailFrom string `json:"mail_from"`
+	// host:port of the SMTP server, and the credentials if it needs them
+	SMTPAddr     string `json:"smtp_addr"`
+	SMTPUsername string `json:"smtp_username"`
+	SMTPPassword string `json:"smtp_password"`
+
+	// How long deleted articles, comments and accounts can be restored
+	// before they are removed for good, e.g. "720h"
+	PurgeRetention string `json:"purge_retention"`
+	// How long authors can edit their comments after posting them, e.g.
+	// "15m", or "0" for no limit. Moderators can always edit
+	CommentEditWindow string `json:"comment_edit_window"`
+
+	// Print the pending schema migrations instead of starting the server.
+	// Only set by flag
+	MigrateDryRun bool `json:"-"`
+	// Make this user an admin after migrating and exit, to set up the first
+	// admin. Only set by flag
+	GrantAdmin string `json:"-"`
+	// Index every article and comment again for search and exit. Only set
+	// by flag
+	RebuildSearchIndex bool `json:"-"`
+}
+
+// The settings of the running server, the defaults until main loads the
+// real configuration
+var appConfig = defaultConfig()
+
+func defaultConfig() config {
+	return config{
+		ListenAddr:        ":8080",
+		DBPath:            "./UFMingle.db",
+		AvatarDir:         "./Avatar",
+		ImageDir:          "./Image",
+		CORSOrigins:       []string{"http://localhost:3000"},
+		PublicBaseURL:     "http://localhost:8080",
+		CookieDomain:      "localhost",
+		Mailer:            "log",
+		MailDir:           "./mail",
+		MailFrom:          "UFMingle <no-reply@localhost>",
+		PurgeRetention:    "720h",
+		CommentEditWindow: "15m",
+	}
+}
+
+// The environment variable and flag of each setting
+var configEnv = map[string]string{
+	"listen-addr":         "UFMINGLE_LISTEN_ADDR",
+	"db-path":             "UFMINGLE_DB_PATH",
+	"avatar-dir":          "UFMINGLE_AVATAR_DIR",
+	"image-dir":           "UFMINGLE_IMAGE_DIR",
+	"cors-origins":        "UFMINGLE_CORS_ORIGINS",
+	"public-base-url":     "UFMINGLE_PUBLIC_BASE_URL",
+	"cookie-domain":       "UFMINGLE_COOKIE_DOMAIN",
+	"trusted-proxies":     "UFMINGLE_TRUSTED_PROXIES",
+	"mailer":              "UFMINGLE_MAILER",
+	"mail-dir":            "UFMINGLE_MAIL_DIR",
+	"mail-from":           "UFMINGLE_MAIL_FROM",
+	"smtp-addr":           "UFMINGLE_SMTP_ADDR",
+	"smtp-username":       "UFMINGLE_SMTP_USERNAME",
+	"smtp-password":       "UFMINGLE_SMTP_PASSWORD",
+	"purge-retention":     "UFMINGLE_PURGE_RETENTION",
+	"comment-edit-window": "UFMINGLE_COMMENT_EDIT_WINDOW",
+}
+
+// Pointers to the fields of c, by flag name
+func (c *config) fields() map[string]*string {
+	return map[string]*string{
+		"listen-addr":         &c.ListenAddr,
+		"db-path":             &c.DBPath,
+		"avatar-dir":          &c.AvatarDir,
+		"image-dir":           &c.ImageDir,
+		"public-base-url":     &c.PublicBaseURL,
+		"cookie-domain":       &c.CookieDomain,
+		"mailer":              &c.Mailer,
+		"mail-dir":            &c.MailDir,
+		"mail-from":           &c.MailFrom,
+		"smtp-addr":           &c.SMTPAddr,
+		"smtp-username":       &c.SMTPUsername,
+		"smtp-password":       &c.SMTPPassword,
+		"purge-retention":     &c.PurgeRetention,
+		"comment-edit-window": &c.CommentEditWindow,
+	}
+}
+
+// Set a setting from the text of an environment variable or a flag.
+// Lists are comma-separated
+func (c *config) set(name string, value string) {
+	switch name {
+	case "cors-origins":
+		c.CORSOrigins = splitList(value)
+	case "trusted-proxies":
+		c.TrustedProxies = splitList(value)
+	default:
+		*c.fields()[name] = value
+	}
+}
+
+// Split a comma-separated list, leaving out the empty items
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Build the configuration from the command line arguments (without the
+// program name) and the environment. The config file is given by -config
+// or UFMINGLE_CONFIG
+func loadConfig(args []string, lookupEnv func(string) (string, bool)) (config, error) {
+	fs := flag.NewFlagSet("UFMingle", flag.ContinueOnError)
+	configPath := fs.String("config", "", "path of a JSON config file (env UFMINGLE_CONFIG)")
+	migrateDryRun := fs.Bool("migrate-dry-run", false, "print the SQL of the pending schema migrations and exit")
+	grantAdmin := fs.String("grant-admin", "", "make the given user an admin and exit")
+	rebuildSearchIndex := fs.Bool("rebuild-search-index", false, "index every article and comment again for search and exit")
+	flagValues := map[string]*string{}
+	for name, env := range configEnv {
+		flagValues[name] = fs.String(name, "", fmt.Sprintf("overrides the config file and %s", env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+	if fs.NArg() > 0 {
+		return config{}, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	c := defaultConfig()
+
+	if *configPath == "" {
+		*configPath, _ = lookupEnv("UFMINGLE_CONFIG")
+	}
+	if *configPath != "" {
+		if err := c.readFile(*configPath); err != nil {
+			return config{}, err
+		}
+	}
+
+	for name, env := range configEnv {
+		if value, ok := lookupEnv(env); ok {
+			c.set(name, value)
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if value, ok := flagValues[f.Name]; ok {
+			c.set(f.Name, *value)
+		}
+	})
+	c.MigrateDryRun = *migrateDryRun
+	c.GrantAdmin = *grantAdmin
+	c.RebuildSearchIndex = *rebuildSearchIndex
+
+	c.PublicBaseURL = strings.TrimRight(c.PublicBaseURL, "/")
+	if err := c.validate(); err != nil {
+		return config{}, err
+	}
+	return c, nil
+}
+
+// Override the settings present in a JSON config file
+func (c *config) readFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Check every setting, reporting all the invalid ones at once
+func (c config) validate() error {
+	var problems []string
+
+	if host, port, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		problems = append(problems, fmt.Sprintf("listen_addr %q: %v", c.ListenAddr, err))
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 || strings.ContainsAny(host, "/ ") {
+		problems = append(problems, fmt.Sprintf("listen_addr %q: must be host:port", c.ListenAddr))
+	}
+
+	for name, value := range map[string]string{"db_path": c.DBPath, "avatar_dir": c.AvatarDir, "image_dir": c.ImageDir} {
+		if strings.TrimSpace(value) == "" {
+			problems = append(problems, name+" can't be empty")
+		}
+	}
+
+	for _, origin := range c.CORSOrigins {
+		if err := validateBaseURL(origin, false); err != nil {
+			problems = append(problems, fmt.Sprintf("cors_origins %q: %v", origin, err))
+		}
+	}
+
+	if err := validateBaseURL(c.PublicBaseURL, true); err != nil {
+		problems = append(problems, fmt.Sprintf("public_base_url %q: %v", c.PublicBaseURL, err))
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			problems = append(problems, fmt.Sprintf("trusted_proxies %q: must be an IP or a CIDR range", proxy))
+		}
+	}
+
+	if strings.ContainsAny(c.CookieDomain, ":/ ;,") {
+		problems = append(problems, fmt.Sprintf("cookie_domain %q: must be a bare domain name", c.CookieDomain))
+	}
+
+	if _, err := mail.ParseAddress(c.MailFrom); err != nil {
+		problems = append(problems, fmt.Sprintf("mail_from %q: %v", c.MailFrom, err))
+	}
+	switch c.Mailer {
+	case "log":
+	case "file":
+		if strings.TrimSpace(c.MailDir) == "" {
+			problems = append(problems, "mail_dir can't be empty with the file mailer")
+		}
+	case "smtp":
+		if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("smtp_addr %q: %v", c.SMTPAddr, err))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("mailer %q: must be log, file or smtp", c.Mailer))
+	}
+
+	if d, err := time.ParseDuration(c.PurgeRetention); err != nil || d <= 0 {
+		problems = append(problems, fmt.Sprintf("purge_retention %q: must be a positive duration such as 720h", c.PurgeRetention))
+	}
+
+	if d, err := time.ParseDuration(c.CommentEditWindow); err != nil || d < 0 {
+		problems = append(problems, fmt.Sprintf("comment_edit_window %q: must be a duration such as 15m, or 0 for no limit", c.CommentEditWindow))
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Check that value is an absolute http(s) URL. An origin can't have a path
+func validateBaseURL(value string, allowPath bool) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an absolute http or https URL")
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return errors.New("can't have credentials, a query or a fragment")
+	}
+	if !allowPath && u.Path != "" {
+		return errors.New("an origin can't have a path")
+	}
+	return nil
+}
+
+// Print the effective configuration, one setting per line
+func printConfig(w io.Writer, c config) {
+	fmt.Fprintln(w, "Effective configuration:")
+	fmt.Fprintf(w, "  listen_addr:     %s\n", c.ListenAddr)
+	fmt.Fprintf(w, "  db_path:         %s\n", c.DBPath)
+	fmt.Fprintf(w, "  avatar_dir:      %s\n", c.AvatarDir)
+	fmt.Fprintf(w, "  image_dir:       %s\n", c.ImageDir)
+	fmt.Fprintf(w, "  cors_origins:    %s\n", strings.Join(c.CORSOrigins, ","))
+	fmt.Fprintf(w, "  public_base_url: %s\n", c.PublicBaseURL)
+	fmt.Fprintf(w, "  cookie_domain:   %s\n", c.CookieDomain)
+	fmt.Fprintf(w, "  trusted_proxies: %s\n", strings.Join(c.TrustedProxies, ","))
+	fmt.Fprintf(w, "  mailer:          %s\n", c.Mailer)
+	switch c.Mailer {
+	case "file":
+		fmt.Fprintf(w, "  mail_dir:        %s\n", c.MailDir)
+	case "smtp":
+		password := ""
+		if c.SMTPPassword != "" {
+			password = "(set)"
+		}
+		fmt.Fprintf(w, "  smtp_addr:       %s\n", c.SMTPAddr)
+		fmt.Fprintf(w, "  smtp_username:   %s\n", c.SMTPUsername)
+		fmt.Fprintf(w, "  smtp_password:   %s\n", password)
+	}
+	fmt.Fprintf(w, "  mail_from:       %s\n", c.MailFrom)
+	fmt.Fprintf(w, "  purge_retention: %s\n", c.PurgeRetention)
+	fmt.Fprintf(w, "  comment_edit_window: %s\n", c.CommentEditWindow)
+}
+
+// How long deleted content is kept. The setting was validated on load
+func (c config) purgeRetention() time.Duration {
+	d, _ := time.ParseDuration(c.PurgeRetention)
+	return d
+}
+
+// How long comments can be edited by their authors, 0 for no limit. The
+// setting was validated on load
+func (c config) commentEditWindow() time.Duration {
+	d, _ := time.ParseDuration(c.CommentEditWindow)
+	return d
+}
@@ -0,0 +1,152 @@
+// common_config_test.go
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Helper function to fake the environment
+func getEnv(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+// Test that the defaults are used when nothing is configured
+func TestLoadConfigDefaults(t *testing.T) {
+	c, err := loadConfig(nil, getEnv(nil))
+	if err != nil || !reflect.DeepEqual(c, defaultConfig()) {
+		t.Fail()
+	}
+}
+
+// Test that the config file, the environment and flags override each
+// other in that order
+func TestLoadConfigPriority(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := `{
+		"listen_addr": "127.0.0.1:9000",
+		"db_path": "/var/lib/ufmingle/file.db",
+		"cors_origins": ["https://staging.example.com"],
+		"public_base_url": "https://api.staging.example.com/",
+		"cookie_domain": "staging.example.com",
+		"trusted_proxies": ["10.0.0.0/8"],
+		"mailer": "smtp",
+		"mail_from": "UFMingle <no-reply@example.com>",
+		"smtp_addr": "smtp.example.com:587",
+		"smtp_username": "ufmingle",
+		"comment_edit_window": "1h"
+	}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"UFMINGLE_CONFIG":          path,
+		"UFMINGLE_DB_PATH":         "/var/lib/ufmingle/env.db",
+		"UFMINGLE_CORS_ORIGINS":    "https://a.example.com, https://b.example.com",
+		"UFMINGLE_IMAGE_DIR":       "/srv/images",
+		"UFMINGLE_TRUSTED_PROXIES": "10.0.0.1, 192.168.0.0/16",
+		"UFMINGLE_SMTP_PASSWORD":   "secret",
+		"UFMINGLE_PURGE_RETENTION": "168h",
+	}
+	args := []string{"-db-path", "/tmp/flag.db", "-migrate-dry-run", "-grant-admin", "user1", "-rebuild-search-index"}
+
+	c, err := loadConfig(args, getEnv(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := config{
+		ListenAddr:         "127.0.0.1:9000",
+		DBPath:             "/tmp/flag.db",
+		AvatarDir:          "./Avatar",
+		ImageDir:           "/srv/images",
+		CORSOrigins:        []string{"https://a.example.com", "https://b.example.com"},
+		PublicBaseURL:      "https://api.staging.example.com",
+		CookieDomain:       "staging.example.com",
+		TrustedProxies:     []string{"10.0.0.1", "192.168.0.0/16"},
+		Mailer:             "smtp",
+		MailDir:            "./mail",
+		MailFrom:           "UFMingle <no-reply@example.com>",
+		SMTPAddr:           "smtp.example.com:587",
+		SMTPUsername:       "ufmingle",
+		SMTPPassword:       "secret",
+		PurgeRetention:     "168h",
+		CommentEditWindow:  "1h",
+		MigrateDryRun:      true,
+		GrantAdmin:         "user1",
+		RebuildSearchIndex: true,
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+}
+
+// Test that invalid settings are all reported
+func TestLoadConfigInvalid(t *testing.T) {
+	env := map[string]string{
+		"UFMINGLE_LISTEN_ADDR":         "8080",
+		"UFMINGLE_CORS_ORIGINS":        "localhost:3000",
+		"UFMINGLE_PUBLIC_BASE_URL":     "ftp://example.com",
+		"UFMINGLE_COOKIE_DOMAIN":       "http://example.com",
+		"UFMINGLE_AVATAR_DIR":          "",
+		"UFMINGLE_MAILER":              "pigeon",
+		"UFMINGLE_PURGE_RETENTION":     "forever",
+		"UFMINGLE_COMMENT_EDIT_WINDOW": "-5m",
+		"UFMINGLE_TRUSTED_PROXIES":     "10.0.0.0/33",
+	}
+	_, err := loadConfig(nil, getEnv(env))
+	if err == nil {
+		t.Fatal("an invalid config was accepted")
+	}
+	for _, setting := range []string{"listen_addr", "cors_origins", "public_base_url", "cookie_domain", "avatar_dir", "mailer", "purge_retention", "comment_edit_window", "trusted_proxies"} {
+		if !strings.Contains(err.Error(), setting) {
+			t.Errorf("%s is not reported in %q", setting, err)
+		}
+	}
+
+	// Unknown fields of the config file and unknown flags are errors too
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"listen_adr": ":9000"}`), 0600)
+	if _, err := loadConfig([]string{"-config", path}, getEnv(nil)); err == nil {
+		t.Fail()
+	}
+	if _, err := loadConfig([]string{"-port", "9000"}, getEnv(nil)); err == nil {
+		t.Fail()
+	}
+}
+
+// Test that the example config file is valid
+func TestExampleConfig(t *testing.T) {
+	c, err := loadConfig([]string{"-config", "config.example.json"}, getEnv(nil))
+	if err != nil || !reflect.DeepEqual(c, defaultConfig()) {
+		t.Fail()
+	}
+}
+
+// Test that the effective configuration lists every setting
+func TestPrintConfig(t *testing.T) {
+	var b strings.Builder
+	printConfig(&b, defaultConfig())
+	for _, line := range []string{"listen_addr:     :8080", "cors_origins:    http://localhost:3000", "cookie_domain:   localhost", "mailer:          log"} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("missing %q", line)
+		}
+	}
+
+	// The SMTP password is never printed
+	c := defaultConfig()
+	c.Mailer, c.SMTPAddr, c.SMTPPassword = "smtp", "smtp.example.com:587", "hunter2"
+	b.Reset()
+	printConfig(&b, c)
+	if strings.Contains(b.String(), "hunter2") || !strings.Contains(b.String(), "smtp_password:   (set)") {
+		t.Error(b.String())
+	}
+}
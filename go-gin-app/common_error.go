@@ -0,0 +1,126 @@
+// common_error.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// The body of every error response of the API
+type apiError struct {
+	// Stable, machine readable reason, e.g. "not_found"
+	Code string `json:"code" example:"validation_failed"`
+	// Human readable description
+	Message string `json:"message" example:"Invalid request body"`
+	// The reason each rejected field of the request was rejected
+	Fields map[string]string `json:"fields,omitempty"`
+	// The ID of the request, also sent in the X-Request-ID header
+	RequestID string `json:"request_id" example:"4f9c2a1be07d3c58"`
+}
+
+// The code of an error response, by HTTP status
+var apiErrorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "too_large",
+	http.StatusTooManyRequests:       "too_many_requests",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+// The code of a request rejected because of some of its fields
+const codeValidationFailed = "validation_failed"
+
+func getAPIErrorCode(status int) string {
+	if code, ok := apiErrorCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return "internal_error"
+	}
+	return "bad_request"
+}
+
+// Write an error response and stop the handler chain.
+// The handler must return right after calling it
+func abortWithAPIError(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, apiError{
+		Code:      getAPIErrorCode(status),
+		Message:   message,
+		RequestID: getRequestID(c),
+	})
+}
+
+// Reject a request because of some of its fields, mapping each field to
+// the reason. The handler must return right after calling it
+func abortWithFieldErrors(c *gin.Context, message string, fields map[string]string) {
+	c.AbortWithStatusJSON(http.StatusBadRequest, apiError{
+		Code:      codeValidationFailed,
+		Message:   message,
+		Fields:    fields,
+		RequestID: getRequestID(c),
+	})
+}
+
+// Log an unexpected error and answer with a 500 that doesn't reveal it.
+// The handler must return right after calling it
+func abortWithInternalError(c *gin.Context, err error) {
+	log.Printf("[%s] %s %s: %v", getRequestID(c), c.Request.Method, c.Request.URL.Path, err)
+	c.Error(err)
+	abortWithAPIError(c, http.StatusInternalServerError, "Internal server error")
+}
+
+// Reject a request whose body could not be bound or failed validation.
+// The handler must return right after calling it
+func abortWithInvalidBody(c *gin.Context, err error) {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make(map[string]string, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields[fe.Field()] = describeValidationError(fe)
+		}
+		abortWithFieldErrors(c, "Invalid request body", fields)
+		return
+	}
+	abortWithAPIError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+}
+
+// Describe why a field failed a validator tag
+func describeValidationError(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "max":
+		return "must be at most " + fe.Param() + " long"
+	case "min":
+		return "must be at least " + fe.Param() + " long"
+	case "oneof":
+		return "must be one of " + fe.Param()
+	}
+	return fmt.Sprintf("failed the %s check", fe.Tag())
+}
+
+// A validator that names fields by their JSON name, like the request body
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" || name == "" {
+			return field.Name
+		}
+		return name
+	})
+	return v
+}
@@ -0,0 +1,95 @@
+// common_error_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Helper function to send a JSON body to a handler that binds and
+// validates a passwordChange
+func postPasswordChange(t *testing.T, payload string) (int, apiError) {
+	r := gin.New()
+	r.Use(handleErrors())
+	r.POST("/", func(c *gin.Context) {
+		var change passwordChange
+		if err := c.ShouldBindJSON(&change); err != nil {
+			abortWithInvalidBody(c, err)
+			return
+		}
+		if err := validate.Struct(change); err != nil {
+			abortWithInvalidBody(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	})
+
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var body apiError
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body
+}
+
+// Test that validation errors are reported per field, by JSON name
+func TestAbortWithInvalidBodyFields(t *testing.T) {
+	code, body := postPasswordChange(t, `{"old_password": "pass1"}`)
+	if code != http.StatusBadRequest || body.Code != codeValidationFailed || body.RequestID == "" {
+		t.Errorf("got %d %+v", code, body)
+	}
+	if body.Fields["new_password"] != "is required" || len(body.Fields) != 1 {
+		t.Errorf("got fields %v", body.Fields)
+	}
+}
+
+// Test that a malformed body is a bad request without field errors
+func TestAbortWithInvalidBodyMalformed(t *testing.T) {
+	code, body := postPasswordChange(t, `{"old_password": `)
+	if code != http.StatusBadRequest || body.Code != "bad_request" || body.Fields != nil {
+		t.Errorf("got %d %+v", code, body)
+	}
+}
+
+// Test that the handlers answer with an apiError instead of HTML or a
+// second response
+func TestLoginFailureIsAPIError(t *testing.T) {
+	r := getAppRouter()
+
+	req, _ := http.NewRequest("POST", "/u/login", strings.NewReader(`{"username": "user1", "password": "wrong"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var body apiError
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusBadRequest || body.Message != "Invalid credentials provided" {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Fail()
+	}
+}
+
+// Test that registering a taken username is reported on the username field
+func TestRegisterTakenUsername(t *testing.T) {
+	r := getAppRouter()
+
+	req, _ := http.NewRequest("POST", "/u/register", strings.NewReader(getRegistrationPOSTPayloadUsedUsername()))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var body apiError
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusBadRequest || body.Code != codeValidationFailed || body.Fields["username"] != errUsernameTaken.Error() {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,110 @@
+// common_events.go
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// The types of the events pushed over GET /events
+const (
+	eventArticle  = "article"  // a new article, to every user
+	eventComment  = "comment"  // a new comment, to the authors of the article and of the parent comment
+	eventReaction = "reaction" // the new like and dislike counts of an article, to every user
+	eventMessage  = "message"  // a private message, to its recipient
+)
+
+// How many events wait for a slow connection before it is dropped, and how
+// often an idle stream sends a comment so that proxies keep it open
+const eventBuffer = 32
+
+var eventHeartbeat = 25 * time.Second
+
+// Something to push to the users, To is "" when it is for every user
+type event struct {
+	Type string
+	To   string
+	Data interface{}
+}
+
+// The data of a reaction event
+type reactionCountEvent struct {
+	ArticleId int `json:"articleId"`
+	Likes     int `json:"likes"`
+	Dislikes  int `json:"dislikes"`
+}
+
+// The events of one connection. The channel is closed when the connection
+// falls behind or the server shuts down
+type eventSubscriber struct {
+	username string
+	ch       chan event
+}
+
+// Fans events out to the open connections. Publishing never blocks: a
+// connection whose buffer is full is dropped, and the client reconnects
+// and fetches what it missed
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[*eventSubscriber]struct{}
+	buffer      int
+}
+
+// The hub the models publish to
+var events = newEventHub(eventBuffer)
+
+func newEventHub(buffer int) *eventHub {
+	return &eventHub{subscribers: map[*eventSubscriber]struct{}{}, buffer: buffer}
+}
+
+// Start receiving the events for a user
+func (h *eventHub) subscribe(username string) *eventSubscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := &eventSubscriber{username: username, ch: make(chan event, h.buffer)}
+	h.subscribers[s] = struct{}{}
+	return s
+}
+
+// Stop receiving events, when the connection ends
+func (h *eventHub) unsubscribe(s *eventSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[s]; ok {
+		delete(h.subscribers, s)
+		close(s.ch)
+	}
+}
+
+// Send an event to the connections of its users
+func (h *eventHub) publish(e event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subscribers {
+		if e.To != "" && e.To != s.username {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			delete(h.subscribers, s)
+			close(s.ch)
+		}
+	}
+}
+
+// End every stream, so that the server can shut down without waiting for
+// them
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subscribers {
+		delete(h.subscribers, s)
+		close(s.ch)
+	}
+}
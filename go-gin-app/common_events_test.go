@@ -0,0 +1,43 @@
+// common_events_test.go
+
+package main
+
+import (
+	"testing"
+)
+
+// Test that events reach the connections of their users only, and that a
+// connection that falls behind is dropped without blocking the others
+func TestEventHub(t *testing.T) {
+	h := newEventHub(2)
+	alice := h.subscribe("alice")
+	bob := h.subscribe("bob")
+
+	h.publish(event{Type: eventArticle, Data: 1})
+	h.publish(event{Type: eventComment, To: "alice", Data: 2})
+	if e := <-bob.ch; e.Data != 1 {
+		t.Errorf("bob got %+v", e)
+	}
+	// The event for alice filled her buffer, the next one drops her
+	h.publish(event{Type: eventArticle, Data: 3})
+
+	for _, want := range []interface{}{1, 2} {
+		if e, ok := <-alice.ch; !ok || e.Data != want {
+			t.Errorf("alice got %+v, %v, want %v", e, ok, want)
+		}
+	}
+	if _, ok := <-alice.ch; ok {
+		t.Error("alice was not dropped")
+	}
+	if e := <-bob.ch; e.Data != 3 {
+		t.Errorf("bob got %+v", e)
+	}
+
+	// Unsubscribing after being dropped is harmless
+	h.unsubscribe(alice)
+	h.close()
+	if _, ok := <-bob.ch; ok {
+		t.Error("bob's stream was not closed")
+	}
+	h.unsubscribe(bob)
+}
@@ -0,0 +1,101 @@
+// common_mailer.go
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sends the emails of the application, e.g. verification codes
+type mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+// The mailer of the running server, set by main from the configuration
+var appMailer mailer = logMailer{}
+
+// Build the mailer selected by the configuration
+func newMailer(c config) (mailer, error) {
+	switch c.Mailer {
+	case "log":
+		return logMailer{}, nil
+	case "file":
+		if err := os.MkdirAll(c.MailDir, 0755); err != nil {
+			return nil, err
+		}
+		return fileMailer{Dir: c.MailDir, From: c.MailFrom}, nil
+	case "smtp":
+		return smtpMailer{Addr: c.SMTPAddr, Username: c.SMTPUsername, Password: c.SMTPPassword, From: c.MailFrom}, nil
+	}
+	return nil, fmt.Errorf("unknown mailer %q", c.Mailer)
+}
+
+// Format a plain text email
+func formatEmail(from string, to string, subject string, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// Only print the emails to the log, for local development
+type logMailer struct{}
+
+func (logMailer) Send(to string, subject string, body string) error {
+	log.Printf("Email to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+// Write every email to its own file in a directory, for local testing
+type fileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m fileMailer) Send(to string, subject string, body string) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:`, r) {
+			return '_'
+		}
+		return r
+	}, to))
+	return os.WriteFile(filepath.Join(m.Dir, name), formatEmail(m.From, to, subject, body), 0600)
+}
+
+// Send emails through an SMTP server, authenticating if a username is set
+type smtpMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m smtpMailer) Send(to string, subject string, body string) error {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, from.Address, []string{to}, formatEmail(m.From, to, subject, body))
+}
@@ -0,0 +1,50 @@
+// common_mailer_test.go
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test that the file mailer writes one readable email per message
+func TestFileMailer(t *testing.T) {
+	c := defaultConfig()
+	c.Mailer = "file"
+	c.MailDir = filepath.Join(t.TempDir(), "mail")
+
+	m, err := newMailer(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send("albert@ufl.edu", "Hello", "line 1\nline 2\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(c.MailDir, "*albert@ufl.edu.eml"))
+	if len(files) != 1 {
+		t.Fatalf("got files %v", files)
+	}
+	content, _ := os.ReadFile(files[0])
+	for _, want := range []string{"From: " + c.MailFrom + "\r\n", "To: albert@ufl.edu\r\n", "Subject: Hello\r\n", "\r\n\r\nline 1\r\nline 2\r\n"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("missing %q in %q", want, content)
+		}
+	}
+}
+
+// Test that the verification email has the code and a working link
+func TestSendVerificationEmail(t *testing.T) {
+	if err := sendVerificationEmail("albert", "albert@ufl.edu", "123456"); err != nil {
+		t.Fatal(err)
+	}
+	if testMailer.lastCode(t, "albert@ufl.edu") != "123456" {
+		t.Fail()
+	}
+	body := testMailer.sent["albert@ufl.edu"][0]
+	if !strings.Contains(body, appConfig.PublicBaseURL+"/u/verify?code=123456&username=albert") {
+		t.Errorf("no link in %q", body)
+	}
+}
@@ -0,0 +1,59 @@
+// common_password.go
+
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Stored passwords are "$v1$" followed by a bcrypt hash, which carries its
+// own per-user salt and cost. A value without a known version prefix is a
+// plaintext password left over from before hashing was introduced.
+const (
+	passwordHashV1 = "$v1$"
+	passwordCost   = bcrypt.DefaultCost
+)
+
+var errEmptyPassword = errors.New("The password can't be empty")
+
+// Hash a password into the current versioned format
+func hashPassword(password string) (string, error) {
+	if strings.TrimSpace(password) == "" {
+		return "", errEmptyPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", err
+	}
+	return passwordHashV1 + string(hash), nil
+}
+
+// Check a password against the stored value.
+// needsRehash is true when the password matched but the stored value is
+// plaintext or was hashed with outdated parameters
+func verifyPassword(stored string, password string) (match bool, needsRehash bool, err error) {
+	if !strings.HasPrefix(stored, passwordHashV1) {
+		// Legacy plaintext row
+		match = stored != "" && subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return match, match, nil
+	}
+
+	hash := []byte(strings.TrimPrefix(stored, passwordHashV1))
+	err = bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		return false, false, err
+	}
+	return true, cost < passwordCost, nil
+}
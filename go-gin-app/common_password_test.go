@@ -0,0 +1,55 @@
+// common_password_test.go
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test that a hashed password only matches the original password
+func TestHashPassword(t *testing.T) {
+	hash, err := hashPassword("pass1")
+	if err != nil || !strings.HasPrefix(hash, passwordHashV1) || strings.Contains(hash, "pass1") {
+		t.Fatal(err)
+	}
+
+	match, needsRehash, err := verifyPassword(hash, "pass1")
+	if !match || needsRehash || err != nil {
+		t.Fail()
+	}
+
+	match, _, err = verifyPassword(hash, "pass2")
+	if match || err != nil {
+		t.Fail()
+	}
+
+	// Two hashes of the same password use different salts
+	other, _ := hashPassword("pass1")
+	if other == hash {
+		t.Fail()
+	}
+
+	// Empty passwords are rejected
+	if _, err := hashPassword(" "); err == nil {
+		t.Fail()
+	}
+}
+
+// Test that legacy plaintext values still verify and ask to be rehashed
+func TestVerifyLegacyPassword(t *testing.T) {
+	match, needsRehash, err := verifyPassword("pass1", "pass1")
+	if !match || !needsRehash || err != nil {
+		t.Fail()
+	}
+
+	match, needsRehash, err = verifyPassword("pass1", "pass2")
+	if match || needsRehash || err != nil {
+		t.Fail()
+	}
+
+	match, _, _ = verifyPassword("", "")
+	if match {
+		t.Fail()
+	}
+}
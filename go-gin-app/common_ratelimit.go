@@ -0,0 +1,62 @@
+// common_ratelimit.go
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Allows at most limit events per key in any window of time, e.g. password
+// reset requests per IP. The counts are kept in memory, so they start over
+// when the server restarts
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	events map[string][]time.Time
+	swept  time.Time
+	now    func() time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, events: map[string][]time.Time{}, now: time.Now}
+}
+
+// Record an event for the key, unless the key already reached the limit
+func (l *rateLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	start := now.Add(-l.window)
+	// Forget the idle keys once per window, and the old events of this key
+	// on every call
+	if now.Sub(l.swept) >= l.window {
+		l.swept = now
+		for k := range l.events {
+			l.forget(k, start)
+		}
+	}
+	l.forget(key, start)
+
+	if len(l.events[key]) >= l.limit {
+		return false
+	}
+	l.events[key] = append(l.events[key], now)
+	return true
+}
+
+// Drop the events of a key from before start, and the key if none is left
+func (l *rateLimiter) forget(key string, start time.Time) {
+	times := l.events[key]
+	i := 0
+	for i < len(times) && !times[i].After(start) {
+		i++
+	}
+	if i == len(times) {
+		delete(l.events, key)
+	} else if i > 0 {
+		l.events[key] = times[i:]
+	}
+}
@@ -0,0 +1,40 @@
+// common_ratelimit_test.go
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that a key is limited within the window and allowed again after it
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	l := newRateLimiter(2, time.Hour)
+	l.now = func() time.Time { return now }
+
+	if !l.allow("a") || !l.allow("a") {
+		t.Fatal("an event under the limit was refused")
+	}
+	if l.allow("a") {
+		t.Error("an event over the limit was allowed")
+	}
+	// Other keys have their own count
+	if !l.allow("b") {
+		t.Error("another key was limited")
+	}
+
+	now = now.Add(30 * time.Minute)
+	if l.allow("a") {
+		t.Error("the limit was lifted inside the window")
+	}
+
+	now = now.Add(31 * time.Minute)
+	if !l.allow("a") {
+		t.Error("the limit was kept after the window")
+	}
+	// The idle key was forgotten
+	if _, ok := l.events["b"]; ok {
+		t.Error("the events of an idle key were kept")
+	}
+}
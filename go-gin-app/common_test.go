@@ -6,6 +6,8 @@ import (
 	"net/http/httptest"
 	"os"
 	"reflect"
+	"regexp"
+	"sync"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -19,10 +21,17 @@ func TestMain(m *testing.M) {
 	//Set Gin to Test Mode
 	gin.SetMode(gin.TestMode)
 
-	connDBErr := ConnectDB()
+	connDBErr := ConnectDB(appConfig.DBPath)
 	if connDBErr != nil {
 		log.Println(connDBErr.Error())
 	}
+	if err := migrateDB(DB); err != nil {
+		log.Fatal(err)
+	}
+	if err := setupSearchIndex(DB); err != nil {
+		log.Println(err, "- the search tests are skipped, run them with -tags sqlite_fts5")
+	}
+	appMailer = testMailer
 	// Run the other tests
 	os.Exit(m.Run())
 }
@@ -52,6 +61,62 @@ func testHTTPResponse(t *testing.T, r *gin.Engine, req *http.Request, f func(w *
 	}
 }
 
+// Helper function to log a user in and return the session cookie
+// that should be sent along with a request
+func getSessionCookie(t *testing.T, username string) *http.Cookie {
+	s, err := createSession(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: "token", Value: s.ID}
+}
+
+// A mailer that keeps the sent emails so that tests can read the codes
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent map[string][]string
+}
+
+var testMailer = &recordingMailer{sent: map[string][]string{}}
+
+func (m *recordingMailer) Send(to string, subject string, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent[to] = append(m.sent[to], body)
+	return nil
+}
+
+var verificationCodePattern = regexp.MustCompile(`verification code is (\d{6})`)
+
+// Return the code of the last verification email sent to the address
+func (m *recordingMailer) lastCode(t *testing.T, to string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.sent[to]) == 0 {
+		t.Fatalf("no email sent to %s", to)
+	}
+	match := verificationCodePattern.FindStringSubmatch(m.sent[to][len(m.sent[to])-1])
+	if match == nil {
+		t.Fatalf("no code in the email sent to %s", to)
+	}
+	return match[1]
+}
+
+// Helper function to register a user and verify the account. The user
+// must be deleted by the test
+func registerActiveUser(t *testing.T, u user) {
+	if _, err := registerNewUser(u); err != nil {
+		t.Fatal(err)
+	}
+	code, _, err := startVerification(u.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyUser(u.Username, code); err != nil {
+		t.Fatal(err)
+	}
+}
+
 // This is a helper function that allows us to reuse some code in the above
 // test methods
 func testMiddlewareRequest(t *testing.T, r *gin.Engine, expectedHTTPCode int) {
@@ -0,0 +1,201 @@
+// database.migration.go
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The schema is built by the ordered SQL files in migrations/, named
+// NNNN_description.sql. A migration that has been released must never be
+// edited; change the schema by adding a new file with the next number.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Read the embedded migrations, sorted by version
+func loadMigrations() ([]migration, error) {
+	files, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	seen := map[int]string{}
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), ".sql")
+		number := strings.SplitN(name, "_", 2)[0]
+		version, err := strconv.Atoi(number)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: the file name must start with a positive version number", f.Name())
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, f.Name())
+		}
+		seen[version] = f.Name()
+
+		content, err := migrationFiles.ReadFile(path.Join("migrations", f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{Version: version, Name: name, SQL: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Create the table that records which migrations have been applied
+func createSchemaVersionTable(db *sql.DB) error {
+	sqlSchemaVersionTable := `
+		CREATE TABLE IF NOT EXISTS schema_version(
+			version    INTEGER PRIMARY KEY NOT NULL,
+			name       TEXT NOT NULL,
+			applied_at timestamp default (CURRENT_TIMESTAMP)
+			)  ;`
+
+	_, err := db.Exec(sqlSchemaVersionTable)
+	return err
+}
+
+// Return the migrations that have not been applied yet, in order.
+// This only reads the database, so that it can be used for a dry run
+func pendingMigrations(db *sql.DB) ([]migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'").Scan(&tables); err != nil {
+		return nil, err
+	}
+	var current int
+	if tables > 0 {
+		if err := db.QueryRow("SELECT IFNULL(MAX(version), 0) FROM schema_version").Scan(&current); err != nil {
+			return nil, err
+		}
+	}
+
+	var pending []migration
+	for _, m := range migrations {
+		if m.Version > current {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Apply every pending migration in a single transaction, so that a failing
+// migration leaves the database as it was.
+// Foreign keys are switched off while the migrations run, because rebuilding
+// a table means dropping it while other tables still reference it. A
+// migration that leaves more foreign key violations behind than there were
+// before is rolled back.
+func migrateDB(db *sql.DB) error {
+	if err := createSchemaVersionTable(db); err != nil {
+		return err
+	}
+	pending, err := pendingMigrations(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// PRAGMA foreign_keys only applies to one connection and is ignored
+	// inside a transaction, so hold on to a single connection
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys=OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys=ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	violations, err := countForeignKeyViolations(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range pending {
+		if _, err := tx.Exec(m.SQL); err != nil {
+			return fmt.Errorf("migration %s: %v", m.Name, err)
+		}
+
+		after, err := countForeignKeyViolations(tx)
+		if err != nil {
+			return err
+		}
+		if after > violations {
+			return fmt.Errorf("migration %s: introduced %d foreign key violations", m.Name, after-violations)
+		}
+		violations = after
+
+		if _, err := tx.Exec("INSERT INTO schema_version (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+			return err
+		}
+		fmt.Println("Applied migration", m.Name)
+	}
+
+	return tx.Commit()
+}
+
+// Count the rows reported by PRAGMA foreign_key_check
+func countForeignKeyViolations(tx *sql.Tx) (int, error) {
+	rows, err := tx.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	return count, rows.Err()
+}
+
+// Print the SQL of every pending migration without applying it
+func printPendingMigrations(db *sql.DB, w io.Writer) error {
+	pending, err := pendingMigrations(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		fmt.Fprintln(w, "-- The schema is up to date")
+		return nil
+	}
+
+	for _, m := range pending {
+		fmt.Fprintf(w, "-- Migration %s\n%s\n", m.Name, strings.TrimSpace(m.SQL))
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// database.migration_test.go
+
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Helper function to find an embedded migration by version
+func getMigration(t *testing.T, version int) migration {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if m.Version == version {
+			return m
+		}
+	}
+	t.Fatalf("no migration with version %d", version)
+	return migration{}
+}
+
+// Helper function to open an empty database in a temporary directory
+func openTempDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Test that the embedded migrations are numbered in order without gaps
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 || m.SQL == "" {
+			t.Errorf("unexpected migration %d: %s", i, m.Name)
+		}
+	}
+}
+
+// Test that the test database was brought up to date by TestMain
+// and that migrating again does nothing
+func TestMigrateDBUpToDate(t *testing.T) {
+	pending, err := pendingMigrations(DB)
+	if err != nil || len(pending) != 0 {
+		t.Fail()
+	}
+	if err := migrateDB(DB); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test migrating an empty database, with a dry run first
+func TestMigrateFreshDB(t *testing.T) {
+	db := openTempDB(t)
+	migrations, _ := loadMigrations()
+
+	var b strings.Builder
+	if err := printPendingMigrations(db, &b); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if !strings.Contains(b.String(), "-- Migration "+m.Name) {
+			t.Errorf("the dry run does not print %s", m.Name)
+		}
+	}
+
+	// The dry run did not touch the database
+	var tables int
+	db.QueryRow("SELECT COUNT(*) FROM sqlite_master").Scan(&tables)
+	if tables != 0 {
+		t.Fail()
+	}
+
+	if err := migrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var applied int
+	db.QueryRow("SELECT COUNT(*) FROM schema_version").Scan(&applied)
+	if applied != len(migrations) {
+		t.Fail()
+	}
+
+	// The articles table has an author column that references users
+	if _, err := db.Exec("INSERT INTO gatorlink VALUES ('u@ufl.edu', 'pw'); INSERT INTO users (username, password, gatorId) VALUES ('u', 'pw', 'u@ufl.edu')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO articles (author, title, content) VALUES ('u', 't', 'c')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO articles (author, title, content) VALUES ('nobody', 't', 'c')"); err == nil {
+		t.Error("an article of a missing user was inserted")
+	}
+
+	b.Reset()
+	printPendingMigrations(db, &b)
+	if !strings.Contains(b.String(), "up to date") {
+		t.Fail()
+	}
+}
+
+// Test that the repair migration renames the misspelled column of an
+// existing articles table and keeps its rows and AUTOINCREMENT counter
+func TestRepairArticlesMigration(t *testing.T) {
+	db := openTempDB(t)
+
+	// A database at version 3 whose articles table has the misspelled column
+	setup := `
+		CREATE TABLE schema_version(version INTEGER PRIMARY KEY NOT NULL, name TEXT NOT NULL, applied_at timestamp default (CURRENT_TIMESTAMP));
+		INSERT INTO schema_version (version, name) VALUES (3, '0003_reactions');
+		CREATE TABLE users(username TEXT PRIMARY KEY NOT NULL, gatorId TEXT);
+		INSERT INTO users (username) VALUES ('user1');
+		CREATE TABLE articles(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			austhor TEXT NOT NULL,
+			title TEXT NOT NULL,
+			post_time timestamp default (CURRENT_TIMESTAMP),
+			content TEXT NOT NULL,
+			likes INTEGER default 0,
+			dislikes INTEGER default 0);
+		CREATE TABLE comment(comment_id INTEGER PRIMARY KEY, topic_id INTEGER NOT NULL, foreign key (topic_id) references articles(id));
+		INSERT INTO articles (austhor, title, content, likes) VALUES ('user1', 'first', 'c1', 3), ('user1', 'second', 'c2', 0), ('user1', 'deleted', 'c3', 0);
+		DELETE FROM articles WHERE title = 'deleted';
+		INSERT INTO comment VALUES (1, 1);`
+	if _, err := db.Exec(setup); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var author, title string
+	var likes int
+	if err := db.QueryRow("SELECT author, title, likes FROM articles WHERE id = 1").Scan(&author, &title, &likes); err != nil {
+		t.Fatal(err)
+	}
+	if author != "user1" || title != "first" || likes != 3 {
+		t.Fail()
+	}
+
+	// The comment still references the rebuilt table
+	var comments int
+	db.QueryRow("SELECT COUNT(*) FROM comment JOIN articles ON comment.topic_id = articles.id").Scan(&comments)
+	if comments != 1 {
+		t.Fail()
+	}
+
+	// The ID of the deleted article is not reused
+	res, err := db.Exec("INSERT INTO articles (author, title, content) VALUES ('user1', 'new', 'c')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := res.LastInsertId(); id != 4 {
+		t.Errorf("got id %d, want 4", id)
+	}
+}
+
+// Test that a failing migration is rolled back as a whole
+func TestMigrateDBRollsBack(t *testing.T) {
+	db := openTempDB(t)
+
+	// An articles table with too few columns can't be copied by the repair
+	setup := `
+		CREATE TABLE schema_version(version INTEGER PRIMARY KEY NOT NULL, name TEXT NOT NULL, applied_at timestamp default (CURRENT_TIMESTAMP));
+		INSERT INTO schema_version (version, name) VALUES (1, '0001_baseline');
+		CREATE TABLE users(username TEXT PRIMARY KEY NOT NULL, like_list TEXT, dislike_list TEXT);
+		CREATE TABLE articles(id INTEGER PRIMARY KEY AUTOINCREMENT, austhor TEXT NOT NULL, likes INTEGER, dislikes INTEGER);`
+	if _, err := db.Exec(setup); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateDB(db); err == nil {
+		t.Fatal("the repair migration should fail")
+	}
+
+	var version, sessions int
+	db.QueryRow("SELECT MAX(version) FROM schema_version").Scan(&version)
+	db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'sessions'").Scan(&sessions)
+	if version != 1 || sessions != 0 {
+		t.Fail()
+	}
+}
@@ -0,0 +1,177 @@
+// database.search.go
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// The full-text search index needs SQLite's FTS5 module, which go-sqlite3
+// only compiles in with the sqlite_fts5 build tag:
+//
+//	go run -tags sqlite_fts5 .
+//
+// It is set up at startup instead of by a migration so that a build without
+// the tag still runs, with search disabled.
+var errSearchUnavailable = errors.New("Search is not available on this server")
+
+// Whether the search index was set up and is kept in sync
+var searchEnabled bool
+
+// One row per article and per comment that isn't deleted. The rowid is twice
+// the ID of an article, and twice the ID of a comment plus one, so that the
+// triggers find the row of an article or comment directly
+const searchIndexSchema = `CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(
+	title,
+	body,
+	kind UNINDEXED,
+	author UNINDEXED,
+	article_id UNINDEXED,
+	posted_at UNINDEXED,
+	tokenize = 'porter unicode61'
+)`
+
+// Keep the index in sync with every change of articles and comment,
+// including soft deletes and restores
+var searchIndexTriggers = map[string]string{
+	"search_article_insert": `CREATE TRIGGER IF NOT EXISTS search_article_insert AFTER INSERT ON articles
+		WHEN new.deleted_at IS NULL BEGIN
+		INSERT INTO search_index (rowid, title, body, kind, author, article_id, posted_at)
+		VALUES (new.id * 2, new.title, new.content, 'article', new.author, new.id, new.post_time);
+	END`,
+	"search_article_update": `CREATE TRIGGER IF NOT EXISTS search_article_update AFTER UPDATE OF title, content, author, post_time, deleted_at ON articles BEGIN
+		DELETE FROM search_index WHERE rowid = old.id * 2;
+		INSERT INTO search_index (rowid, title, body, kind, author, article_id, posted_at)
+		SELECT new.id * 2, new.title, new.content, 'article', new.author, new.id, new.post_time WHERE new.deleted_at IS NULL;
+	END`,
+	"search_article_delete": `CREATE TRIGGER IF NOT EXISTS search_article_delete AFTER DELETE ON articles BEGIN
+		DELETE FROM search_index WHERE rowid = old.id * 2;
+	END`,
+	"search_comment_insert": `CREATE TRIGGER IF NOT EXISTS search_comment_insert AFTER INSERT ON comment
+		WHEN new.deleted_at IS NULL BEGIN
+		INSERT INTO search_index (rowid, title, body, kind, author, article_id, posted_at)
+		VALUES (new.comment_id * 2 + 1, '', new.comment_content, 'comment', new.comment_user, new.topic_id, new.comment_time);
+	END`,
+	"search_comment_update": `CREATE TRIGGER IF NOT EXISTS search_comment_update AFTER UPDATE OF comment_content, comment_user, topic_id, comment_time, deleted_at ON comment BEGIN
+		DELETE FROM search_index WHERE rowid = old.comment_id * 2 + 1;
+		INSERT INTO search_index (rowid, title, body, kind, author, article_id, posted_at)
+		SELECT new.comment_id * 2 + 1, '', new.comment_content, 'comment', new.comment_user, new.topic_id, new.comment_time WHERE new.deleted_at IS NULL;
+	END`,
+	"search_comment_delete": `CREATE TRIGGER IF NOT EXISTS search_comment_delete AFTER DELETE ON comment BEGIN
+		DELETE FROM search_index WHERE rowid = old.comment_id * 2 + 1;
+	END`,
+}
+
+// Create the search index and its triggers if FTS5 is available, filling
+// the index when it is new or was not kept in sync. Without FTS5 the
+// triggers are dropped, since every write to articles and comment would
+// fail on them, and search stays disabled
+func setupSearchIndex(db *sql.DB) error {
+	var available bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&available); err != nil {
+		return err
+	}
+
+	var found int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'search_%'").Scan(&found); err != nil {
+		return err
+	}
+
+	if !available {
+		searchEnabled = false
+		if found > 0 {
+			log.Println("search: dropping the triggers of the search index, run -rebuild-search-index once FTS5 is available again")
+			for name := range searchIndexTriggers {
+				if _, err := db.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+					return err
+				}
+			}
+		}
+		return errSearchUnavailable
+	}
+
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'search_index'").Scan(&tables); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(searchIndexSchema); err != nil {
+		return err
+	}
+	for _, trigger := range searchIndexTriggers {
+		if _, err := tx.Exec(trigger); err != nil {
+			return err
+		}
+	}
+	if tables == 0 || found != len(searchIndexTriggers) {
+		if _, err := fillSearchIndex(tx); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	searchEnabled = true
+	return nil
+}
+
+// Index every article and comment again, for a database whose index was
+// damaged or written to without the triggers. Returns the number of rows
+// indexed
+func rebuildSearchIndex(db *sql.DB) (int64, error) {
+	if err := setupSearchIndex(db); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	num, err := fillSearchIndex(tx)
+	if err != nil {
+		return 0, err
+	}
+	return num, tx.Commit()
+}
+
+// Replace the content of the index with the articles and comments that
+// aren't deleted
+func fillSearchIndex(tx *sql.Tx) (int64, error) {
+	if _, err := tx.Exec("DELETE FROM search_index"); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, query := range []string{
+		`INSERT INTO search_index (rowid, title, body, kind, author, article_id, posted_at)
+		SELECT id * 2, title, content, 'article', author, id, post_time FROM articles WHERE deleted_at IS NULL`,
+		`INSERT INTO search_index (rowid, title, body, kind, author, article_id, posted_at)
+		SELECT comment_id * 2 + 1, '', comment_content, 'comment', comment_user, topic_id, comment_time FROM comment WHERE deleted_at IS NULL`,
+	} {
+		result, err := tx.Exec(query)
+		if err != nil {
+			return 0, err
+		}
+		num, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		total += num
+	}
+
+	if _, err := tx.Exec("INSERT INTO search_index (search_index) VALUES ('optimize')"); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
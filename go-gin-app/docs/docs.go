@@ -32,122 +32,123 @@ const docTemplate = `{
                 }
             }
         },
-        "/article/create": {
+        "/admin/articles/:article_id/restore": {
             "post": {
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Create an article",
+                "summary": "Restore a deleted article with the comments deleted along with it, only moderators can",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "The title of the article",
-                        "name": "title",
-                        "in": "header",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "The content of the article",
-                        "name": "content",
-                        "in": "header",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "The author of the article",
-                        "name": "author",
-                        "in": "header",
+                        "type": "integer",
+                        "description": "The id of the article",
+                        "name": "article_id",
+                        "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "If the article has been created successfully, return the number of rows been affected, else 0",
+                        "description": "Success",
                         "schema": {
-                            "type": "int"
+                            "type": "string"
                         }
                     },
-                    "400": {
-                        "description": "There is an error while creating the article",
+                    "404": {
+                        "description": "Invalid article ID or the article is not deleted",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "409": {
+                        "description": "The author of the article is deleted",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     }
                 }
             }
         },
-        "/article/pastposts/:username": {
-            "get": {
+        "/admin/comments/:comment_id/restore": {
+            "post": {
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Get article posted by the user",
+                "summary": "Restore a deleted comment, only moderators can",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "username, i.e. author of the article",
-                        "name": "username",
+                        "type": "integer",
+                        "description": "The id of the comment",
+                        "name": "comment_id",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "success",
+                        "description": "Success",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/main.article"
-                            }
+                            "type": "string"
                         }
                     },
-                    "400": {
-                        "description": "failure",
+                    "404": {
+                        "description": "Invalid comment ID or the comment is not deleted",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "409": {
+                        "description": "The article or the author of the comment is deleted",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     }
                 }
             }
         },
-        "/article/view/:article_id": {
-            "get": {
+        "/admin/users/:username": {
+            "delete": {
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Open the article page",
+                "summary": "Delete the account of another user with its articles and comments. Moderators can delete users, admins can delete anyone else",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "The index of the article",
-                        "name": "article_id",
+                        "type": "string",
+                        "description": "username",
+                        "name": "username",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Return the article",
+                        "description": "Success",
                         "schema": {
-                            "$ref": "#/definitions/main.article"
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "The role of the user is not below yours",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
                         }
                     },
                     "404": {
-                        "description": "Not found or invalid article_id",
+                        "description": "The user does not exist",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     }
                 }
             }
         },
-        "/image/avatar/:username": {
-            "get": {
+        "/admin/users/:username/restore": {
+            "post": {
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Get the avatar of the user",
+                "summary": "Restore a deleted account with the articles and comments deleted along with it, only moderators can",
                 "parameters": [
                     {
                         "type": "string",
@@ -159,24 +160,29 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "An avatar is returned",
+                        "description": "Success",
                         "schema": {
-                            "type": "file"
+                            "type": "string"
                         }
                     },
                     "404": {
-                        "description": "Error",
+                        "description": "The account is not deleted",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     }
                 }
-            },
-            "post": {
+            }
+        },
+        "/admin/users/:username/role": {
+            "patch": {
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Upload the avatar of the user, the name of the file should be \"avatar\".",
+                "summary": "Change the role of a user, only admins can. An admin can't change their own role",
                 "parameters": [
                     {
                         "type": "string",
@@ -184,41 +190,56 @@ const docTemplate = `{
                         "name": "username",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "user, moderator or admin",
+                        "name": "role",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.roleChange"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "An avatar is uploaded",
+                        "description": "Success",
                         "schema": {
-                            "type": "file"
+                            "type": "string"
                         }
                     },
                     "400": {
-                        "description": "Bad request",
+                        "description": "validation_failed",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     },
-                    "500": {
-                        "description": "Internal server error",
+                    "403": {
+                        "description": "Only admins can change roles",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "404": {
+                        "description": "The user does not exist",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     }
                 }
             }
         },
-        "/image/delete/:filename": {
+        "/article/:article_id": {
             "delete": {
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Delete an image file",
+                "summary": "Delete an article with its comments, only the author and moderators can. Moderators can restore it until it is purged",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Filename of the image",
-                        "name": "filename",
+                        "type": "integer",
+                        "description": "The id of the article",
+                        "name": "article_id",
                         "in": "path",
                         "required": true
                     }
@@ -227,347 +248,2549 @@ const docTemplate = `{
                     "200": {
                         "description": "Success",
                         "schema": {
-                            "type": "map"
+                            "type": "string"
                         }
                     },
-                    "400": {
-                        "description": "Failure",
+                    "403": {
+                        "description": "Only the author or a moderator can delete the article",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Invalid article ID or the article does not exist",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     }
                 }
-            }
-        },
-        "/image/download/:filename": {
-            "get": {
+            },
+            "patch": {
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
-                    "image/jpeg"
+                    "application/json"
                 ],
-                "summary": "Retrieve images inserted in the posts or replies",
+                "summary": "Edit the title and/or content of an article, only the author and moderators can. The previous version is kept in the history",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Image filename",
-                        "name": "filename",
+                        "type": "integer",
+                        "description": "The id of the article",
+                        "name": "article_id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "The new title and/or content",
+                        "name": "article",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.articleUpdate"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Success",
+                        "description": "The edited article",
                         "schema": {
-                            "type": "file"
+                            "$ref": "#/definitions/main.article"
                         }
                     },
                     "400": {
-                        "description": "Failure",
+                        "description": "validation_failed, with the reason on the title or content field",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
-                    }
-                }
-            }
-        },
-        "/image/upload": {
-            "post": {
-                "produces": [
-                    "application/json"
-                ],
-                "summary": "Upload images inserted by users in posts or replies",
-                "responses": {
-                    "200": {
-                        "description": "errno: 0, data: A list of download addresses of images",
+                    },
+                    "403": {
+                        "description": "Only the author or a moderator can edit the article",
                         "schema": {
-                            "type": "map"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     },
-                    "400": {
-                        "description": "Error",
+                    "404": {
+                        "description": "Invalid article ID or the article does not exist",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     }
                 }
             }
         },
-        "/u/article/:articleId": {
+        "/article/:article_id/history": {
             "get": {
                 "produces": [
                     "application/json"
                 ],
-                "summary": "See how users react to an article.",
+                "summary": "List the previous versions of an article, the latest first. Only the author and moderators can, since an edit may remove text on purpose",
                 "parameters": [
                     {
                         "type": "integer",
                         "description": "The id of the article",
-                        "name": "articleId",
+                        "name": "article_id",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "There are four possibilities. 0: no reaction; 1: thumbs up; 2: thumbs down; -1: error",
+                        "description": "The previous titles and contents",
                         "schema": {
-                            "type": "int"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.articleRevision"
+                            }
                         }
                     },
-                    "400": {
-                        "description": "Unable to get the cookie",
+                    "403": {
+                        "description": "Only the author or a moderator can read the history",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     },
-                    "500": {
-                        "description": "Failure",
+                    "404": {
+                        "description": "Invalid article ID or the article does not exist",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     }
                 }
-            },
-            "patch": {
+            }
+        },
+        "/article/comment_view/:article_id": {
+            "get": {
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Change user's reaction to an article.",
+                "summary": "List the comments of an article as threads of replies",
                 "parameters": [
                     {
                         "type": "integer",
                         "description": "The id of the article",
-                        "name": "articleId",
+                        "name": "article_id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "0, object; 1, support",
-                        "name": "thumbsup",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "type": "string",
-                            "example": "Subject: thumbsup\r\n\r\n1\r\n"
-                        }
+                        "type": "integer",
+                        "description": "List the replies of this comment instead of the top-level comments",
+                        "name": "parent",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "time (default), the oldest first, or score, the most liked first",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "How many levels of replies to include, 1 to 10, 5 by default",
+                        "name": "max_depth",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "How many comments to list, and replies to include under each, 1 to 100, 50 by default",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "The nextOffset of the previous response, omit it for the first page",
+                        "name": "offset",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Success",
+                        "description": "The comments with their replies",
                         "schema": {
-                            "type": "int"
+                            "$ref": "#/definitions/main.commentThreadPage"
                         }
                     },
                     "400": {
-                        "description": "Unable to get the cookie",
+                        "description": "validation_failed",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     },
-                    "500": {
-                        "description": "Failure",
+                    "404": {
+                        "description": "Invalid article ID, the article or the parent comment does not exist",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     }
                 }
             }
         },
-        "/u/info": {
-            "get": {
+        "/article/create": {
+            "post": {
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Get user information by username",
-                "responses": {
-                    "200": {
-                        "description": "Contains password, gatorId, birthday and gender",
-                        "schema": {
-                            "$ref": "#/definitions/main.user"
-                        }
+                "summary": "Create an article",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The title of the article",
+                        "name": "title",
+                        "in": "header",
+                        "required": true
                     },
-                    "500": {
-                        "description": "Failure",
-                        "schema": {
-                            "type": "error"
-                        }
+                    {
+                        "type": "string",
+                        "description": "The content of the article",
+                        "name": "content",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "The author of the article",
+                        "name": "author",
+                        "in": "header",
+                        "required": true
                     }
-                }
-            }
-        },
-        "/u/info/:item": {
-            "patch": {
-                "produces": [
-                    "application/json"
                 ],
-                "summary": "Modify three types of user information: password, birthday and gender. Birthday must be in the form \"2010-12-30\", and the gender can be male, female or unknown",
                 "responses": {
                     "200": {
-                        "description": "Success",
+                        "description": "If the article has been created successfully, return the number of rows been affected, else 0",
                         "schema": {
-                            "type": "string"
+                            "type": "int"
                         }
                     },
                     "400": {
-                        "description": "Failure",
+                        "description": "validation_failed: the title or content is empty",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     }
                 }
             }
         },
-        "/u/likes": {
+        "/article/list": {
             "get": {
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Get the number of likes a user received.",
+                "summary": "List the articles one page at a time, for infinite scrolling",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "newest (default), liked, discussed or hot",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "The number of articles per page, 1 to 100, 20 by default",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "The nextCursor or prevCursor of the previous response, omit it for the first page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "The number of likes a user received",
+                        "description": "The articles and the cursors of the pages around them",
                         "schema": {
-                            "type": "int"
+                            "$ref": "#/definitions/main.articlePage"
                         }
                     },
                     "400": {
-                        "description": "Unable to get the cookie",
+                        "description": "validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/article/pastposts/:username": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get article posted by the user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "username, i.e. author of the article",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.article"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "The user does not exist",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     },
                     "500": {
-                        "description": "Server internal error",
+                        "description": "failure",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     }
                 }
             }
         },
-        "/u/login": {
+        "/article/view/:article_id": {
             "get": {
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Show the login page",
-                "responses": {}
-            },
-            "post": {
+                "summary": "Open the article page",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "The index of the article",
+                        "name": "article_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Return the article",
+                        "schema": {
+                            "$ref": "#/definitions/main.article"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found or invalid article_id",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "500": {
+                        "description": "Server internal error",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/comment/:comment_id": {
+            "delete": {
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Perform function login",
+                "summary": "Delete a comment, only the author and moderators can. Its replies stay, under a [deleted] placeholder",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Username",
-                        "name": "username",
-                        "in": "header",
+                        "type": "integer",
+                        "description": "The id of the comment",
+                        "name": "comment_id",
+                        "in": "path",
                         "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Success",
+                        "schema": {
+                            "type": "string"
+                        }
                     },
+                    "403": {
+                        "description": "Only the author or a moderator can delete the comment",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Invalid comment ID or the comment does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Edit the content of a comment. Its author can until the edit window of the server is over, moderators always can",
+                "parameters": [
                     {
-                        "type": "string",
-                        "description": "Password",
-                        "name": "password",
-                        "in": "header",
+                        "type": "integer",
+                        "description": "The id of the comment",
+                        "name": "comment_id",
+                        "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "The new content",
+                        "name": "comment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.commentUpdate"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Log in successfully",
+                        "description": "The edited comment, with the time of the edit",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.comment"
                         }
                     },
                     "400": {
-                        "description": "Failed to log in",
+                        "description": "validation_failed, with the reason on the content field",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Only the author or a moderator can edit the comment, or the edit window is over",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Invalid comment ID or the comment does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
                         }
                     }
                 }
             }
         },
-        "/u/logout": {
+        "/conversations": {
             "get": {
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Logout",
+                "summary": "List the conversations of the user with their last message and unread count, the most recently active first",
                 "responses": {
                     "200": {
-                        "description": "Log out successfully",
+                        "description": "The conversations",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.conversation"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Start a conversation with a user, or return the one the user already has with them",
+                "parameters": [
+                    {
+                        "description": "The username of the other user",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.conversationStart"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The conversation",
+                        "schema": {
+                            "$ref": "#/definitions/main.conversation"
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "403": {
+                        "description": "One of the users blocked the other",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "404": {
+                        "description": "The user does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "500": {
+                        "description": "Server internal error",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
                         }
                     }
                 }
             }
         },
-        "/u/register": {
+        "/conversations/:conversation_id/messages": {
             "get": {
-                "summary": "Show the registration page",
-                "responses": {}
-            },
-            "post": {
-                "summary": "Register a new user",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Page through the messages of a conversation, the newest first",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Gatorlink",
-                        "name": "gatorlink",
-                        "in": "header",
+                        "type": "integer",
+                        "description": "The id of the conversation",
+                        "name": "conversation_id",
+                        "in": "path",
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "GatorPW",
-                        "name": "gatorPW",
-                        "in": "header",
-                        "required": true
+                        "type": "integer",
+                        "description": "The number of messages per page, 1 to 100, 50 by default",
+                        "name": "limit",
+                        "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "Username",
-                        "name": "username",
-                        "in": "header",
-                        "required": true
+                        "type": "integer",
+                        "description": "The nextBefore of the previous response, omit it for the first page",
+                        "name": "before",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The messages",
+                        "schema": {
+                            "$ref": "#/definitions/main.messagePage"
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
                     },
+                    "404": {
+                        "description": "Invalid conversation ID or the user isn't in the conversation",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Send a message with text, an image uploaded with /image/upload, or both",
+                "parameters": [
                     {
-                        "type": "string",
-                        "description": "Password",
-                        "name": "password",
-                        "in": "header",
+                        "type": "integer",
+                        "description": "The id of the conversation",
+                        "name": "conversation_id",
+                        "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "The text and/or the file name of the image",
+                        "name": "message",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.messageDraft"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Register successfully, return the number of rows been affected",
+                        "description": "The message sent",
                         "schema": {
-                            "type": "int"
+                            "$ref": "#/definitions/main.message"
                         }
                     },
                     "400": {
-                        "description": "ErrorMessage",
+                        "description": "validation_failed, with the reason on the content or image field",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "403": {
+                        "description": "One of the users blocked the other",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Invalid conversation ID or the user isn't in the conversation",
                         "schema": {
-                            "type": "error"
+                            "$ref": "#/definitions/main.apiError"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "main.article": {
-            "type": "object",
-            "properties": {
-                "author": {
+        },
+        "/conversations/:conversation_id/read": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Mark every message of a conversation as read",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "The id of the conversation",
+                        "name": "conversation_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The conversation, with no unread message",
+                        "schema": {
+                            "$ref": "#/definitions/main.conversation"
+                        }
+                    },
+                    "404": {
+                        "description": "Invalid conversation ID or the user isn't in the conversation",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/events": {
+            "get": {
+                "description": "Each event has the type article, comment, reaction or message and JSON data. A comment line is sent when the stream is idle. The stream ends when the connection falls behind, the client should then reconnect and fetch what it missed. It also ends once the session is logged out or revoked",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "summary": "Stream new articles, comments on the articles and comments of the user, reaction counts and messages as Server-Sent Events",
+                "responses": {
+                    "200": {
+                        "description": "The event stream",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Not logged in",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/image/avatar/:username": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get the avatar of the user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "An avatar is returned",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "404": {
+                        "description": "Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "500": {
+                        "description": "Server internal error",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Upload the avatar of the user, the name of the file should be \"avatar\".",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "username",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "An avatar is uploaded",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Only the user and moderators can change the avatar",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/image/delete/:filename": {
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Delete an image file, only the user who uploaded it and moderators can",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Filename of the image",
+                        "name": "filename",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Success",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid file name",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "403": {
+                        "description": "Only the owner or a moderator can delete the image",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "404": {
+                        "description": "The image does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "500": {
+                        "description": "Failure",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/image/download/:filename": {
+            "get": {
+                "produces": [
+                    "image/jpeg"
+                ],
+                "summary": "Retrieve an image inserted in a post or reply, sent in a conversation of the user, uploaded by the user, or in a gallery the user may see",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Image filename",
+                        "name": "filename",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Success",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid file name",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "404": {
+                        "description": "The image does not exist or the user may not see it",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/image/upload": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Upload images inserted by users in posts or replies. Each image is stored under a new random name, returned with its download address",
+                "responses": {
+                    "200": {
+                        "description": "errno: 0, data: A list of download addresses and file names of images",
+                        "schema": {
+                            "type": "map"
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed: a file is not a JPEG, PNG, GIF or WebP image",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/search": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Search the articles and comments, the best matches first",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The words to find, text in double quotes is searched as a phrase",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only the articles and comments of this user",
+                        "name": "author",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only what was posted on or after this day, e.g. 2022-04-01",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only what was posted on or before this day, e.g. 2022-04-30",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "article or comment, both by default",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "The number of results per page, 1 to 50, 20 by default",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "The nextOffset of the previous response, omit it for the first page",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The matches with highlighted titles and snippets",
+                        "schema": {
+                            "$ref": "#/definitions/main.searchPage"
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "503": {
+                        "description": "Search is not available on this server",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/account": {
+            "delete": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Delete your own account with its articles and comments, the password is required",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Password",
+                        "name": "password",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Success",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed, the password is wrong",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/article/:articleId": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "See how users react to an article.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "The id of the article",
+                        "name": "articleId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "There are four possibilities. 0: no reaction; 1: thumbs up; 2: thumbs down; -1: error",
+                        "schema": {
+                            "type": "int"
+                        }
+                    },
+                    "404": {
+                        "description": "Invalid article ID or the article does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "500": {
+                        "description": "Failure",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Clear user's reaction to an article.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "The id of the article",
+                        "name": "articleId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The new numbers of likes and dislikes of the article",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Invalid article ID or the article does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "500": {
+                        "description": "Failure",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Change user's reaction to an article.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "The id of the article",
+                        "name": "articleId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "0, object; 1, support",
+                        "name": "thumbsup",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string",
+                            "example": "Subject: thumbsup\r\n\r\n1\r\n"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The new numbers of likes and dislikes of the article",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Invalid article ID or the article does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "500": {
+                        "description": "Failure",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/block/:username": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Block a user, neither of them can message the other until the user is unblocked. Their match and ratings of each other are removed",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The user to block",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Success",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "You can't block yourself",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "404": {
+                        "description": "The user does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "500": {
+                        "description": "Server internal error",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Unblock a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The user to unblock",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Success",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "The user isn't blocked",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/blocks": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List the users the user blocked, the most recent first",
+                "responses": {
+                    "200": {
+                        "description": "The usernames",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/u/comment/:commentId": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "See how the user reacts to a comment.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "The id of the comment",
+                        "name": "commentId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "0: no reaction; 1: thumbs up; 2: thumbs down",
+                        "schema": {
+                            "type": "int"
+                        }
+                    },
+                    "404": {
+                        "description": "Invalid comment ID or the comment does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Clear the reaction of the user to a comment.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "The id of the comment",
+                        "name": "commentId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The new numbers of likes and dislikes of the comment",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Invalid comment ID or the comment does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Like or dislike a comment, replacing the previous reaction of the user.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "The id of the comment",
+                        "name": "commentId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "0, dislike; 1, like",
+                        "name": "thumbsup",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string",
+                            "example": "Subject: thumbsup\r\n\r\n1\r\n"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The new numbers of likes and dislikes of the comment",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "404": {
+                        "description": "Invalid comment ID or the comment does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/discover": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List profiles to show interest in or pass on, filtered by the discover preferences. The order is shuffled once a day for each user, and the fields hidden from the user are omitted",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "The number of profiles per page, 1 to 50, 20 by default",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "The nextCursor of the previous response, omit it for the first page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The profiles and the cursor of the next page",
+                        "schema": {
+                            "$ref": "#/definitions/main.candidatePage"
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/discover/preferences": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get who the user wants to see in the discover stack",
+                "responses": {
+                    "200": {
+                        "description": "The preferences, the defaults if the user never set them",
+                        "schema": {
+                            "$ref": "#/definitions/main.discoverPreferences"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Replace the discover preferences. The fields left out take their default values",
+                "parameters": [
+                    {
+                        "description": "interestedIn: male, female or everyone; minAge and maxAge from 18 to 99; major and gradYear null for any",
+                        "name": "preferences",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.discoverPreferences"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The preferences after the change",
+                        "schema": {
+                            "$ref": "#/definitions/main.discoverPreferences"
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed, with the reason on each invalid field",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/info": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get the profile of the user with the private fields and who may see each field. The password is never returned",
+                "responses": {
+                    "200": {
+                        "description": "The profile, with gatorId, birthday, role and visibility",
+                        "schema": {
+                            "$ref": "#/definitions/main.ownProfile"
+                        }
+                    },
+                    "500": {
+                        "description": "Failure",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Modify the profile of the user. Birthday must be in the form \"2010-12-30\" and not in the future, the gender can be male, female or unknown, major is at most 100 characters, grad_year a year from 1950 to 2100, bio at most 500 characters and pronouns at most 30; \"\" and null clear them. tags (at most 10) and photos (at most 6 file names of images uploaded with /image/upload) replace the lists. Any other field is rejected",
+                "parameters": [
+                    {
+                        "description": "The fields to change: birthday, gender, major, grad_year, bio, pronouns, tags and/or photos",
+                        "name": "profile",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Success",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed, with fields mapping each rejected field to the reason",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "500": {
+                        "description": "Failure",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/info/visibility": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get who may see each field of the profile of the user",
+                "responses": {
+                    "200": {
+                        "description": "public, followers or matches for each field",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Change who may see fields of the profile, the fields left out are unchanged. Followers only shows the field to the followers the user follows back and to matches",
+                "parameters": [
+                    {
+                        "description": "age, gender, pronouns, bio, major, gradYear, tags or photos: public, followers or matches",
+                        "name": "visibility",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The visibility after the change",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed, with the reason on each invalid field",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/interest/:username": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Show interest in a user. They only learn about it if they are interested too, which makes a match",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The user",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "matched: whether the users are matched now",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "boolean"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "You can't rate your own profile",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "403": {
+                        "description": "One of the users blocked the other",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "404": {
+                        "description": "The user does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "500": {
+                        "description": "Server internal error",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/likes": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get the number of likes a user received.",
+                "responses": {
+                    "200": {
+                        "description": "The number of likes a user received",
+                        "schema": {
+                            "type": "int"
+                        }
+                    },
+                    "401": {
+                        "description": "Not logged in",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "500": {
+                        "description": "Server internal error",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/login": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Show the login page",
+                "responses": {}
+            },
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Perform function login",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Password",
+                        "name": "password",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Log in successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Failed to log in",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "403": {
+                        "description": "The account is not verified yet",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/logout": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Logout",
+                "responses": {
+                    "200": {
+                        "description": "Log out successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/matches": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List the users the user matched with, the newest first",
+                "responses": {
+                    "200": {
+                        "description": "The matches",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.match"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/u/matches/:username": {
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Undo a match. The user's interest turns into a pass, so the match isn't made again",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The matched user",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Success",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "The users aren't matched",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/notifications": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List the notifications of the user, the newest first",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "true to list only the notifications that aren't read",
+                        "name": "unread",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "The number of notifications per page, 1 to 100, 20 by default",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "The nextBefore of the previous response, omit it for the first page",
+                        "name": "before",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The notifications and the number of unread ones",
+                        "schema": {
+                            "$ref": "#/definitions/main.notificationPage"
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/notifications/preferences": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "See which kinds of notifications the user receives",
+                "responses": {
+                    "200": {
+                        "description": "comment, reply, like, follow and match: false when the kind is muted",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "boolean"
+                            }
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Mute or unmute kinds of notifications, the kinds left out are unchanged",
+                "parameters": [
+                    {
+                        "description": "comment, reply, like, follow or match: false to mute the kind, true to receive it again",
+                        "name": "preferences",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "boolean"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The preferences after the change",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "boolean"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed, with the reason on each unknown kind",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/notifications/read": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Mark notifications of the user as read",
+                "parameters": [
+                    {
+                        "description": "The IDs of the notifications, at most 100",
+                        "name": "ids",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.notificationIDs"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "marked: how many were marked, unread: how many are left",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/notifications/read_all": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Mark every notification of the user as read",
+                "responses": {
+                    "200": {
+                        "description": "marked: how many were marked, unread: how many are left",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/u/notifications/unread_count": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Count the notifications of the user that aren't read",
+                "responses": {
+                    "200": {
+                        "description": "unread: the number of unread notifications",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/u/pass/:username": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Pass on a user, undoing the match with them if any",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The user",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "matched: false",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "boolean"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "You can't rate your own profile",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "403": {
+                        "description": "One of the users blocked the other",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "404": {
+                        "description": "The user does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "500": {
+                        "description": "Server internal error",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/password": {
+            "patch": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Change the password of the user, the old password is required",
+                "parameters": [
+                    {
+                        "description": "The old and the new password",
+                        "name": "password",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.passwordChange"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Success",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed, with fields mapping each rejected field to the reason",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "500": {
+                        "description": "Failure",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/password/forgot": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Email a password reset token to the GatorLink of an account. The answer is the same whether the account exists or not",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "If the account exists, a reset token was sent",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many reset requests for the account or from the IP",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/password/reset": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Set a new password with the token emailed by /u/password/forgot. Every session of the account is logged out",
+                "parameters": [
+                    {
+                        "description": "The reset token and the new password",
+                        "name": "reset",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.passwordReset"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Success",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed, the token is invalid, expired or used, or the password is empty",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many attempts from the IP",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/profile/:username": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get the public profile of a user. The age replaces the birthday, and the fields the user hides from the viewer are left out",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The user",
+                        "name": "username",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The fields the viewer may see",
+                        "schema": {
+                            "$ref": "#/definitions/main.profile"
+                        }
+                    },
+                    "404": {
+                        "description": "The user does not exist or one of the users blocked the other",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/register": {
+            "get": {
+                "summary": "Show the registration page",
+                "responses": {}
+            },
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Register a new user. The account is pending until the code emailed to the GatorLink is sent to /u/verify",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "GatorLink username or @ufl.edu address",
+                        "name": "gatorlink",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Password",
+                        "name": "password",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "male, female or unknown",
+                        "name": "gender",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Birthday in the form 2006-01-02",
+                        "name": "birthday",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The verification code was sent",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed, with the reason on the username, password, gatorlink, gender or birthday field",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "409": {
+                        "description": "The GatorLink already belongs to an active account",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/verify": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Activate a pending account with the code emailed to its GatorLink, and log in. The link in the email uses GET with the query parameters",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "The 6 digit code",
+                        "name": "code",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The account is active and logged in",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "validation_failed, the code is wrong or has expired",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "404": {
+                        "description": "No account is waiting for verification with this username",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "409": {
+                        "description": "Another account with the GatorLink was activated first",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many wrong codes, a new one must be requested",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        },
+        "/u/verify/resend": {
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Email a new verification code to a pending account, at most once a minute",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The verification code was sent",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "No account is waiting for verification with this username",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    },
+                    "429": {
+                        "description": "A code was sent less than a minute ago",
+                        "schema": {
+                            "$ref": "#/definitions/main.apiError"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "main.apiError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Stable, machine readable reason, e.g. \"not_found\"",
+                    "type": "string",
+                    "example": "validation_failed"
+                },
+                "fields": {
+                    "description": "The reason each rejected field of the request was rejected",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "message": {
+                    "description": "Human readable description",
+                    "type": "string",
+                    "example": "Invalid request body"
+                },
+                "request_id": {
+                    "description": "The ID of the request, also sent in the X-Request-ID header",
+                    "type": "string",
+                    "example": "4f9c2a1be07d3c58"
+                }
+            }
+        },
+        "main.article": {
+            "type": "object",
+            "properties": {
+                "author": {
+                    "type": "string"
+                },
+                "content": {
+                    "type": "string"
+                },
+                "dislikes": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "likes": {
+                    "type": "integer"
+                },
+                "postTime": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.articlePage": {
+            "type": "object",
+            "properties": {
+                "articles": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.feedArticle"
+                    }
+                },
+                "nextCursor": {
+                    "type": "string"
+                },
+                "prevCursor": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.articleRevision": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "type": "string"
+                },
+                "editedAt": {
+                    "type": "string"
+                },
+                "editedBy": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.articleUpdate": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.candidate": {
+            "type": "object",
+            "properties": {
+                "age": {
+                    "type": "integer"
+                },
+                "gender": {
+                    "type": "string"
+                },
+                "gradYear": {
+                    "type": "integer"
+                },
+                "major": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.candidatePage": {
+            "type": "object",
+            "properties": {
+                "candidates": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.candidate"
+                    }
+                },
+                "nextCursor": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.comment": {
+            "type": "object",
+            "properties": {
+                "article_id": {
+                    "type": "integer"
+                },
+                "commentId": {
+                    "type": "integer"
+                },
+                "commentTime": {
+                    "type": "string"
+                },
+                "comment_author": {
+                    "type": "string"
+                },
+                "content": {
+                    "type": "string"
+                },
+                "dislikes": {
+                    "type": "integer"
+                },
+                "editedAt": {
+                    "description": "When the content was last changed, nil if it never was",
+                    "type": "string"
+                },
+                "likes": {
+                    "type": "integer"
+                },
+                "parentId": {
+                    "description": "The comment this one replies to, nil for a top-level comment",
+                    "type": "integer"
+                }
+            }
+        },
+        "main.commentNode": {
+            "type": "object",
+            "properties": {
+                "article_id": {
+                    "type": "integer"
+                },
+                "commentId": {
+                    "type": "integer"
+                },
+                "commentTime": {
+                    "type": "string"
+                },
+                "comment_author": {
+                    "type": "string"
+                },
+                "content": {
                     "type": "string"
                 },
+                "deleted": {
+                    "type": "boolean"
+                },
+                "depth": {
+                    "type": "integer"
+                },
+                "dislikes": {
+                    "type": "integer"
+                },
+                "editedAt": {
+                    "description": "When the content was last changed, nil if it never was",
+                    "type": "string"
+                },
+                "likes": {
+                    "type": "integer"
+                },
+                "myReaction": {
+                    "type": "integer"
+                },
+                "parentId": {
+                    "description": "The comment this one replies to, nil for a top-level comment",
+                    "type": "integer"
+                },
+                "replies": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.commentNode"
+                    }
+                },
+                "replyCount": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.commentThreadPage": {
+            "type": "object",
+            "properties": {
+                "comments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.commentNode"
+                    }
+                },
+                "nextOffset": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.commentUpdate": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.conversation": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "lastMessage": {
+                    "$ref": "#/definitions/main.message"
+                },
+                "unread": {
+                    "type": "integer"
+                },
+                "with": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.conversationStart": {
+            "type": "object",
+            "properties": {
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.discoverPreferences": {
+            "type": "object",
+            "properties": {
+                "gradYear": {
+                    "type": "integer"
+                },
+                "interestedIn": {
+                    "description": "male, female or everyone",
+                    "type": "string"
+                },
+                "major": {
+                    "type": "string"
+                },
+                "maxAge": {
+                    "type": "integer"
+                },
+                "minAge": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.feedArticle": {
+            "type": "object",
+            "properties": {
+                "author": {
+                    "type": "string"
+                },
+                "comments": {
+                    "type": "integer"
+                },
                 "content": {
                     "type": "string"
                 },
@@ -588,28 +2811,312 @@ const docTemplate = `{
                 }
             }
         },
-        "main.user": {
+        "main.match": {
+            "type": "object",
+            "properties": {
+                "matchedAt": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.message": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "type": "string"
+                },
+                "conversationId": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "image": {
+                    "type": "string"
+                },
+                "imageUrl": {
+                    "type": "string"
+                },
+                "sender": {
+                    "type": "string"
+                },
+                "sentAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.messageDraft": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "type": "string"
+                },
+                "image": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.messagePage": {
+            "type": "object",
+            "properties": {
+                "messages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.message"
+                    }
+                },
+                "nextBefore": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.notification": {
+            "type": "object",
+            "properties": {
+                "actor": {
+                    "type": "string"
+                },
+                "articleId": {
+                    "type": "integer"
+                },
+                "commentId": {
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "read": {
+                    "type": "boolean"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.notificationIDs": {
+            "type": "object",
+            "properties": {
+                "ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "main.notificationPage": {
+            "type": "object",
+            "properties": {
+                "nextBefore": {
+                    "type": "integer"
+                },
+                "notifications": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.notification"
+                    }
+                },
+                "unread": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.ownProfile": {
             "type": "object",
             "properties": {
+                "age": {
+                    "type": "integer"
+                },
+                "bio": {
+                    "type": "string"
+                },
                 "birthday": {
                     "type": "string"
                 },
-                "gatorPW": {
+                "gatorId": {
+                    "type": "string"
+                },
+                "gender": {
+                    "type": "string"
+                },
+                "gradYear": {
+                    "type": "integer"
+                },
+                "major": {
+                    "type": "string"
+                },
+                "photos": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.profilePhoto"
+                    }
+                },
+                "pronouns": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "username": {
+                    "type": "string"
+                },
+                "visibility": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "main.passwordChange": {
+            "type": "object",
+            "required": [
+                "new_password",
+                "old_password"
+            ],
+            "properties": {
+                "new_password": {
+                    "type": "string"
+                },
+                "old_password": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.passwordReset": {
+            "type": "object",
+            "required": [
+                "new_password",
+                "token"
+            ],
+            "properties": {
+                "new_password": {
+                    "type": "string"
+                },
+                "token": {
                     "type": "string"
+                }
+            }
+        },
+        "main.profile": {
+            "type": "object",
+            "properties": {
+                "age": {
+                    "type": "integer"
                 },
-                "gatorlink": {
+                "bio": {
                     "type": "string"
                 },
                 "gender": {
                     "type": "string"
                 },
-                "password": {
+                "gradYear": {
+                    "type": "integer"
+                },
+                "major": {
+                    "type": "string"
+                },
+                "photos": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.profilePhoto"
+                    }
+                },
+                "pronouns": {
                     "type": "string"
                 },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "username": {
                     "type": "string"
                 }
             }
+        },
+        "main.profilePhoto": {
+            "type": "object",
+            "properties": {
+                "filename": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.roleChange": {
+            "type": "object",
+            "required": [
+                "role"
+            ],
+            "properties": {
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "user",
+                        "moderator",
+                        "admin"
+                    ]
+                }
+            }
+        },
+        "main.searchPage": {
+            "type": "object",
+            "properties": {
+                "nextOffset": {
+                    "type": "integer"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.searchResult"
+                    }
+                }
+            }
+        },
+        "main.searchResult": {
+            "type": "object",
+            "properties": {
+                "articleId": {
+                    "type": "integer"
+                },
+                "author": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "postTime": {
+                    "type": "string"
+                },
+                "score": {
+                    "type": "number"
+                },
+                "snippet": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
@@ -9,6 +9,7 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.11
 	github.com/swaggo/gin-swagger v1.4.0
 	github.com/swaggo/swag v1.8.1
+	golang.org/x/crypto v0.0.0-20220128200615-198e4374d7ed
 )
 
 require (
@@ -31,7 +32,6 @@ require (
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/ugorji/go/codec v1.2.6 // indirect
-	golang.org/x/crypto v0.0.0-20220128200615-198e4374d7ed // indirect
 	golang.org/x/net v0.0.0-20220127200216-cd36cc0744dd // indirect
 	golang.org/x/sys v0.0.0-20220128215802-99c3d69c2c27 // indirect
 	golang.org/x/text v0.3.7 // indirect
@@ -0,0 +1,195 @@
+// handlers.admin.go
+
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type roleChange struct {
+	Role string `json:"role" validate:"required,oneof=user moderator admin"`
+}
+
+// @Summary Change the role of a user, only admins can. An admin can't change their own role
+// @Accept json
+// @Produce json
+// @Param username path string true "username"
+// @Param role body roleChange true "user, moderator or admin"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apiError "validation_failed"
+// @Failure 403 {object} apiError "Only admins can change roles"
+// @Failure 404 {object} apiError "The user does not exist"
+// @Router /admin/users/:username/role [patch]
+func changeUserRole(c *gin.Context) {
+	username := c.Param("username")
+
+	var change roleChange
+	if err := c.ShouldBindJSON(&change); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+	if err := validate.Struct(change); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+
+	if username == getCurrentUser(c).Username {
+		abortWithAPIError(c, http.StatusBadRequest, "You can't change your own role")
+		return
+	}
+
+	err := setUserRole(username, change.Role)
+	if err == sql.ErrNoRows {
+		abortWithAPIError(c, http.StatusNotFound, "The user does not exist")
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
+
+// @Summary Delete the account of another user with its articles and comments. Moderators can delete users, admins can delete anyone else
+// @Produce json
+// @Param username path string true "username"
+// @Success 200 {string} string "Success"
+// @Failure 403 {object} apiError "The role of the user is not below yours"
+// @Failure 404 {object} apiError "The user does not exist"
+// @Router /admin/users/:username [delete]
+func deleteUserAccount(c *gin.Context) {
+	username := c.Param("username")
+	tempuser := getCurrentUser(c)
+
+	if username == tempuser.Username {
+		abortWithAPIError(c, http.StatusBadRequest, "Use DELETE /u/account to delete your own account")
+		return
+	}
+
+	role, err := getUserRole(username)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	if !hasRole(tempuser.Role, roleAdmin) && roleRanks[role] >= roleRanks[tempuser.Role] {
+		abortWithAPIError(c, http.StatusForbidden, "Only admins can delete moderators and admins")
+		return
+	}
+
+	respondWithDeletedUser(c, username)
+}
+
+// @Summary Delete your own account with its articles and comments, the password is required
+// @Accept json
+// @Produce json
+// @Param password header string true "Password"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apiError "validation_failed, the password is wrong"
+// @Router /u/account [delete]
+func deleteOwnAccount(c *gin.Context) {
+	var req struct {
+		Password string `json:"password" validate:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+
+	tempuser := getCurrentUser(c)
+	valid, err := isUserValid(mingleUser{Username: tempuser.Username, Password: req.Password})
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	if !valid {
+		abortWithFieldErrors(c, "Invalid account deletion", map[string]string{"password": errWrongPassword.Error()})
+		return
+	}
+
+	respondWithDeletedUser(c, tempuser.Username)
+}
+
+// Delete an account and answer with the result. Moderators can restore it
+// until it is purged
+func respondWithDeletedUser(c *gin.Context, username string) {
+	err := softDeleteUser(username, getCurrentUser(c).Username)
+	if err == sql.ErrNoRows {
+		abortWithAPIError(c, http.StatusNotFound, "The user does not exist")
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
+
+// @Summary Restore a deleted article with the comments deleted along with it, only moderators can
+// @Produce json
+// @Param article_id path int true "The id of the article"
+// @Success 200 {string} string "Success"
+// @Failure 404 {object} apiError "Invalid article ID or the article is not deleted"
+// @Failure 409 {object} apiError "The author of the article is deleted"
+// @Router /admin/articles/:article_id/restore [post]
+func restoreDeletedArticle(c *gin.Context) {
+	articleId, err := strconv.Atoi(c.Param("article_id"))
+	if err != nil {
+		abortWithAPIError(c, http.StatusNotFound, "Invalid article ID")
+		return
+	}
+	respondWithRestored(c, restoreArticle(articleId), "The article is not deleted")
+}
+
+// @Summary Restore a deleted comment, only moderators can
+// @Produce json
+// @Param comment_id path int true "The id of the comment"
+// @Success 200 {string} string "Success"
+// @Failure 404 {object} apiError "Invalid comment ID or the comment is not deleted"
+// @Failure 409 {object} apiError "The article or the author of the comment is deleted"
+// @Router /admin/comments/:comment_id/restore [post]
+func restoreDeletedComment(c *gin.Context) {
+	commentId, err := strconv.Atoi(c.Param("comment_id"))
+	if err != nil {
+		abortWithAPIError(c, http.StatusNotFound, "Invalid comment ID")
+		return
+	}
+	respondWithRestored(c, restoreComment(commentId), "The comment is not deleted")
+}
+
+// @Summary Restore a deleted account with the articles and comments deleted along with it, only moderators can
+// @Produce json
+// @Param username path string true "username"
+// @Success 200 {string} string "Success"
+// @Failure 404 {object} apiError "The account is not deleted"
+// @Router /admin/users/:username/restore [post]
+func restoreDeletedUser(c *gin.Context) {
+	respondWithRestored(c, restoreUser(c.Param("username")), "The account is not deleted")
+}
+
+// Answer with the result of a restore
+func respondWithRestored(c *gin.Context, err error, notFound string) {
+	if err == sql.ErrNoRows {
+		abortWithAPIError(c, http.StatusNotFound, notFound)
+		return
+	}
+	if err == errParentDeleted {
+		abortWithAPIError(c, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
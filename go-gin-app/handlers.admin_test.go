@@ -0,0 +1,167 @@
+// handlers.admin_test.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Test that only admins change roles, and never their own
+func TestChangeUserRole(t *testing.T) {
+	r := getAppRouter()
+	setUserRole("user_mj", roleAdmin)
+	defer setUserRole("user_mj", roleUser)
+	defer setUserRole("user_rl", roleUser)
+
+	patch := func(path string, payload string, username string) int {
+		req, _ := http.NewRequest("PATCH", path, strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(getSessionCookie(t, username))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := patch("/admin/users/user_rl/role", `{"role": "moderator"}`, "user1"); code != http.StatusForbidden {
+		t.Errorf("a user changed a role: %d", code)
+	}
+	if code := patch("/admin/users/user_rl/role", `{"role": "owner"}`, "user_mj"); code != http.StatusBadRequest {
+		t.Errorf("an unknown role was accepted: %d", code)
+	}
+	if code := patch("/admin/users/nobody/role", `{"role": "moderator"}`, "user_mj"); code != http.StatusNotFound {
+		t.Errorf("got %d for a missing user", code)
+	}
+	if code := patch("/admin/users/user_mj/role", `{"role": "user"}`, "user_mj"); code != http.StatusBadRequest {
+		t.Errorf("an admin changed their own role: %d", code)
+	}
+	if code := patch("/admin/users/user_rl/role", `{"role": "moderator"}`, "user_mj"); code != http.StatusOK {
+		t.Errorf("the admin could not change a role: %d", code)
+	}
+	if role, _ := getUserRole("user_rl"); role != roleModerator {
+		t.Errorf("got role %s", role)
+	}
+}
+
+// Test who can delete which account
+func TestDeleteAccounts(t *testing.T) {
+	r := getAppRouter()
+	setUserRole("user_rl", roleModerator)
+	defer setUserRole("user_rl", roleUser)
+
+	victim := user{Gatorlink: "victim@ufl.edu", Username: "victim", Password: "p", Gender: "unknown"}
+	registerActiveUser(t, victim)
+	defer deleteUser(victim.Username)
+
+	send := func(method string, path string, payload string, username string) int {
+		req, _ := http.NewRequest(method, path, strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(getSessionCookie(t, username))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send("DELETE", "/admin/users/victim", "", "user1"); code != http.StatusForbidden {
+		t.Errorf("a user deleted an account: %d", code)
+	}
+	// A moderator can't delete another moderator
+	setUserRole(victim.Username, roleModerator)
+	if code := send("DELETE", "/admin/users/victim", "", "user_rl"); code != http.StatusForbidden {
+		t.Errorf("a moderator deleted a moderator: %d", code)
+	}
+	setUserRole(victim.Username, roleUser)
+
+	// Deleting your own account needs the password
+	if code := send("DELETE", "/u/account", `{"password": "wrong"}`, "victim"); code != http.StatusBadRequest {
+		t.Errorf("an account was deleted with a wrong password: %d", code)
+	}
+	if code := send("DELETE", "/admin/users/victim", "", "user_rl"); code != http.StatusOK {
+		t.Errorf("the moderator could not delete the account: %d", code)
+	}
+	if exist, _ := isUserExist(victim.Username); exist {
+		t.Error("the account was not deleted")
+	}
+	if code := send("DELETE", "/admin/users/victim", "", "user_rl"); code != http.StatusNotFound {
+		t.Errorf("got %d for an account already deleted", code)
+	}
+}
+
+// Test that deleted accounts and articles are hidden with their content,
+// and that only moderators can restore them
+func TestRestoreDeleted(t *testing.T) {
+	r := getAppRouter()
+	setUserRole("user_rl", roleModerator)
+	defer setUserRole("user_rl", roleUser)
+
+	send := func(method string, path string, username string) int {
+		req, _ := http.NewRequest(method, path, nil)
+		req.AddCookie(getSessionCookie(t, username))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	countContent := func(username string) (int, int) {
+		articles, err := getArticlesByUser(username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		comments, err := getCommentsByUser(username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(articles), len(comments)
+	}
+
+	articles, comments := countContent("user1")
+	if articles == 0 || comments == 0 {
+		t.Fatal("user1 has no content to delete")
+	}
+
+	if code := send("DELETE", "/admin/users/user1", "user_rl"); code != http.StatusOK {
+		t.Fatalf("the moderator could not delete the account: %d", code)
+	}
+	if a, c := countContent("user1"); a != 0 || c != 0 {
+		t.Errorf("%d articles and %d comments are still listed", a, c)
+	}
+	if exist, _ := isUserExist("user1"); exist {
+		t.Error("the account is still active")
+	}
+
+	// An article of the deleted account can't be restored on its own
+	var articleId int
+	DB.QueryRow("SELECT id FROM articles WHERE author = 'user1'").Scan(&articleId)
+	if code := send("POST", fmt.Sprintf("/admin/articles/%d/restore", articleId), "user_rl"); code != http.StatusConflict {
+		t.Errorf("got %d restoring an article of a deleted account", code)
+	}
+
+	if code := send("POST", "/admin/users/user1/restore", "user2"); code != http.StatusForbidden {
+		t.Errorf("a user restored an account: %d", code)
+	}
+	if code := send("POST", "/admin/users/user1/restore", "user_rl"); code != http.StatusOK {
+		t.Fatalf("the moderator could not restore the account: %d", code)
+	}
+	if a, c := countContent("user1"); a != articles || c != comments {
+		t.Errorf("got %d articles and %d comments back, want %d and %d", a, c, articles, comments)
+	}
+	if code := send("POST", "/admin/users/user1/restore", "user_rl"); code != http.StatusNotFound {
+		t.Errorf("got %d restoring an account that is not deleted", code)
+	}
+
+	// The author deletes an article, a moderator brings it back
+	if code := send("DELETE", fmt.Sprintf("/article/%d", articleId), "user1"); code != http.StatusOK {
+		t.Fatalf("the author could not delete the article: %d", code)
+	}
+	if a, _ := getArticleByID(articleId); a.ID != 0 {
+		t.Error("the deleted article can still be read")
+	}
+	if code := send("POST", fmt.Sprintf("/admin/articles/%d/restore", articleId), "user_rl"); code != http.StatusOK {
+		t.Errorf("the moderator could not restore the article: %d", code)
+	}
+	if a, _ := getArticleByID(articleId); a.ID != articleId {
+		t.Error("the restored article can't be read")
+	}
+}
@@ -3,17 +3,14 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
 )
 
-var validate = validator.New()
+var validate = newValidator()
 
 // @Summary Show forum home page and all articles
 // @Produce json
@@ -22,8 +19,8 @@ var validate = validator.New()
 func showIndexPage(c *gin.Context) {
 	articles, err := getAllArticles()
 	if err != nil {
-		//print + exit
-		log.Fatal(err)
+		abortWithInternalError(c, err)
+		return
 	}
 	//fmt.Println(articles)
 	// Call the render function with the name of the template to render
@@ -34,6 +31,59 @@ func showIndexPage(c *gin.Context) {
 	//c.JSON(http.StatusOK, articles)
 }
 
+// @Summary List the articles one page at a time, for infinite scrolling
+// @Produce json
+// @Param sort query string false "newest (default), liked, discussed or hot"
+// @Param limit query int false "The number of articles per page, 1 to 100, 20 by default"
+// @Param cursor query string false "The nextCursor or prevCursor of the previous response, omit it for the first page"
+// @Success 200 {object} articlePage "The articles and the cursors of the pages around them"
+// @Failure 400 {object} apiError "validation_failed"
+// @Router /article/list [get]
+func listArticles(c *gin.Context) {
+	problems := map[string]string{}
+
+	sort := c.DefaultQuery("sort", "newest")
+	if _, ok := feedSortKeys[sort]; !ok {
+		problems["sort"] = "must be newest, liked, discussed or hot"
+	}
+
+	limit := defaultFeedLimit
+	if raw, ok := c.GetQuery("limit"); ok {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxFeedLimit {
+			problems["limit"] = fmt.Sprintf("must be a number from 1 to %d", maxFeedLimit)
+		}
+		limit = n
+	}
+
+	var cursor *feedCursor
+	if raw := c.Query("cursor"); raw != "" {
+		cur, err := decodeFeedCursor(raw)
+		if err != nil {
+			problems["cursor"] = err.Error()
+		} else if c.Query("sort") != "" && cur.Sort != sort {
+			problems["cursor"] = "The cursor belongs to another sort mode"
+		} else {
+			// The sort mode can be left out after the first page
+			sort = cur.Sort
+			cursor = &cur
+		}
+	}
+
+	if len(problems) > 0 {
+		abortWithFieldErrors(c, "Invalid article list", problems)
+		return
+	}
+
+	page, err := getArticleFeed(sort, cursor, limit)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
 //这应该是前端负责的
 //用于测试
 func showArticleCreationPage(c *gin.Context) {
@@ -46,32 +96,22 @@ func showArticleCreationPage(c *gin.Context) {
 // @Produce json
 // @Param article_id path int true "The index of the article"
 // @Success 200 {object} article "Return the article"
-// @Failure 404 {string} string "Not found or invalid article_id"
+// @Failure 404 {object} apiError "Not found or invalid article_id"
+// @Failure 500 {object} apiError "Server internal error"
 // @Router /article/view/:article_id [get]
 func getArticle(c *gin.Context) {
-	// Check if the article ID is valid
-	if articleID, err := strconv.Atoi(c.Param("article_id")); err == nil {
-		// Check if the article exists
-
-		if article, err := getArticleByID(articleID); err == nil {
-			// Call the render function with the title, article and the name of the
-			// template
-			render(c, gin.H{
-				"title":   article.Title,
-				"payload": article}, "article.html")
-			//c.JSON(http.StatusOK, article)
-
-		} else {
-			// If the article is not found, abort with an error
-			//c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			c.AbortWithError(http.StatusNotFound, err)
-		}
-
-	} else {
-		// If an invalid article ID is specified in the URL, abort with an error
-		//c.JSON(http.StatusNotFound, gin.H{"error": "Invalid article ID"})
-		c.AbortWithStatus(http.StatusNotFound)
+	// Check if the article exists and hasn't been deleted
+	article, ok := getExistingArticle(c, "article_id")
+	if !ok {
+		return
 	}
+
+	// Call the render function with the title, article and the name of the
+	// template
+	render(c, gin.H{
+		"title":   article.Title,
+		"payload": article}, "article.html")
+	//c.JSON(http.StatusOK, article)
 }
 
 // @Summary Create an article
@@ -80,45 +120,44 @@ func getArticle(c *gin.Context) {
 // @Param content header string true "The content of the article"
 // @Param author header string true "The author of the article"
 // @Success 200 {int} int "If the article has been created successfully, return the number of rows been affected, else 0"
-// @Failure 400 {error} error "There is an error while creating the article"
+// @Failure 400 {object} apiError "validation_failed: the title or content is empty"
 // @Router /article/create [post]
 func createArticle(c *gin.Context) {
 	// Obtain the POSTed title and content values
 	var articleData article
 
-	if err := c.BindJSON(&articleData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		fmt.Println(err)
+	if err := c.ShouldBindJSON(&articleData); err != nil {
+		abortWithInvalidBody(c, err)
 		return
 	}
 
-	validationErr := validate.Struct(articleData)
-	if validationErr != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": validationErr})
-		fmt.Println(validationErr)
+	// The same checks as an edit giving both fields
+	create := articleUpdate{Title: &articleData.Title, Content: &articleData.Content}
+	if fields := create.validate(); len(fields) != 0 {
+		abortWithFieldErrors(c, "Invalid article", fields)
 		return
 	}
 	//title := c.PostForm("title")
 	//content := c.PostForm("content")
 	//author := c.PostForm("author")
-	var tempuser mingleUser
-	token, _ := c.Cookie("token")
-	if err := json.Unmarshal([]byte(token), &tempuser); err == nil {
-		if num, err := createNewArticle(articleData, tempuser); num != 0 && err == nil {
-			// If the article is created successfully, show success message
-			render(c, gin.H{
-				"title":   "Submission Successful",
-				"payload": num}, "submission-successful.html")
-			//c.JSON(http.StatusOK, status)
-		} else {
-			// if there was an error while creating the article, abort with an error
-			//c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			c.AbortWithError(http.StatusBadRequest, err)
-		}
-	} else {
-		c.AbortWithError(http.StatusUnauthorized, err)
+	tempuser := getCurrentUser(c)
+	num, err := createNewArticle(articleData, tempuser.Username)
+	if err != nil {
+		// if there was an error while creating the article, abort with an error
+		abortWithInternalError(c, err)
+		return
+	}
+	if num == 0 {
+		abortWithAPIError(c, http.StatusBadRequest, "The article could not be created")
+		return
 	}
 
+	// If the article is created successfully, show success message
+	render(c, gin.H{
+		"title":   "Submission Successful",
+		"payload": num}, "submission-successful.html")
+	//c.JSON(http.StatusOK, status)
+
 	/*if num, err := createNewArticle(articleData); num != 0 && err == nil {
 		// If the article is created successfully, show success message
 		render(c, gin.H{
@@ -136,15 +175,110 @@ func createArticle(c *gin.Context) {
 // @Produce json
 // @Param username path string true "username, i.e. author of the article"
 // @Success 200 {array} article "success"
-// @Failure 400 {error} error "failure"
+// @Failure 500 {object} apiError "failure"
+// @Failure 404 {object} apiError "The user does not exist"
 // @Router /article/pastposts/:username [get]
 func getArticleByUsername(c *gin.Context) {
 	username := c.Param("username")
+	if exist, err := isUserExist(username); err != nil {
+		abortWithInternalError(c, err)
+		return
+	} else if !exist {
+		abortWithAPIError(c, http.StatusNotFound, "The user does not exist")
+		return
+	}
 	articleList, err := getArticlesByUser(username)
 	if err != nil {
-		c.AbortWithError(http.StatusBadRequest, err)
-		log.Fatal(err)
+		abortWithInternalError(c, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, articleList)
 }
+
+// @Summary Edit the title and/or content of an article, only the author and moderators can. The previous version is kept in the history
+// @Accept json
+// @Produce json
+// @Param article_id path int true "The id of the article"
+// @Param article body articleUpdate true "The new title and/or content"
+// @Success 200 {object} article "The edited article"
+// @Failure 400 {object} apiError "validation_failed, with the reason on the title or content field"
+// @Failure 403 {object} apiError "Only the author or a moderator can edit the article"
+// @Failure 404 {object} apiError "Invalid article ID or the article does not exist"
+// @Router /article/:article_id [patch]
+func editArticle(c *gin.Context) {
+	a, ok := getExistingArticle(c, "article_id")
+	if !ok {
+		return
+	}
+	if !ensureCanModify(c, a.Author) {
+		return
+	}
+
+	var update articleUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+	if fields := update.validate(); len(fields) != 0 {
+		abortWithFieldErrors(c, "Invalid article", fields)
+		return
+	}
+
+	edited, err := updateArticle(a.ID, update, getCurrentUser(c).Username)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, edited)
+}
+
+// @Summary Delete an article with its comments, only the author and moderators can. Moderators can restore it until it is purged
+// @Produce json
+// @Param article_id path int true "The id of the article"
+// @Success 200 {string} string "Success"
+// @Failure 403 {object} apiError "Only the author or a moderator can delete the article"
+// @Failure 404 {object} apiError "Invalid article ID or the article does not exist"
+// @Router /article/:article_id [delete]
+func deleteArticle(c *gin.Context) {
+	a, ok := getExistingArticle(c, "article_id")
+	if !ok {
+		return
+	}
+	if !ensureCanModify(c, a.Author) {
+		return
+	}
+
+	if err := softDeleteArticle(a.ID, getCurrentUser(c).Username); err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
+
+// @Summary List the previous versions of an article, the latest first. Only the author and moderators can, since an edit may remove text on purpose
+// @Produce json
+// @Param article_id path int true "The id of the article"
+// @Success 200 {array} articleRevision "The previous titles and contents"
+// @Failure 403 {object} apiError "Only the author or a moderator can read the history"
+// @Failure 404 {object} apiError "Invalid article ID or the article does not exist"
+// @Router /article/:article_id/history [get]
+func getArticleHistory(c *gin.Context) {
+	a, ok := getExistingArticle(c, "article_id")
+	if !ok {
+		return
+	}
+	if !ensureCanModify(c, a.Author) {
+		return
+	}
+
+	revisions, err := getArticleRevisions(a.ID)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
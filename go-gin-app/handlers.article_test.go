@@ -53,7 +53,7 @@ func TestShowIndexPageAuthenticated(t *testing.T) {
 	r := getRouter(true)
 
 	// Set the token cookie to simulate an authenticated user
-	http.SetCookie(w, &http.Cookie{Name: "token", Value: "%7B%22username%22%3A%22user1%22%2C%22password%22%3A%22pass1%22%7D"})
+	http.SetCookie(w, getSessionCookie(t, "user1"))
 
 	// Define the route similar to its definition in the routes file
 	r.GET("/", showIndexPage)
@@ -118,7 +118,7 @@ func TestArticleAuthenticated(t *testing.T) {
 	r := getRouter(true)
 
 	// Set the token cookie to simulate an authenticated user
-	http.SetCookie(w, &http.Cookie{Name: "token", Value: "%7B%22username%22%3A%22user1%22%2C%22password%22%3A%22pass1%22%7D"})
+	http.SetCookie(w, getSessionCookie(t, "user1"))
 
 	// Define the route similar to its definition in the routes file
 	r.GET("/article/view/:article_id", getArticle)
@@ -206,6 +206,27 @@ func TestArticleXML(t *testing.T) {
 	})
 }
 
+// Test that a GET request to a missing or deleted article returns 404
+func TestArticleMissing(t *testing.T) {
+	r := getRouter(true)
+	r.GET("/article/view/:article_id", getArticle)
+
+	result, err := DB.Exec("INSERT INTO articles (author, title, content, deleted_at) VALUES ('user1', 'Gone', 'Gone', CURRENT_TIMESTAMP)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, _ := result.LastInsertId()
+	defer DB.Exec("DELETE FROM articles WHERE id = ?", deleted)
+
+	for _, id := range []string{"999999", strconv.FormatInt(deleted, 10)} {
+		req, _ := http.NewRequest("GET", "/article/view/"+id, nil)
+		req.Header.Add("Accept", "application/json")
+		testHTTPResponse(t, r, req, func(w *httptest.ResponseRecorder) bool {
+			return w.Code == http.StatusNotFound
+		})
+	}
+}
+
 // Test that a GET request to the article creation page returns the
 // article creation page with the HTTP code 200 for an authenticated user
 func TestArticleCreationPageAuthenticated(t *testing.T) {
@@ -216,7 +237,7 @@ func TestArticleCreationPageAuthenticated(t *testing.T) {
 	r := getRouter(true)
 
 	// Set the token cookie to simulate an authenticated user
-	http.SetCookie(w, &http.Cookie{Name: "token", Value: "%7B%22username%22%3A%22user1%22%2C%22password%22%3A%22pass1%22%7D"})
+	http.SetCookie(w, getSessionCookie(t, "user1"))
 
 	// Define the route similar to its definition in the routes file
 	r.GET("/article/create", ensureLoggedIn(), showArticleCreationPage)
@@ -270,7 +291,7 @@ func TestArticleCreationAuthenticated(t *testing.T) {
 	r := getRouter(true)
 
 	// Set the token cookie to simulate an authenticated user
-	http.SetCookie(w, &http.Cookie{Name: "token", Value: "%7B%22username%22%3A%22user1%22%2C%22password%22%3A%22pass1%22%7D"})
+	http.SetCookie(w, getSessionCookie(t, "user1"))
 
 	// Define the route similar to its definition in the routes file
 	r.POST("/article/create", ensureLoggedIn(), createArticle)
@@ -329,6 +350,24 @@ func TestArticleCreationUnauthenticated(t *testing.T) {
 	})
 }
 
+// Test that an article needs a title and content that aren't blank
+func TestArticleCreationRejectsBlankFields(t *testing.T) {
+	r := getRouter(true)
+	r.POST("/article/create", ensureLoggedIn(), createArticle)
+
+	for _, payload := range []string{`{"title": "", "content": "Text"}`, `{"title": "   ", "content": "Text"}`, `{"title": "Blank", "content": " \n "}`, `{}`} {
+		req, _ := http.NewRequest("POST", "/article/create", strings.NewReader(payload))
+		req.Header.Add("Content-Type", "application/json")
+		req.AddCookie(getSessionCookie(t, "user1"))
+		testHTTPResponse(t, r, req, func(w *httptest.ResponseRecorder) bool {
+			return w.Code == http.StatusBadRequest
+		})
+	}
+	if n, _ := deleteArticleByTitle("Blank"); n != 0 {
+		t.Error("an article without content was created")
+	}
+}
+
 func getArticlePOSTPayload() string {
 	//params := url.Values{}
 	//params.Add("author", "Test Article Author")
@@ -343,3 +382,113 @@ func getArticlePOSTPayload() string {
 	}`
 	return testArticle
 }
+
+// Test editing an article, its history, and deleting it with its comments
+func TestEditAndDeleteArticle(t *testing.T) {
+	if _, err := createNewArticle(article{Title: "Editable", Content: "First version"}, "user_mj"); err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	DB.QueryRow("SELECT MAX(id) FROM articles WHERE title = 'Editable'").Scan(&id)
+	defer deleteArticleById(id)
+	path := "/article/" + strconv.Itoa(id)
+
+	r := getAppRouter()
+	send := func(method string, path string, payload string, username string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(getSessionCookie(t, username))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("PATCH", path, `{"title": "Stolen"}`, "user2"); w.Code != http.StatusForbidden {
+		t.Errorf("another user edited the article: %d", w.Code)
+	}
+	if w := send("PATCH", path, `{"title": " "}`, "user_mj"); w.Code != http.StatusBadRequest {
+		t.Errorf("an empty title was accepted: %d", w.Code)
+	}
+	if w := send("PATCH", path, `{}`, "user_mj"); w.Code != http.StatusBadRequest {
+		t.Errorf("an empty update was accepted: %d", w.Code)
+	}
+	if w := send("PATCH", "/article/100000", `{"title": "Missing"}`, "user_mj"); w.Code != http.StatusNotFound {
+		t.Errorf("got %d for a missing article", w.Code)
+	}
+
+	w := send("PATCH", path, `{"content": "Second version"}`, "user_mj")
+	var edited article
+	if err := json.Unmarshal(w.Body.Bytes(), &edited); w.Code != http.StatusOK || err != nil || edited.Title != "Editable" || edited.Content != "Second version" {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	send("PATCH", path, `{"title": "Edited", "content": "Third version"}`, "user_mj")
+
+	// The history may hold text the author removed on purpose
+	if w := send("GET", path+"/history", "", "user2"); w.Code != http.StatusForbidden {
+		t.Errorf("another user read the history: %d %s", w.Code, w.Body)
+	}
+	setUserRole("user3", roleModerator)
+	if w := send("GET", path+"/history", "", "user3"); w.Code != http.StatusOK {
+		t.Errorf("a moderator got %d for the history", w.Code)
+	}
+	setUserRole("user3", roleUser)
+	w = send("GET", path+"/history", "", "user_mj")
+	var history []articleRevision
+	if err := json.Unmarshal(w.Body.Bytes(), &history); w.Code != http.StatusOK || err != nil || len(history) != 2 {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if history[0].Content != "Second version" || history[1].Title != "Editable" || history[1].Content != "First version" || history[0].EditedBy != "user_mj" {
+		t.Errorf("got history %+v", history)
+	}
+
+	// The comments of the article are deleted with it
+	createNewComment(comment{ArticleId: id, CommentAuthor: "user2", Content: "Nice"})
+	changeArticleStatus("user2", id, reactionLike)
+
+	if w := send("DELETE", path, "", "user2"); w.Code != http.StatusForbidden {
+		t.Errorf("another user deleted the article: %d", w.Code)
+	}
+	if w := send("DELETE", path, "", "user_mj"); w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+
+	var left int
+	DB.QueryRow(`SELECT (SELECT COUNT(*) FROM articles WHERE id = ?1 AND deleted_at IS NULL)
+		+ (SELECT COUNT(*) FROM comment WHERE topic_id = ?1 AND deleted_at IS NULL)`, id).Scan(&left)
+	if left != 0 {
+		t.Errorf("%d rows of the article are not deleted", left)
+	}
+	if w := send("GET", path+"/history", "", "user_mj"); w.Code != http.StatusNotFound {
+		t.Errorf("got %d for the history of a deleted article", w.Code)
+	}
+}
+
+// Test the parameters of the article list
+func TestListArticles(t *testing.T) {
+	r := getAppRouter()
+	get := func(query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/article/list?"+query, nil)
+		req.AddCookie(getSessionCookie(t, "user1"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, query := range []string{"sort=oldest", "limit=0", "limit=101", "limit=ten", "cursor=abc", "sort=liked&cursor=" + feedCursor{Sort: "hot", ID: 1}.encode()} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", query, w.Code)
+		}
+	}
+
+	w := get("sort=liked&limit=2")
+	var page articlePage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); w.Code != http.StatusOK || err != nil || len(page.Articles) != 2 || page.NextCursor == "" {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	// The sort mode is kept in the cursor
+	w = get("cursor=" + page.NextCursor)
+	var next articlePage
+	if err := json.Unmarshal(w.Body.Bytes(), &next); w.Code != http.StatusOK || err != nil || len(next.Articles) == 0 || next.Articles[0].Likes > page.Articles[1].Likes {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+}
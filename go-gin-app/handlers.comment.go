@@ -1,79 +1,331 @@
 package main
 
 import (
-	"encoding/json"
+	"database/sql"
 	"fmt"
-	"github.com/gin-gonic/gin"
-	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
 )
 
+// @Summary List the comments of an article as threads of replies
+// @Produce json
+// @Param article_id path int true "The id of the article"
+// @Param parent query int false "List the replies of this comment instead of the top-level comments"
+// @Param order query string false "time (default), the oldest first, or score, the most liked first"
+// @Param max_depth query int false "How many levels of replies to include, 1 to 10, 5 by default"
+// @Param limit query int false "How many comments to list, and replies to include under each, 1 to 100, 50 by default"
+// @Param offset query int false "The nextOffset of the previous response, omit it for the first page"
+// @Success 200 {object} commentThreadPage "The comments with their replies"
+// @Failure 400 {object} apiError "validation_failed"
+// @Failure 404 {object} apiError "Invalid article ID, the article or the parent comment does not exist"
+// @Router /article/comment_view/:article_id [get]
 func getComment(c *gin.Context) {
-	if articleId := c.Param("article_id"); articleId != "" {
-		if allComments, err := getAllComment(articleId); err == nil {
-
-			render(c, gin.H{
-				"title":   "Comments",
-				"payload": allComments}, "comment.html")
-			//c.JSON(http.StatusOK, status)
-		} else {
-			// if there was an error while creating the article, abort with an error
-			//c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			c.AbortWithError(http.StatusBadRequest, err)
+	articleId, ok := getExistingArticleId(c, "article_id")
+	if !ok {
+		return
+	}
+
+	problems := map[string]string{}
+	opts := threadOptions{
+		Viewer:   getCurrentUser(c).Username,
+		Order:    c.DefaultQuery("order", "time"),
+		MaxDepth: defaultThreadDepth,
+		Limit:    defaultThreadLimit,
+	}
+	if opts.Order != "time" && opts.Order != "score" {
+		problems["order"] = "must be time or score"
+	}
+	for name, field := range map[string]struct {
+		value    *int
+		min, max int
+	}{
+		"max_depth": {&opts.MaxDepth, 1, maxThreadDepth},
+		"limit":     {&opts.Limit, 1, maxThreadLimit},
+		"offset":    {&opts.Offset, 0, math.MaxInt32},
+	} {
+		raw, ok := c.GetQuery(name)
+		if !ok {
+			continue
 		}
-	} else {
-		c.AbortWithStatus(http.StatusNotFound)
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < field.min || n > field.max {
+			problems[name] = fmt.Sprintf("must be a number from %d to %d", field.min, field.max)
+		}
+		*field.value = n
+	}
+	if raw, ok := c.GetQuery("parent"); ok {
+		parentId, err := strconv.Atoi(raw)
+		if err != nil {
+			problems["parent"] = "must be a comment ID"
+		}
+		opts.ParentId = &parentId
 	}
+	if len(problems) > 0 {
+		abortWithFieldErrors(c, "Invalid comment list", problems)
+		return
+	}
+
+	page, err := getCommentThread(articleId, opts)
+	if err == errInvalidParent {
+		abortWithAPIError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+
+	render(c, gin.H{
+		"title":   "Comments",
+		"payload": page}, "comment.html")
+	//c.JSON(http.StatusOK, status)
 }
 
 func createComment(c *gin.Context) {
 	var commentData comment
 
-	if err := c.BindJSON(&commentData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		fmt.Println(err)
-		return
-	}
-
-	validationErr := validate.Struct(commentData)
-	if validationErr != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": validationErr})
-		fmt.Println(validationErr)
-		return
-	}
-
-	var tempuser mingleUser
-	token, _ := c.Cookie("token")
-	if err := json.Unmarshal([]byte(token), &tempuser); err == nil {
-		if articleId, errA := strconv.Atoi(c.Param("article_id")); errA == nil {
-			commentData.CommentAuthor = tempuser.Username
-			commentData.ArticleId = articleId
-			if num, err := createNewComment(commentData, tempuser); num != 0 && err == nil {
-				// If the article is created successfully, show success message
-				render(c, gin.H{
-					"title":   "Comment Submitted!",
-					"payload": num}, "submission-successful.html")
-				//c.JSON(http.StatusOK, status)
-			} else {
-				// if there was an error while creating the article, abort with an error
-				//c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				c.AbortWithError(http.StatusBadRequest, err)
-			}
-		} else {
-			c.AbortWithError(http.StatusNotFound, errA)
-		}
-	} else {
-		c.AbortWithError(http.StatusUnauthorized, err)
+	if err := c.ShouldBindJSON(&commentData); err != nil {
+		abortWithInvalidBody(c, err)
+		return
 	}
+
+	if err := validate.Struct(commentData); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+	if strings.TrimSpace(commentData.Content) == "" {
+		abortWithFieldErrors(c, "Invalid comment", map[string]string{"content": "can't be empty"})
+		return
+	}
+
+	articleId, ok := getExistingArticleId(c, "article_id")
+	if !ok {
+		return
+	}
+
+	tempuser := getCurrentUser(c)
+	commentData.CommentAuthor = tempuser.Username
+	commentData.ArticleId = articleId
+	num, err := createNewComment(commentData)
+	if err == errInvalidParent {
+		abortWithFieldErrors(c, "Invalid comment", map[string]string{"parentId": err.Error()})
+		return
+	}
+	if err != nil {
+		// if there was an error while creating the comment, abort with an error
+		abortWithInternalError(c, err)
+		return
+	}
+	if num == 0 {
+		abortWithAPIError(c, http.StatusBadRequest, "The comment could not be created")
+		return
+	}
+
+	// If the comment is created successfully, show success message
+	render(c, gin.H{
+		"title":   "Comment Submitted!",
+		"payload": num}, "submission-successful.html")
+	//c.JSON(http.StatusOK, status)
 }
 
 func getCommentByUsername(c *gin.Context) {
 	username := c.Param("username")
+	if exist, err := isUserExist(username); err != nil {
+		abortWithInternalError(c, err)
+		return
+	} else if !exist {
+		abortWithAPIError(c, http.StatusNotFound, "The user does not exist")
+		return
+	}
 	commentList, err := getCommentsByUser(username)
 	if err != nil {
-		c.AbortWithError(http.StatusBadRequest, err)
-		log.Fatal(err)
+		abortWithInternalError(c, err)
+		return
 	}
 	c.JSON(http.StatusOK, commentList)
 }
+
+// The new content of a comment
+type commentUpdate struct {
+	Content string `json:"content"`
+}
+
+// @Summary Edit the content of a comment. Its author can until the edit window of the server is over, moderators always can
+// @Accept json
+// @Produce json
+// @Param comment_id path int true "The id of the comment"
+// @Param comment body commentUpdate true "The new content"
+// @Success 200 {object} comment "The edited comment, with the time of the edit"
+// @Failure 400 {object} apiError "validation_failed, with the reason on the content field"
+// @Failure 403 {object} apiError "Only the author or a moderator can edit the comment, or the edit window is over"
+// @Failure 404 {object} apiError "Invalid comment ID or the comment does not exist"
+// @Router /comment/:comment_id [patch]
+func editComment(c *gin.Context) {
+	cm, ok := getExistingComment(c, "comment_id")
+	if !ok {
+		return
+	}
+	if !ensureCanModify(c, cm.CommentAuthor) {
+		return
+	}
+
+	var update commentUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+	if strings.TrimSpace(update.Content) == "" {
+		abortWithFieldErrors(c, "Invalid comment", map[string]string{"content": "can't be empty"})
+		return
+	}
+
+	// Moderators can fix a comment at any time
+	var postedSince time.Time
+	if window := appConfig.commentEditWindow(); window > 0 && !hasRole(getCurrentUser(c).Role, roleModerator) {
+		postedSince = time.Now().Add(-window)
+	}
+
+	edited, err := updateComment(cm.CommentId, update.Content, postedSince)
+	if err == errEditWindowClosed {
+		abortWithAPIError(c, http.StatusForbidden, err.Error())
+		return
+	}
+	if err == sql.ErrNoRows {
+		abortWithAPIError(c, http.StatusNotFound, "The comment does not exist")
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, edited)
+}
+
+// @Summary Delete a comment, only the author and moderators can. Its replies stay, under a [deleted] placeholder
+// @Produce json
+// @Param comment_id path int true "The id of the comment"
+// @Success 200 {string} string "Success"
+// @Failure 403 {object} apiError "Only the author or a moderator can delete the comment"
+// @Failure 404 {object} apiError "Invalid comment ID or the comment does not exist"
+// @Router /comment/:comment_id [delete]
+func deleteComment(c *gin.Context) {
+	cm, ok := getExistingComment(c, "comment_id")
+	if !ok {
+		return
+	}
+	if !ensureCanModify(c, cm.CommentAuthor) {
+		return
+	}
+
+	err := softDeleteComment(cm.CommentId, getCurrentUser(c).Username)
+	if err == sql.ErrNoRows {
+		abortWithAPIError(c, http.StatusNotFound, "The comment does not exist")
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
+
+// @Summary See how the user reacts to a comment.
+// @Produce json
+// @Param commentId path int true "The id of the comment"
+// @Success 200 {int} int "0: no reaction; 1: thumbs up; 2: thumbs down"
+// @Failure 404 {object} apiError "Invalid comment ID or the comment does not exist"
+// @Router /u/comment/:commentId [get]
+func checkCommentReaction(c *gin.Context) {
+	commentId, ok := getExistingCommentId(c, "commentId")
+	if !ok {
+		return
+	}
+	status, err := getReaction(getCurrentUser(c).Username, "comment", commentId)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// @Summary Like or dislike a comment, replacing the previous reaction of the user.
+// @Accept json
+// @Produce json
+// @Param commentId path int true "The id of the comment"
+// @Param thumbsup body string true "0, dislike; 1, like" SchemaExample(Subject: thumbsup\r\n\r\n1\r\n)
+// @Success 200 {object} map[string]interface{} "The new numbers of likes and dislikes of the comment"
+// @Failure 400 {object} apiError "Invalid request body"
+// @Failure 404 {object} apiError "Invalid comment ID or the comment does not exist"
+// @Router /u/comment/:commentId [patch]
+func changeCommentReaction(c *gin.Context) {
+	commentId, ok := getExistingCommentId(c, "commentId")
+	if !ok {
+		return
+	}
+	status, ok := bindReaction(c)
+	if !ok {
+		return
+	}
+	respondWithCommentReaction(c, commentId, status)
+}
+
+// @Summary Clear the reaction of the user to a comment.
+// @Produce json
+// @Param commentId path int true "The id of the comment"
+// @Success 200 {object} map[string]interface{} "The new numbers of likes and dislikes of the comment"
+// @Failure 404 {object} apiError "Invalid comment ID or the comment does not exist"
+// @Router /u/comment/:commentId [delete]
+func clearCommentReaction(c *gin.Context) {
+	commentId, ok := getExistingCommentId(c, "commentId")
+	if !ok {
+		return
+	}
+	respondWithCommentReaction(c, commentId, reactionNone)
+}
+
+// Store the reaction and answer with the new counts of the comment
+func respondWithCommentReaction(c *gin.Context, commentId int, status int) {
+	likes, dislikes, err := setReaction(getCurrentUser(c).Username, "comment", commentId, status)
+	if err == sql.ErrNoRows {
+		abortWithAPIError(c, http.StatusNotFound, "The comment does not exist")
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Success", "likes": likes, "dislikes": dislikes})
+}
+
+// Parse the comment ID in the path and make sure the comment exists.
+// Aborts with 404 and returns false otherwise
+func getExistingCommentId(c *gin.Context, param string) (int, bool) {
+	cm, ok := getExistingComment(c, param)
+	return cm.CommentId, ok
+}
+
+// Like getExistingCommentId, returning the whole comment
+func getExistingComment(c *gin.Context, param string) (comment, bool) {
+	commentId, err := strconv.Atoi(c.Param(param))
+	if err != nil {
+		abortWithAPIError(c, http.StatusNotFound, "Invalid comment ID")
+		return comment{}, false
+	}
+	cm, err := getCommentByID(commentId)
+	if err == sql.ErrNoRows {
+		abortWithAPIError(c, http.StatusNotFound, "The comment does not exist")
+		return comment{}, false
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return comment{}, false
+	}
+	return cm, true
+}
@@ -15,7 +15,7 @@ import (
 func TestGetCommentAuthenticated(t *testing.T) {
 	w := httptest.NewRecorder()
 	r := getRouter(true)
-	http.SetCookie(w, &http.Cookie{Name: "token", Value: "123"})
+	http.SetCookie(w, getSessionCookie(t, "user1"))
 	r.GET("/article/comment_view/:article_id", ensureLoggedIn(), getComment)
 
 	req, _ := http.NewRequest("GET", "/article/comment_view/1", nil)
@@ -65,7 +65,7 @@ func TestCreateCommentAuthenticated(t *testing.T) {
 	//fmt.Println(string(jsonStr))
 	//fmt.Println(err)
 
-	http.SetCookie(w, &http.Cookie{Name: "token", Value: "%7B%22username%22%3A%22user1%22%2C%22password%22%3A%22pass1%22%7D"})
+	http.SetCookie(w, getSessionCookie(t, "user1"))
 	r.POST("/article/comment/:article_id", ensureLoggedIn(), createComment)
 
 	commentPayload := getCommentPOSTPayload()
@@ -89,7 +89,7 @@ func TestCreateCommentAuthenticated(t *testing.T) {
 	}
 
 	//delete the valid comment after test
-	commentList, _ := getAllComment("2")
+	commentList, _ := getAllComment(2)
 	validCommentId := commentList[len(commentList)-1].CommentId
 	num, err := deleteCommentByCommentId(validCommentId)
 	if num == 0 {
@@ -113,3 +113,175 @@ func getCommentPOSTPayload() string {
 	jsonStr, _ := json.Marshal(validComment)
 	return string(jsonStr)
 }
+
+// Test that a comment or a reply needs content that isn't blank
+func TestCreateCommentRejectsBlankContent(t *testing.T) {
+	r := getAppRouter()
+	parent := addTestComment(t, 2, "user3", "Reply to me", nil)
+	defer deleteCommentByCommentId(parent)
+
+	var before int
+	DB.QueryRow("SELECT COUNT(*) FROM comment").Scan(&before)
+	for _, payload := range []string{`{"content": ""}`, `{"content": " \t\n "}`, fmt.Sprintf(`{"content": "  ", "parentId": %d}`, parent)} {
+		req, _ := http.NewRequest("POST", "/article/comment/2", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(getSessionCookie(t, "user2"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"content"`) {
+			t.Errorf("%s: got %d %s", payload, w.Code, w.Body)
+		}
+	}
+	var after int
+	DB.QueryRow("SELECT COUNT(*) FROM comment").Scan(&after)
+	if after != before {
+		t.Errorf("%d blank comments were stored", after-before)
+	}
+}
+
+// Test replying through the API and the parameters of the thread
+func TestReplyAndThreadParameters(t *testing.T) {
+	r := getAppRouter()
+	send := func(method string, path string, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(getSessionCookie(t, "user2"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	parent := addTestComment(t, 2, "user3", "Reply to me", nil)
+	defer deleteCommentByCommentId(parent)
+
+	if w := send("POST", "/article/comment/1", fmt.Sprintf(`{"content": "Wrong article", "parentId": %d}`, parent)); w.Code != http.StatusBadRequest {
+		t.Errorf("replied across articles: %d %s", w.Code, w.Body)
+	}
+	if w := send("POST", "/article/comment/2", fmt.Sprintf(`{"content": "Here you go", "parentId": %d}`, parent)); w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	var reply int
+	DB.QueryRow("SELECT comment_id FROM comment WHERE parent_comment_id = ?", parent).Scan(&reply)
+	defer deleteCommentByCommentId(reply)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/article/comment_view/2?parent=%d", parent), nil)
+	req.Header.Set("Accept", "application/json")
+	req.AddCookie(getSessionCookie(t, "user2"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var page commentThreadPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || len(page.Comments) != 1 || page.Comments[0].CommentId != reply || page.Comments[0].Depth != 1 {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+
+	for _, query := range []string{"order=new", "max_depth=0", "max_depth=11", "limit=0", "offset=-1", "parent=x"} {
+		if w := send("GET", "/article/comment_view/2?"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", query, w.Code)
+		}
+	}
+	if w := send("GET", "/article/comment_view/2?parent=999999", ""); w.Code != http.StatusNotFound {
+		t.Errorf("got %d for a missing parent", w.Code)
+	}
+}
+
+// Test the reaction routes of comments
+func TestCommentReactionRoutes(t *testing.T) {
+	r := getAppRouter()
+	commentId := addTestComment(t, 2, "user3", "Like me", nil)
+	defer deleteCommentByCommentId(commentId)
+	path := fmt.Sprintf("/u/comment/%d", commentId)
+
+	send := func(method string, path string, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(getSessionCookie(t, "user2"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("PATCH", path, `{"thumbsup": 1}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"likes":1`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	// Liking twice still counts one like
+	if w := send("PATCH", path, `{"thumbsup": 1}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"likes":1`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("GET", path, ""); w.Code != http.StatusOK || w.Body.String() != "1" {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("PATCH", path, `{"thumbsup": 3}`); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d for an invalid reaction", w.Code)
+	}
+	if w := send("DELETE", path, ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"likes":0`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("PATCH", "/u/comment/999999", `{"thumbsup": 1}`); w.Code != http.StatusNotFound {
+		t.Errorf("got %d for a missing comment", w.Code)
+	}
+}
+
+// Test that authors edit their comments within the edit window, moderators
+// at any time, and that deleting a comment keeps its replies
+func TestEditAndDeleteComment(t *testing.T) {
+	r := getAppRouter()
+	commentId := addTestComment(t, 2, "user3", "Frist", nil)
+	defer deleteCommentByCommentId(commentId)
+	replyId := addTestComment(t, 2, "user2", "Typo", &commentId)
+	defer deleteCommentByCommentId(replyId)
+	path := fmt.Sprintf("/comment/%d", commentId)
+
+	setUserRole("user_rl", roleModerator)
+	defer setUserRole("user_rl", roleUser)
+
+	send := func(method string, path string, payload string, username string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		req.AddCookie(getSessionCookie(t, username))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("PATCH", path, `{"content": "Mine now"}`, "user2"); w.Code != http.StatusForbidden {
+		t.Errorf("another user edited the comment: %d", w.Code)
+	}
+	if w := send("PATCH", path, `{"content": " "}`, "user3"); w.Code != http.StatusBadRequest {
+		t.Errorf("an empty comment was accepted: %d", w.Code)
+	}
+	if w := send("PATCH", "/comment/999999", `{"content": "Missing"}`, "user3"); w.Code != http.StatusNotFound {
+		t.Errorf("got %d for a missing comment", w.Code)
+	}
+
+	w := send("PATCH", path, `{"content": "First"}`, "user3")
+	var edited comment
+	if err := json.Unmarshal(w.Body.Bytes(), &edited); w.Code != http.StatusOK || err != nil || edited.Content != "First" || edited.EditedAt == nil {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+
+	// Once the window is over, only moderators can edit
+	DB.Exec("UPDATE comment SET comment_time = datetime('now', '-1 hour') WHERE comment_id = ?", commentId)
+	if w := send("PATCH", path, `{"content": "Too late"}`, "user3"); w.Code != http.StatusForbidden {
+		t.Errorf("edited after the window: %d", w.Code)
+	}
+	if w := send("PATCH", path, `{"content": "Moderated"}`, "user_rl"); w.Code != http.StatusOK {
+		t.Errorf("a moderator could not edit: %d %s", w.Code, w.Body)
+	}
+
+	if w := send("DELETE", path, "", "user2"); w.Code != http.StatusForbidden {
+		t.Errorf("another user deleted the comment: %d", w.Code)
+	}
+	if w := send("DELETE", path, "", "user3"); w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("PATCH", path, `{"content": "Back"}`, "user3"); w.Code != http.StatusNotFound {
+		t.Errorf("got %d for a deleted comment", w.Code)
+	}
+
+	// The reply is still listed, under a placeholder
+	w = send("GET", "/article/comment_view/2", "", "user2")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"content":"[deleted]"`) || !strings.Contains(w.Body.String(), `"content":"Typo"`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,91 @@
+// handlers.discover.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary List profiles to show interest in or pass on, filtered by the discover preferences. The order is shuffled once a day for each user, and the fields hidden from the user are omitted
+// @Produce json
+// @Param limit query int false "The number of profiles per page, 1 to 50, 20 by default"
+// @Param cursor query string false "The nextCursor of the previous response, omit it for the first page"
+// @Success 200 {object} candidatePage "The profiles and the cursor of the next page"
+// @Failure 400 {object} apiError "validation_failed"
+// @Router /u/discover [get]
+func discoverProfiles(c *gin.Context) {
+	problems := map[string]string{}
+
+	limit := defaultDiscoverLimit
+	if raw, ok := c.GetQuery("limit"); ok {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxDiscoverLimit {
+			problems["limit"] = fmt.Sprintf("must be a number from 1 to %d", maxDiscoverLimit)
+		}
+		limit = n
+	}
+
+	var cursor *discoverCursor
+	if raw := c.Query("cursor"); raw != "" {
+		cur, err := decodeDiscoverCursor(raw)
+		if err != nil {
+			problems["cursor"] = err.Error()
+		} else {
+			cursor = &cur
+		}
+	}
+
+	if len(problems) > 0 {
+		abortWithFieldErrors(c, "Invalid discover request", problems)
+		return
+	}
+
+	page, err := getDiscoverStack(getCurrentUser(c).Username, cursor, limit)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// @Summary Get who the user wants to see in the discover stack
+// @Produce json
+// @Success 200 {object} discoverPreferences "The preferences, the defaults if the user never set them"
+// @Router /u/discover/preferences [get]
+func getDiscoverSettings(c *gin.Context) {
+	prefs, err := getDiscoverPreferences(getCurrentUser(c).Username)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+// @Summary Replace the discover preferences. The fields left out take their default values
+// @Accept json
+// @Produce json
+// @Param preferences body discoverPreferences true "interestedIn: male, female or everyone; minAge and maxAge from 18 to 99; major and gradYear null for any"
+// @Success 200 {object} discoverPreferences "The preferences after the change"
+// @Failure 400 {object} apiError "validation_failed, with the reason on each invalid field"
+// @Router /u/discover/preferences [put]
+func updateDiscoverSettings(c *gin.Context) {
+	prefs := defaultDiscoverPreferences
+	if err := c.ShouldBindJSON(&prefs); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+	if problems := prefs.validate(); len(problems) > 0 {
+		abortWithFieldErrors(c, "Invalid discover preferences", problems)
+		return
+	}
+
+	if err := setDiscoverPreferences(getCurrentUser(c).Username, prefs); err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	getDiscoverSettings(c)
+}
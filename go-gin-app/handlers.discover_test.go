@@ -0,0 +1,87 @@
+// handlers.discover_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Test the discover routes: the preferences, the stack and its cursor
+func TestDiscoverRoutes(t *testing.T) {
+	defer registerDiscoverUsers(t)()
+	r := getAppRouter()
+	send := func(method string, path string, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(getSessionCookie(t, "discoViewer"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("GET", "/u/discover/preferences", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"interestedIn":"everyone"`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("PUT", "/u/discover/preferences", `{"interestedIn": "robots", "minAge": 40, "maxAge": 30}`); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "interestedIn") || !strings.Contains(w.Body.String(), "maxAge") {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	// The fields left out take their defaults
+	w := send("PUT", "/u/discover/preferences", `{"interestedIn": "female", "major": "Discovery Studies"}`)
+	var prefs discoverPreferences
+	if err := json.Unmarshal(w.Body.Bytes(), &prefs); w.Code != http.StatusOK || err != nil || prefs.MinAge != minDiscoverAge || prefs.MaxAge != maxDiscoverAge {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+
+	w = send("GET", "/u/discover?limit=1", "")
+	var page candidatePage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); w.Code != http.StatusOK || err != nil || len(page.Candidates) != 1 || page.NextCursor == "" {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	seen := page.Candidates[0].Username
+	w = send("GET", "/u/discover?limit=1&cursor="+page.NextCursor, "")
+	page = candidatePage{}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); w.Code != http.StatusOK || err != nil || len(page.Candidates) != 1 || page.Candidates[0].Username == seen || page.NextCursor != "" {
+		t.Errorf("got %d %s after %s", w.Code, w.Body, seen)
+	}
+	if strings.Contains(w.Body.String(), "password") || strings.Contains(w.Body.String(), "@ufl.edu") {
+		t.Errorf("the profile leaked private fields: %s", w.Body)
+	}
+
+	for _, query := range []string{"limit=0", "limit=51", "limit=x", "cursor=x"} {
+		if w := send("GET", "/u/discover?"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", query, w.Code)
+		}
+	}
+}
+
+// Test editing the major and graduation year through PATCH /u/info
+func TestUpdateMajorAndGradYear(t *testing.T) {
+	defer registerDiscoverUsers(t)()
+	r := getAppRouter()
+	send := func(method string, path string, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(getSessionCookie(t, "discoA"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("PATCH", "/u/info", `{"major": "Botany", "grad_year": 2027}`); w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if u, err := getUserByUsername("discoA"); err != nil || u.Major == nil || *u.Major != "Botany" || u.GradYear == nil || *u.GradYear != 2027 {
+		t.Errorf("got %+v, %v", u, err)
+	}
+	if w := send("PATCH", "/u/info", `{"major": "", "grad_year": null}`); w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if u, err := getUserByUsername("discoA"); err != nil || u.Major != nil || u.GradYear != nil {
+		t.Errorf("got %+v, %v", u, err)
+	}
+}
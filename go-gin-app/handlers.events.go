@@ -0,0 +1,62 @@
+// handlers.events.go
+
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Stream new articles, comments on the articles and comments of the user, reaction counts and messages as Server-Sent Events
+// @Description Each event has the type article, comment, reaction or message and JSON data. A comment line is sent when the stream is idle. The stream ends when the connection falls behind, the client should then reconnect and fetch what it missed. It also ends once the session is logged out or revoked
+// @Produce text/event-stream
+// @Success 200 {string} string "The event stream"
+// @Failure 401 {object} apiError "Not logged in"
+// @Router /events [get]
+func streamEvents(c *gin.Context) {
+	current := getCurrentUser(c)
+	sub := events.subscribe(current.Username)
+	defer events.unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	// Tell nginx not to buffer the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case e, ok := <-sub.ch:
+			if !ok || !isSessionActive(current.SessionID) {
+				return
+			}
+			c.SSEvent(e.Type, e.Data)
+		case <-heartbeat.C:
+			if !isSessionActive(current.SessionID) {
+				return
+			}
+			if _, err := c.Writer.WriteString(": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+// Check that the session of a stream is still valid, so that the events stop
+// after a logout, a password reset or the deletion of the account
+func isSessionActive(id string) bool {
+	_, err := getActiveSession(id)
+	if err != nil && err != errInvalidSession {
+		log.Println(err)
+	}
+	return err == nil
+}
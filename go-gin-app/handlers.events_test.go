@@ -0,0 +1,125 @@
+// handlers.events_test.go
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that the event stream needs a session, sends heartbeats and pushes
+// the events of the user
+func TestStreamEvents(t *testing.T) {
+	defer func(d time.Duration) { eventHeartbeat = d }(eventHeartbeat)
+	eventHeartbeat = 50 * time.Millisecond
+
+	server := httptest.NewServer(getAppRouter())
+	defer server.Close()
+
+	if resp, err := http.Get(server.URL + "/events"); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got %v without a session", err)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/events", nil)
+	req.AddCookie(getSessionCookie(t, "user1"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	// Wait for a line starting with prefix, and return it
+	expect := func(prefix string) string {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatalf("the stream ended before %q", prefix)
+				}
+				if strings.HasPrefix(line, prefix) {
+					return line
+				}
+			case <-timeout:
+				t.Fatalf("no %q in the stream", prefix)
+			}
+		}
+	}
+
+	expect(": heartbeat")
+
+	// A comment of someone else on an article of user1
+	commentId := addTestComment(t, 1, "user2", "Live comment", nil)
+	defer deleteCommentByCommentId(commentId)
+	defer DB.Exec("DELETE FROM notifications WHERE comment_id = ?", commentId)
+	expect("event:comment")
+	if line := expect("data:"); !strings.Contains(line, `"content":"Live comment"`) {
+		t.Errorf("got %s", line)
+	}
+
+	// A comment of user3 on the article of user_rl isn't for user1
+	other := addTestComment(t, 3, "user3", "Not for user1", nil)
+	defer deleteCommentByCommentId(other)
+	defer DB.Exec("DELETE FROM notifications WHERE comment_id = ?", other)
+
+	if _, _, err := changeArticleStatus("user2", 2, reactionDislike); err != nil {
+		t.Fatal(err)
+	}
+	defer changeArticleStatus("user2", 2, reactionNone)
+	// The next event is the reaction
+	if line := expect("event:"); line != "event:reaction" {
+		t.Errorf("got %s", line)
+	}
+	if line := expect("data:"); line != `data:{"articleId":2,"likes":0,"dislikes":1}` {
+		t.Errorf("got %s", line)
+	}
+}
+
+// Test that the stream ends once its session is logged out
+func TestStreamEventsEndsAfterLogout(t *testing.T) {
+	defer func(d time.Duration) { eventHeartbeat = d }(eventHeartbeat)
+	eventHeartbeat = 50 * time.Millisecond
+
+	server := httptest.NewServer(getAppRouter())
+	defer server.Close()
+
+	cookie := getSessionCookie(t, "user1")
+	req, _ := http.NewRequest("GET", server.URL+"/events", nil)
+	req.AddCookie(cookie)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if err := revokeSession(cookie.Value); err != nil {
+		t.Fatal(err)
+	}
+	ended := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, resp.Body)
+		close(ended)
+	}()
+	select {
+	case <-ended:
+	case <-time.After(5 * time.Second):
+		t.Error("the stream went on after the logout")
+	}
+}
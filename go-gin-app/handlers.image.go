@@ -3,10 +3,11 @@ package main
 import (
 	"errors"
 	"github.com/gin-gonic/gin"
-	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 )
 
@@ -14,62 +15,69 @@ import (
 // @Produce json
 // @Param username path string true "username"
 // @Success 200 {file} file "An avatar is returned"
-// @Failure 404 {error} error "Error"
+// @Failure 404 {object} apiError "Error"
+// @Failure 500 {object} apiError "Server internal error"
 // @Router /image/avatar/:username [get]
 func getAvatar(c *gin.Context) {
 	username := c.Param("username")
-	if username == "" {
-		c.AbortWithStatus(http.StatusNotFound)
-		return
-	}
-	if res, err := isUserExist(username); err == nil && res == true {
-		//fmt.Println("./Avatar/" + username + ".jpg")
-		_, errF := os.Stat("./Avatar/" + username + ".jpg")
-		//fmt.Println(fileInfo)
-		if errF == nil {
-			c.File("./Avatar/" + username + ".jpg")
-		} else {
-			log.Println(errF)
-			c.File("./Avatar/test.jpg")
-		}
+	if res, err := isUserExist(username); err != nil {
+		abortWithInternalError(c, err)
+		return
+	} else if username == "" || !res {
+		abortWithAPIError(c, http.StatusNotFound, "The user does not exist")
+		return
+	}
+
+	//fmt.Println("./Avatar/" + username + ".jpg")
+	_, errF := os.Stat(filepath.Join(appConfig.AvatarDir, username+".jpg"))
+	//fmt.Println(fileInfo)
+	if errF == nil {
+		c.File(filepath.Join(appConfig.AvatarDir, username+".jpg"))
 	} else {
-		c.AbortWithError(http.StatusNotFound, err)
+		c.File(filepath.Join(appConfig.AvatarDir, "test.jpg"))
 	}
-	return
 }
 
 // @Summary Upload the avatar of the user, the name of the file should be "avatar".
 // @Produce json
 // @Param username path string true "username"
 // @Success 200 {file} file "An avatar is uploaded"
-// @Failure 400 {error} error "Bad request"
-// @Failure 500 {error} error "Internal server error"
+// @Failure 400 {object} apiError "Bad request"
+// @Failure 403 {object} apiError "Only the user and moderators can change the avatar"
+// @Failure 500 {object} apiError "Internal server error"
 // @Router /image/avatar/:username [post]
 func uploadAvatar(c *gin.Context) {
 	username := c.Param("username")
-	if flag, err := isUserExist(username); flag == false || err != nil {
-		log.Println(err)
-		c.AbortWithError(http.StatusBadRequest, errors.New("user does not exist"))
+	if !ensureCanModify(c, username) {
+		return
+	}
+	if flag, err := isUserExist(username); err != nil {
+		abortWithInternalError(c, err)
+		return
+	} else if !flag {
+		abortWithAPIError(c, http.StatusBadRequest, "The user does not exist")
+		return
 	}
 
 	file, err := c.FormFile("avatar")
 	if err != nil {
-		log.Println(err)
-		c.AbortWithError(http.StatusBadRequest, err)
+		abortWithFieldErrors(c, "Invalid upload", map[string]string{"avatar": err.Error()})
+		return
 	}
 
 	//The file must be in jpg format
 	fileExt := strings.ToLower(path.Ext(file.Filename))
 	if fileExt != ".jpg" {
-		c.AbortWithError(http.StatusBadRequest, errors.New("the file must be in jpg format"))
+		abortWithFieldErrors(c, "Invalid upload", map[string]string{"avatar": "the file must be in jpg format"})
+		return
 	}
 
-	filePath := path.Join("./Avatar", username+fileExt)
+	filePath := filepath.Join(appConfig.AvatarDir, username+fileExt)
 
 	err = c.SaveUploadedFile(file, filePath)
 	if err != nil {
-		log.Println(err)
-		c.AbortWithError(http.StatusInternalServerError, err)
+		abortWithInternalError(c, err)
+		return
 	}
 
 	//只在第一次上传时修改数据库
@@ -77,38 +85,39 @@ func uploadAvatar(c *gin.Context) {
 	//经测试同名文件直接覆盖
 	stmt, err := DB.Prepare("SELECT profile_photo FROM users WHERE username=?")
 	if err != nil {
-		log.Println(err)
-		c.AbortWithError(http.StatusInternalServerError, err)
+		abortWithInternalError(c, err)
+		return
 	}
 	defer stmt.Close()
 
 	var avatarName string
 	sqlErr := stmt.QueryRow(username).Scan(&avatarName)
 	if sqlErr != nil {
-		log.Println(sqlErr)
-		c.AbortWithError(http.StatusInternalServerError, sqlErr)
+		abortWithInternalError(c, sqlErr)
+		return
 	}
 
 	//update database
 	if avatarName == "test.jpg" {
 		stmtAva, err := DB.Prepare("UPDATE users SET profile_photo=? WHERE username=?")
 		if err != nil {
-			log.Println(err)
-			c.AbortWithError(http.StatusInternalServerError, err)
+			abortWithInternalError(c, err)
+			return
 		}
+		defer stmtAva.Close()
 		resAva, errStmt := stmtAva.Exec(username+fileExt, username)
 		if errStmt != nil {
-			log.Println(errStmt)
-			c.AbortWithError(http.StatusInternalServerError, errStmt)
+			abortWithInternalError(c, errStmt)
+			return
 		}
 		affect, errRes := resAva.RowsAffected()
 		if errRes != nil {
-			log.Println(errRes)
-			c.AbortWithError(http.StatusInternalServerError, errRes)
+			abortWithInternalError(c, errRes)
+			return
 		}
 		if affect != 1 {
-			log.Println("Error in uploadAvatar")
-			c.AbortWithError(http.StatusInternalServerError, errors.New("error in uploadAvatar"))
+			abortWithInternalError(c, errors.New("error in uploadAvatar"))
+			return
 		}
 	}
 
@@ -143,72 +152,168 @@ type returnData struct {
 	URL  string `json:"url"`
 	Alt  string `json:"alt"`
 	Href string `json:"href"`
+	// The name the image is stored under, to attach it to a message or a
+	// gallery
+	Filename string `json:"filename"`
 }
 
-// @Summary Upload images inserted by users in posts or replies
+// @Summary Upload images inserted by users in posts or replies. Each image is stored under a new random name, returned with its download address
 // @Produce json
-// @Success 200 {map} map "errno: 0, data: A list of download addresses of images"
-// @Failure 400 {error} error "Error"
+// @Success 200 {map} map "errno: 0, data: A list of download addresses and file names of images"
+// @Failure 400 {object} apiError "validation_failed: a file is not a JPEG, PNG, GIF or WebP image"
 // @Router /image/upload [post]
 func uploadImages(c *gin.Context) {
-	form, _ := c.MultipartForm()
-	//fmt.Println(form)
-	//files := form.File["file[]"]
+	form, err := c.MultipartForm()
+	if err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
 	filesMap := form.File
-	//fmt.Println("form.File[\"file[]\"]: ", form.File["file[]"])
-	//fmt.Println("form.File: ", form.File)
 
+	// Nothing is stored unless every file is an image
+	problems := map[string]string{}
+	for field, files := range filesMap {
+		if err := checkImageUpload(files[0]); err == errUnsupportedImage {
+			problems[field] = err.Error()
+		} else if err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+	}
+	if len(problems) != 0 {
+		abortWithFieldErrors(c, "Invalid image", problems)
+		return
+	}
+
+	tempuser := getCurrentUser(c)
 	imgResult := make([]returnData, 0)
 	for _, files := range filesMap {
 		file := files[0]
-		if err := c.SaveUploadedFile(file, "./image/"+file.Filename); err != nil {
-			log.Println(err)
-			c.AbortWithError(http.StatusBadRequest, err)
+		filename, err := generateImageFilename(file.Filename)
+		if err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+
+		if err := c.SaveUploadedFile(file, filepath.Join(appConfig.ImageDir, filename)); err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+		if err := setImageOwner(filename, tempuser.Username); err != nil {
+			abortWithInternalError(c, err)
+			return
 		}
-		tmpData := returnData{URL: "http://localhost:8080/image/download/" + file.Filename}
+		tmpData := returnData{URL: imageURL(filename), Alt: filepath.Base(file.Filename), Filename: filename}
 		imgResult = append(imgResult, tmpData)
 	}
-	//c.String(http.StatusOK, fmt.Sprintf("%d files uploaded!", len(files)))
 	c.JSON(http.StatusOK, gin.H{"errno": 0,
 		"data": imgResult})
 }
 
-// @Summary Retrieve images inserted in the posts or replies
+// The address an uploaded image is downloaded from
+func imageURL(filename string) string {
+	return appConfig.PublicBaseURL + "/image/download/" + url.PathEscape(filename)
+}
+
+// @Summary Retrieve an image inserted in a post or reply, sent in a conversation of the user, uploaded by the user, or in a gallery the user may see
 // @Produce jpeg
 // @Param filename path string true "Image filename"
 // @Success 200 {file} file "Success"
-// @Failure 400 {error} error "Failure"
+// @Failure 400 {object} apiError "Invalid file name"
+// @Failure 404 {object} apiError "The image does not exist or the user may not see it"
 // @Router /image/download/:filename [get]
 func downloadImage(c *gin.Context) {
 	filename := c.Param("filename")
-	_, errF := os.Stat("./Image/" + filename)
-	if errF == nil {
-		c.File("./Image/" + filename)
-	} else {
-		c.AbortWithError(http.StatusBadRequest, errF)
-		log.Println("err at 84", errF)
+	if !isPlainFilename(filename) {
+		abortWithAPIError(c, http.StatusBadRequest, "Invalid file name")
+		return
+	}
+	if _, errF := os.Stat(filepath.Join(appConfig.ImageDir, filename)); errF != nil {
+		abortWithAPIError(c, http.StatusNotFound, "The image does not exist")
+		return
 	}
-	return
+
+	// Images the user may not see are answered like missing ones
+	current := getCurrentUser(c)
+	allowed := hasRole(current.Role, roleModerator)
+	if !allowed {
+		var err error
+		if allowed, err = canViewImage(current.Username, filename); err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+	}
+	if !allowed {
+		abortWithAPIError(c, http.StatusNotFound, "The image does not exist")
+		return
+	}
+
+	// Files uploaded before the types were checked may be anything, so
+	// browsers must not render them as pages
+	c.Header("X-Content-Type-Options", "nosniff")
+	if imageTypes[strings.ToLower(filepath.Ext(filename))] == "" {
+		c.Header("Content-Disposition", "attachment")
+	}
+	c.File(filepath.Join(appConfig.ImageDir, filename))
 }
 
-// @Summary Delete an image file
+// @Summary Delete an image file, only the user who uploaded it and moderators can
 // @Produce json
 // @Param filename path string true "Filename of the image"
 // @Success 200 {map} map "Success"
-// @Failure 400 {error} error "Failure"
+// @Failure 400 {object} apiError "Invalid file name"
+// @Failure 403 {object} apiError "Only the owner or a moderator can delete the image"
+// @Failure 404 {object} apiError "The image does not exist"
+// @Failure 500 {object} apiError "Failure"
 // @Router /image/delete/:filename [delete]
 func deleteImage(c *gin.Context) {
 	filename := c.Param("filename")
-	_, errF := os.Stat("./Image/" + filename)
-	if errF == nil {
-		if err := os.Remove("./Image/" + filename); err != nil {
-			c.AbortWithError(http.StatusBadRequest, err)
-			log.Println("err at 94", err)
-		} else {
-			c.JSON(http.StatusOK, gin.H{"message": "Success"})
-		}
-	} else {
-		c.AbortWithError(http.StatusBadRequest, errF)
-		log.Fatal("err at 99", errF)
+	if !isPlainFilename(filename) {
+		abortWithAPIError(c, http.StatusBadRequest, "Invalid file name")
+		return
+	}
+	if _, errF := os.Stat(filepath.Join(appConfig.ImageDir, filename)); errF != nil {
+		abortWithAPIError(c, http.StatusNotFound, "The image does not exist")
+		return
 	}
+
+	owner, err := getImageOwner(filename)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	if !ensureCanModify(c, owner) {
+		return
+	}
+
+	if err := os.Remove(filepath.Join(appConfig.ImageDir, filename)); err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	if err := deleteImageOwner(filename); err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Success"})
+}
+
+// Return whether a file of the image directory was uploaded by the user
+func isOwnImage(username string, filename string) (bool, error) {
+	if !isPlainFilename(filename) {
+		return false, nil
+	}
+	owner, err := getImageOwner(filename)
+	if err != nil {
+		return false, err
+	}
+	if _, errF := os.Stat(filepath.Join(appConfig.ImageDir, filename)); errF != nil {
+		return false, nil
+	}
+	return owner == username, nil
+}
+
+// Only accept a bare file name, so that a path parameter can't reach
+// outside of the image directory
+func isPlainFilename(filename string) bool {
+	return filename != "" && filename != "." && filename != ".." && filepath.Base(filename) == filename && !strings.ContainsAny(filename, `/\`)
 }
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 )
 
 func TestGetAvatar(t *testing.T) {
 	w := httptest.NewRecorder()
 	r := getRouter(true)
-	http.SetCookie(w, &http.Cookie{Name: "token", Value: "%7B%22username%22%3A%22user1%22%2C%22password%22%3A%22pass1%22%7D"})
+	http.SetCookie(w, getSessionCookie(t, "user1"))
 	r.GET("/avatar/:username", ensureLoggedIn(), getAvatar)
 	req, _ := http.NewRequest("GET", "/avatar/user1", nil)
 	req.Header = http.Header{"Cookie": w.Result().Header["Set-Cookie"]}
@@ -18,3 +25,259 @@ func TestGetAvatar(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// Test that uploaded images are stored in the configured directory under a
+// random name and linked through the public base URL
+func TestUploadImages(t *testing.T) {
+	original := appConfig
+	defer func() { appConfig = original }()
+	appConfig.ImageDir = t.TempDir()
+	appConfig.PublicBaseURL = "https://api.example.com"
+
+	r := getRouter(true)
+	r.POST("/image/upload", ensureLoggedIn(), uploadImages)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, getUploadRequest(t, "/image/upload", "file", "photo 1.JPG", "user1"))
+
+	var body struct {
+		Data []returnData `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); w.Code != http.StatusOK || err != nil || len(body.Data) != 1 {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	uploaded := body.Data[0]
+	defer deleteImageOwner(uploaded.Filename)
+	if !regexp.MustCompile(`^[0-9a-f]{32}\.jpg$`).MatchString(uploaded.Filename) || uploaded.Alt != "photo 1.JPG" ||
+		uploaded.URL != "https://api.example.com/image/download/"+uploaded.Filename {
+		t.Errorf("got %+v", uploaded)
+	}
+	if _, err := os.Stat(filepath.Join(appConfig.ImageDir, uploaded.Filename)); err != nil {
+		t.Error(err)
+	}
+}
+
+// The first bytes of a JPEG file
+var testJPEG = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+
+// Build a multipart request uploading a JPEG file under the field name
+func getUploadRequest(t *testing.T, path string, field string, filename string, username string) *http.Request {
+	return getUploadRequestWithContent(t, path, field, filename, testJPEG, username)
+}
+
+// Build a multipart request uploading one file with this content
+func getUploadRequestWithContent(t *testing.T, path string, field string, filename string, content []byte, username string) *http.Request {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile(field, filename)
+	part.Write(content)
+	form.Close()
+
+	req, _ := http.NewRequest("POST", path, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.AddCookie(getSessionCookie(t, username))
+	return req
+}
+
+// Test that only JPEG, PNG, GIF and WebP images are accepted, whatever the
+// name of the file says
+func TestUploadRejectsNonImages(t *testing.T) {
+	original := appConfig
+	defer func() { appConfig = original }()
+	appConfig.ImageDir = t.TempDir()
+
+	r := getRouter(true)
+	r.POST("/image/upload", ensureLoggedIn(), uploadImages)
+	for _, upload := range []struct {
+		filename string
+		content  []byte
+	}{
+		{"page.html", []byte("<html><script>alert(1)</script></html>")},
+		{"drawing.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`)},
+		{"page.jpg", []byte("<html><script>alert(1)</script></html>")},
+		{"photo.png", testJPEG},
+		{"noextension", testJPEG},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, getUploadRequestWithContent(t, "/image/upload", "file", upload.filename, upload.content, "user1"))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"file"`) {
+			t.Errorf("%s: got %d %s", upload.filename, w.Code, w.Body)
+		}
+	}
+	if stored, _ := os.ReadDir(appConfig.ImageDir); len(stored) != 0 {
+		t.Errorf("%d files were stored", len(stored))
+	}
+}
+
+// Upload an image through the router and return the name it is stored under
+func uploadTestImage(t *testing.T, r http.Handler, username string) string {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, getUploadRequest(t, "/image/upload", "file", "owned.jpg", username))
+	var body struct {
+		Data []returnData `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); w.Code != http.StatusOK || err != nil || len(body.Data) != 1 {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	return body.Data[0].Filename
+}
+
+// Test that only the owner of an image or a moderator can delete it, and
+// that uploads with the same name never replace each other
+func TestImageOwnership(t *testing.T) {
+	original := appConfig
+	defer func() { appConfig = original }()
+	appConfig.ImageDir = t.TempDir()
+
+	r := getRouter(true)
+	r.POST("/image/upload", ensureLoggedIn(), uploadImages)
+	r.DELETE("/image/delete/:filename", ensureLoggedIn(), deleteImage)
+
+	expectCode := func(req *http.Request, code int) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != code {
+			t.Errorf("%s %s: got %d %s, want %d", req.Method, req.URL, w.Code, w.Body, code)
+		}
+	}
+	deleteRequest := func(filename string, username string) *http.Request {
+		req, _ := http.NewRequest("DELETE", "/image/delete/"+filename, nil)
+		req.AddCookie(getSessionCookie(t, username))
+		return req
+	}
+
+	first := uploadTestImage(t, r, "user1")
+	defer deleteImageOwner(first)
+	second := uploadTestImage(t, r, "user2")
+	defer deleteImageOwner(second)
+	if first == second {
+		t.Fatal("two uploads got the same name")
+	}
+	expectCode(deleteRequest(first, "user2"), http.StatusForbidden)
+	expectCode(deleteRequest(first, "user1"), http.StatusOK)
+
+	// A moderator can delete the image of someone else, or one without owner
+	setUserRole("user3", roleModerator)
+	defer setUserRole("user3", roleUser)
+	expectCode(deleteRequest(second, "user3"), http.StatusOK)
+
+	os.WriteFile(filepath.Join(appConfig.ImageDir, "legacy.jpg"), []byte("jpg"), 0644)
+	expectCode(deleteRequest("legacy.jpg", "user1"), http.StatusForbidden)
+	expectCode(deleteRequest("legacy.jpg", "user3"), http.StatusOK)
+}
+
+// Test that an image is only served to its owner, the members of the
+// conversations it was sent in and moderators, until a post shows it, and
+// that a gallery image follows the visibility of the photos
+func TestDownloadImageAccess(t *testing.T) {
+	original := appConfig
+	defer func() { appConfig = original }()
+	appConfig.ImageDir = t.TempDir()
+	defer deleteTestConversation("user1", "user2")
+
+	r := getAppRouter()
+	filename := uploadTestImage(t, r, "user1")
+	defer deleteImageOwner(filename)
+	download := func(username string) int {
+		req, _ := http.NewRequest("GET", "/image/download/"+filename, nil)
+		req.AddCookie(getSessionCookie(t, username))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := download("user1"); code != http.StatusOK {
+		t.Errorf("the owner got %d", code)
+	}
+
+	// A file from before the types were checked is never rendered
+	os.WriteFile(filepath.Join(appConfig.ImageDir, "legacy.html"), []byte("<script>alert(1)</script>"), 0644)
+	setImageOwner("legacy.html", "user1")
+	defer deleteImageOwner("legacy.html")
+	for name, disposition := range map[string]string{filename: "", "legacy.html": "attachment"} {
+		req, _ := http.NewRequest("GET", "/image/download/"+name, nil)
+		req.AddCookie(getSessionCookie(t, "user1"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Header().Get("X-Content-Type-Options") != "nosniff" || w.Header().Get("Content-Disposition") != disposition {
+			t.Errorf("%s: got %d %v", name, w.Code, w.Header())
+		}
+	}
+	if code := download("user2"); code != http.StatusNotFound {
+		t.Errorf("another user got %d", code)
+	}
+
+	conv, err := startConversation("user1", "user2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sendMessage(conv.ID, "user1", "look", filename); err != nil {
+		t.Fatal(err)
+	}
+	if code := download("user2"); code != http.StatusOK {
+		t.Errorf("the other member of the conversation got %d", code)
+	}
+	if code := download("user3"); code != http.StatusNotFound {
+		t.Errorf("a user outside the conversation got %d", code)
+	}
+	setUserRole("user3", roleModerator)
+	if code := download("user3"); code != http.StatusOK {
+		t.Errorf("a moderator got %d", code)
+	}
+	setUserRole("user3", roleUser)
+
+	// Once in an article, everyone can see it
+	result, err := DB.Exec("INSERT INTO articles (author, title, content) VALUES ('user1', 'Pictures', ?)", `<img src="`+imageURL(filename)+`">`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	articleId, _ := result.LastInsertId()
+	defer DB.Exec("DELETE FROM articles WHERE id = ?", articleId)
+	if code := download("user3"); code != http.StatusOK {
+		t.Errorf("got %d for an image of an article", code)
+	}
+
+	// A gallery image is served to whoever may see the photos of the profile
+	photo := uploadTestImage(t, r, "user1")
+	defer deleteImageOwner(photo)
+	photos := []string{photo}
+	if err := updateUserProfile("user1", profileUpdate{Photos: &photos}); err != nil {
+		t.Fatal(err)
+	}
+	defer setProfileVisibility("user1", map[string]string{"photos": visibilityPublic})
+	filename = photo
+	if code := download("user2"); code != http.StatusOK {
+		t.Errorf("got %d for a public gallery", code)
+	}
+	setProfileVisibility("user1", map[string]string{"photos": visibilityMatches})
+	if code := download("user2"); code != http.StatusNotFound {
+		t.Errorf("got %d for a gallery for matches only", code)
+	}
+	setProfileVisibility("user1", map[string]string{"photos": visibilityPublic})
+	blockUser("user1", "user2")
+	defer unblockUser("user1", "user2")
+	if code := download("user2"); code != http.StatusNotFound {
+		t.Errorf("a blocked user got %d for a gallery image", code)
+	}
+}
+
+// Test that a user can only change their own avatar
+func TestUploadAvatarOwnership(t *testing.T) {
+	original := appConfig
+	defer func() { appConfig = original }()
+	appConfig.AvatarDir = t.TempDir()
+
+	r := getRouter(true)
+	r.POST("/image/avatar/:username", ensureLoggedIn(), uploadAvatar)
+
+	testHTTPResponse(t, r, getUploadRequest(t, "/image/avatar/user1", "avatar", "me.jpg", "user2"), func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusForbidden
+	})
+	if _, err := os.Stat(filepath.Join(appConfig.AvatarDir, "user1.jpg")); err == nil {
+		t.Error("the avatar of another user was replaced")
+	}
+
+	testHTTPResponse(t, r, getUploadRequest(t, "/image/avatar/user2", "avatar", "me.jpg", "user2"), func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusOK
+	})
+}
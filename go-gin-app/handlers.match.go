@@ -0,0 +1,96 @@
+// handlers.match.go
+
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Show interest in a user. They only learn about it if they are interested too, which makes a match
+// @Produce json
+// @Param username path string true "The user"
+// @Success 200 {object} map[string]bool "matched: whether the users are matched now"
+// @Failure 400 {object} apiError "You can't rate your own profile"
+// @Failure 403 {object} apiError "One of the users blocked the other"
+// @Failure 404 {object} apiError "The user does not exist"
+// @Failure 500 {object} apiError "Server internal error"
+// @Router /u/interest/:username [post]
+func showInterest(c *gin.Context) {
+	respondWithInterest(c, true)
+}
+
+// @Summary Pass on a user, undoing the match with them if any
+// @Produce json
+// @Param username path string true "The user"
+// @Success 200 {object} map[string]bool "matched: false"
+// @Failure 400 {object} apiError "You can't rate your own profile"
+// @Failure 403 {object} apiError "One of the users blocked the other"
+// @Failure 404 {object} apiError "The user does not exist"
+// @Failure 500 {object} apiError "Server internal error"
+// @Router /u/pass/:username [post]
+func passOnSomeone(c *gin.Context) {
+	respondWithInterest(c, false)
+}
+
+// Record the interest or pass and answer whether the users are matched
+func respondWithInterest(c *gin.Context, interested bool) {
+	target := c.Param("username")
+	if exist, err := isUserExist(target); err != nil {
+		abortWithInternalError(c, err)
+		return
+	} else if !exist {
+		abortWithAPIError(c, http.StatusNotFound, "The user does not exist")
+		return
+	}
+	username := getCurrentUser(c).Username
+	if target == username {
+		abortWithAPIError(c, http.StatusBadRequest, "You can't rate your own profile")
+		return
+	}
+
+	matched, err := setInterest(username, target, interested)
+	if err == errBlocked {
+		abortWithAPIError(c, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"matched": matched})
+}
+
+// @Summary List the users the user matched with, the newest first
+// @Produce json
+// @Success 200 {array} match "The matches"
+// @Router /u/matches [get]
+func getMyMatches(c *gin.Context) {
+	list, err := getMatches(getCurrentUser(c).Username)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Undo a match. The user's interest turns into a pass, so the match isn't made again
+// @Produce json
+// @Param username path string true "The matched user"
+// @Success 200 {object} map[string]interface{} "Success"
+// @Failure 404 {object} apiError "The users aren't matched"
+// @Router /u/matches/:username [delete]
+func deleteMatch(c *gin.Context) {
+	err := unmatch(getCurrentUser(c).Username, c.Param("username"))
+	if err == sql.ErrNoRows {
+		abortWithAPIError(c, http.StatusNotFound, "You aren't matched with this user")
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
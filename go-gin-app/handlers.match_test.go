@@ -0,0 +1,49 @@
+// handlers.match_test.go
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Test the interest and match routes
+func TestMatchRoutes(t *testing.T) {
+	defer deleteTestMatch("user2", "user_rl")
+
+	r := getAppRouter()
+	send := func(method string, path string, username string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		req.AddCookie(getSessionCookie(t, username))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("POST", "/u/interest/nobody", "user2"); w.Code != http.StatusNotFound {
+		t.Errorf("got %d for a missing user", w.Code)
+	}
+	if w := send("POST", "/u/interest/user2", "user2"); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d for oneself", w.Code)
+	}
+	if w := send("POST", "/u/interest/user_rl", "user2"); w.Code != http.StatusOK || w.Body.String() != `{"matched":false}` {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("POST", "/u/interest/user2", "user_rl"); w.Code != http.StatusOK || w.Body.String() != `{"matched":true}` {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("GET", "/u/matches", "user2"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"username":"user_rl"`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("DELETE", "/u/matches/user_rl", "user2"); w.Code != http.StatusOK {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("DELETE", "/u/matches/user_rl", "user2"); w.Code != http.StatusNotFound {
+		t.Errorf("got %d after the unmatch", w.Code)
+	}
+	if w := send("POST", "/u/pass/user2", "user_rl"); w.Code != http.StatusOK || w.Body.String() != `{"matched":false}` {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+}
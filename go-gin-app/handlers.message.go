@@ -0,0 +1,289 @@
+// handlers.message.go
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The user to start a conversation with
+type conversationStart struct {
+	Username string `json:"username"`
+}
+
+// A message to send. Image is the name of a file the sender uploaded with
+// /image/upload
+type messageDraft struct {
+	Content string `json:"content"`
+	Image   string `json:"image"`
+}
+
+// @Summary List the conversations of the user with their last message and unread count, the most recently active first
+// @Produce json
+// @Success 200 {array} conversation "The conversations"
+// @Router /conversations [get]
+func listConversations(c *gin.Context) {
+	list, err := getConversations(getCurrentUser(c).Username)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Start a conversation with a user, or return the one the user already has with them
+// @Accept json
+// @Produce json
+// @Param user body conversationStart true "The username of the other user"
+// @Success 200 {object} conversation "The conversation"
+// @Failure 400 {object} apiError "validation_failed"
+// @Failure 403 {object} apiError "One of the users blocked the other"
+// @Failure 404 {object} apiError "The user does not exist"
+// @Failure 500 {object} apiError "Server internal error"
+// @Router /conversations [post]
+func createConversation(c *gin.Context) {
+	var body conversationStart
+	if err := c.ShouldBindJSON(&body); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+	if exist, err := isUserExist(body.Username); err != nil {
+		abortWithInternalError(c, err)
+		return
+	} else if !exist {
+		abortWithAPIError(c, http.StatusNotFound, "The user does not exist")
+		return
+	}
+
+	conv, err := startConversation(getCurrentUser(c).Username, body.Username)
+	if err == errSelfConversation {
+		abortWithFieldErrors(c, "Invalid conversation", map[string]string{"username": err.Error()})
+		return
+	}
+	if err == errBlocked {
+		abortWithAPIError(c, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, conv)
+}
+
+// @Summary Page through the messages of a conversation, the newest first
+// @Produce json
+// @Param conversation_id path int true "The id of the conversation"
+// @Param limit query int false "The number of messages per page, 1 to 100, 50 by default"
+// @Param before query int false "The nextBefore of the previous response, omit it for the first page"
+// @Success 200 {object} messagePage "The messages"
+// @Failure 400 {object} apiError "validation_failed"
+// @Failure 404 {object} apiError "Invalid conversation ID or the user isn't in the conversation"
+// @Router /conversations/:conversation_id/messages [get]
+func listMessages(c *gin.Context) {
+	conv, ok := getOwnConversation(c, "conversation_id")
+	if !ok {
+		return
+	}
+
+	problems := map[string]string{}
+	limit := defaultMessageLimit
+	if raw, ok := c.GetQuery("limit"); ok {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxMessageLimit {
+			problems["limit"] = fmt.Sprintf("must be a number from 1 to %d", maxMessageLimit)
+		}
+		limit = n
+	}
+	before := 0
+	if raw, ok := c.GetQuery("before"); ok {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			problems["before"] = "must be a message ID"
+		}
+		before = n
+	}
+	if len(problems) > 0 {
+		abortWithFieldErrors(c, "Invalid message list", problems)
+		return
+	}
+
+	page, err := getMessages(conv.ID, before, limit)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// @Summary Send a message with text, an image uploaded with /image/upload, or both
+// @Accept json
+// @Produce json
+// @Param conversation_id path int true "The id of the conversation"
+// @Param message body messageDraft true "The text and/or the file name of the image"
+// @Success 200 {object} message "The message sent"
+// @Failure 400 {object} apiError "validation_failed, with the reason on the content or image field"
+// @Failure 403 {object} apiError "One of the users blocked the other"
+// @Failure 404 {object} apiError "Invalid conversation ID or the user isn't in the conversation"
+// @Router /conversations/:conversation_id/messages [post]
+func postMessage(c *gin.Context) {
+	conv, ok := getOwnConversation(c, "conversation_id")
+	if !ok {
+		return
+	}
+
+	var draft messageDraft
+	if err := c.ShouldBindJSON(&draft); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+	username := getCurrentUser(c).Username
+	problems := map[string]string{}
+	if strings.TrimSpace(draft.Content) == "" && draft.Image == "" {
+		problems["content"] = "is required without an image"
+	}
+	if len(draft.Content) > maxMessageLength {
+		problems["content"] = fmt.Sprintf("must be at most %d characters", maxMessageLength)
+	}
+	if draft.Image != "" {
+		// Only the images the sender uploaded can be attached
+		own, err := isOwnImage(username, draft.Image)
+		if err != nil {
+			abortWithInternalError(c, err)
+			return
+		}
+		if !own {
+			problems["image"] = "must be an image you uploaded"
+		}
+	}
+	if len(problems) > 0 {
+		abortWithFieldErrors(c, "Invalid message", problems)
+		return
+	}
+
+	m, err := sendMessage(conv.ID, username, draft.Content, draft.Image)
+	if err == errBlocked {
+		abortWithAPIError(c, http.StatusForbidden, err.Error())
+		return
+	}
+	if err == sql.ErrNoRows {
+		abortWithAPIError(c, http.StatusNotFound, "The conversation does not exist")
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// @Summary Mark every message of a conversation as read
+// @Produce json
+// @Param conversation_id path int true "The id of the conversation"
+// @Success 200 {object} conversation "The conversation, with no unread message"
+// @Failure 404 {object} apiError "Invalid conversation ID or the user isn't in the conversation"
+// @Router /conversations/:conversation_id/read [post]
+func readConversation(c *gin.Context) {
+	conv, ok := getOwnConversation(c, "conversation_id")
+	if !ok {
+		return
+	}
+	username := getCurrentUser(c).Username
+	if err := markConversationRead(conv.ID, username); err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	conv, err := getConversation(conv.ID, username)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, conv)
+}
+
+// Parse the conversation ID in the path and make sure the user is in the
+// conversation. Aborts with 404 and returns false otherwise
+func getOwnConversation(c *gin.Context, param string) (conversation, bool) {
+	id, err := strconv.Atoi(c.Param(param))
+	if err != nil {
+		abortWithAPIError(c, http.StatusNotFound, "Invalid conversation ID")
+		return conversation{}, false
+	}
+	conv, err := getConversation(id, getCurrentUser(c).Username)
+	if err == sql.ErrNoRows {
+		abortWithAPIError(c, http.StatusNotFound, "The conversation does not exist")
+		return conversation{}, false
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return conversation{}, false
+	}
+	return conv, true
+}
+
+// @Summary Block a user, neither of them can message the other until the user is unblocked. Their match and ratings of each other are removed
+// @Produce json
+// @Param username path string true "The user to block"
+// @Success 200 {object} map[string]interface{} "Success"
+// @Failure 400 {object} apiError "You can't block yourself"
+// @Failure 404 {object} apiError "The user does not exist"
+// @Failure 500 {object} apiError "Server internal error"
+// @Router /u/block/:username [post]
+func blockSomeone(c *gin.Context) {
+	username := c.Param("username")
+	if exist, err := isUserExist(username); err != nil {
+		abortWithInternalError(c, err)
+		return
+	} else if !exist {
+		abortWithAPIError(c, http.StatusNotFound, "The user does not exist")
+		return
+	}
+	current := getCurrentUser(c).Username
+	if username == current {
+		abortWithAPIError(c, http.StatusBadRequest, "You can't block yourself")
+		return
+	}
+	if err := blockUser(current, username); err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
+
+// @Summary Unblock a user
+// @Produce json
+// @Param username path string true "The user to unblock"
+// @Success 200 {object} map[string]interface{} "Success"
+// @Failure 404 {object} apiError "The user isn't blocked"
+// @Router /u/block/:username [delete]
+func unblockSomeone(c *gin.Context) {
+	err := unblockUser(getCurrentUser(c).Username, c.Param("username"))
+	if err == sql.ErrNoRows {
+		abortWithAPIError(c, http.StatusNotFound, "The user isn't blocked")
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
+
+// @Summary List the users the user blocked, the most recent first
+// @Produce json
+// @Success 200 {array} string "The usernames"
+// @Router /u/blocks [get]
+func getMyBlocks(c *gin.Context) {
+	list, err := getBlockedUsers(getCurrentUser(c).Username)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
@@ -0,0 +1,105 @@
+// handlers.message_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test messaging through the API, with an image attachment and a block
+func TestMessageRoutes(t *testing.T) {
+	defer deleteTestConversation("user2", "user_rl")
+	defer DB.Exec("DELETE FROM blocks WHERE blocker = 'user_rl'")
+
+	original := appConfig
+	defer func() { appConfig = original }()
+	appConfig.ImageDir = t.TempDir()
+	appConfig.PublicBaseURL = "https://api.example.com"
+	os.WriteFile(filepath.Join(appConfig.ImageDir, "mine.jpg"), []byte("jpg"), 0600)
+	setImageOwner("mine.jpg", "user2")
+	defer deleteImageOwner("mine.jpg")
+	os.WriteFile(filepath.Join(appConfig.ImageDir, "theirs.jpg"), []byte("jpg"), 0600)
+	setImageOwner("theirs.jpg", "user_rl")
+	defer deleteImageOwner("theirs.jpg")
+
+	r := getAppRouter()
+	send := func(method string, path string, payload string, username string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(getSessionCookie(t, username))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("POST", "/conversations", `{"username": "nobody"}`, "user2"); w.Code != http.StatusNotFound {
+		t.Errorf("got %d for a missing user", w.Code)
+	}
+	if w := send("POST", "/conversations", `{"username": "user2"}`, "user2"); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d for a conversation with oneself", w.Code)
+	}
+	w := send("POST", "/conversations", `{"username": "user_rl"}`, "user2")
+	var conv conversation
+	if err := json.Unmarshal(w.Body.Bytes(), &conv); w.Code != http.StatusOK || err != nil || conv.With != "user_rl" {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	path := fmt.Sprintf("/conversations/%d", conv.ID)
+
+	w = send("POST", path+"/messages", `{"content": "look", "image": "mine.jpg"}`, "user2")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"imageUrl":"https://api.example.com/image/download/mine.jpg"`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	for _, payload := range []string{`{"content": " "}`, `{"image": "theirs.jpg"}`, `{"image": "missing.jpg"}`, `{"image": "../UFMingle.db"}`} {
+		if w := send("POST", path+"/messages", payload, "user2"); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", payload, w.Code)
+		}
+	}
+	if w := send("POST", path+"/messages", `{"content": "hello"}`, "user1"); w.Code != http.StatusNotFound {
+		t.Errorf("a user outside the conversation sent a message: %d", w.Code)
+	}
+	if w := send("GET", path+"/messages", "", "user1"); w.Code != http.StatusNotFound {
+		t.Errorf("a user outside the conversation read it: %d", w.Code)
+	}
+
+	w = send("GET", "/conversations", "", "user_rl")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"unread":1`) || !strings.Contains(w.Body.String(), `"content":"look"`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("GET", path+"/messages?limit=1", "", "user_rl"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"sender":"user2"`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	for _, query := range []string{"limit=0", "limit=101", "before=x"} {
+		if w := send("GET", path+"/messages?"+query, "", "user_rl"); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", query, w.Code)
+		}
+	}
+	if w := send("POST", path+"/read", "", "user_rl"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"unread":0`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+
+	if w := send("POST", "/u/block/user2", "", "user_rl"); w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("POST", "/u/block/user_rl", "", "user_rl"); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d for blocking oneself", w.Code)
+	}
+	if w := send("GET", "/u/blocks", "", "user_rl"); w.Body.String() != `["user2"]` {
+		t.Errorf("got %s", w.Body)
+	}
+	if w := send("POST", path+"/messages", `{"content": "why?"}`, "user2"); w.Code != http.StatusForbidden {
+		t.Errorf("a blocked user sent a message: %d", w.Code)
+	}
+	if w := send("DELETE", "/u/block/user2", "", "user_rl"); w.Code != http.StatusOK {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("DELETE", "/u/block/user2", "", "user_rl"); w.Code != http.StatusNotFound {
+		t.Errorf("got %d for a user who isn't blocked", w.Code)
+	}
+}
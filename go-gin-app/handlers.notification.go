@@ -0,0 +1,172 @@
+// handlers.notification.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary List the notifications of the user, the newest first
+// @Produce json
+// @Param unread query bool false "true to list only the notifications that aren't read"
+// @Param limit query int false "The number of notifications per page, 1 to 100, 20 by default"
+// @Param before query int false "The nextBefore of the previous response, omit it for the first page"
+// @Success 200 {object} notificationPage "The notifications and the number of unread ones"
+// @Failure 400 {object} apiError "validation_failed"
+// @Router /u/notifications [get]
+func listNotifications(c *gin.Context) {
+	problems := map[string]string{}
+
+	unreadOnly := false
+	if raw, ok := c.GetQuery("unread"); ok {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			problems["unread"] = "must be true or false"
+		}
+		unreadOnly = b
+	}
+	limit := defaultNotificationLimit
+	if raw, ok := c.GetQuery("limit"); ok {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxNotificationLimit {
+			problems["limit"] = fmt.Sprintf("must be a number from 1 to %d", maxNotificationLimit)
+		}
+		limit = n
+	}
+	before := 0
+	if raw, ok := c.GetQuery("before"); ok {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			problems["before"] = "must be a notification ID"
+		}
+		before = n
+	}
+
+	if len(problems) > 0 {
+		abortWithFieldErrors(c, "Invalid notification list", problems)
+		return
+	}
+
+	page, err := getNotifications(getCurrentUser(c).Username, unreadOnly, before, limit)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// @Summary Count the notifications of the user that aren't read
+// @Produce json
+// @Success 200 {object} map[string]int "unread: the number of unread notifications"
+// @Router /u/notifications/unread_count [get]
+func getUnreadNotificationCount(c *gin.Context) {
+	count, err := countUnreadNotifications(getCurrentUser(c).Username)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unread": count})
+}
+
+// The notifications to mark as read
+type notificationIDs struct {
+	IDs []int `json:"ids"`
+}
+
+// @Summary Mark notifications of the user as read
+// @Accept json
+// @Produce json
+// @Param ids body notificationIDs true "The IDs of the notifications, at most 100"
+// @Success 200 {object} map[string]int "marked: how many were marked, unread: how many are left"
+// @Failure 400 {object} apiError "validation_failed"
+// @Router /u/notifications/read [post]
+func readNotifications(c *gin.Context) {
+	var body notificationIDs
+	if err := c.ShouldBindJSON(&body); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+	if len(body.IDs) == 0 {
+		abortWithFieldErrors(c, "Invalid notification list", map[string]string{"ids": "is required"})
+		return
+	}
+	if len(body.IDs) > maxNotificationIDs {
+		abortWithFieldErrors(c, "Invalid notification list", map[string]string{"ids": fmt.Sprintf("must have at most %d IDs", maxNotificationIDs)})
+		return
+	}
+	respondWithNotificationsRead(c, body.IDs)
+}
+
+// @Summary Mark every notification of the user as read
+// @Produce json
+// @Success 200 {object} map[string]int "marked: how many were marked, unread: how many are left"
+// @Router /u/notifications/read_all [post]
+func readAllNotifications(c *gin.Context) {
+	respondWithNotificationsRead(c, nil)
+}
+
+// Mark the notifications and answer with the counts
+func respondWithNotificationsRead(c *gin.Context, ids []int) {
+	username := getCurrentUser(c).Username
+	marked, err := markNotificationsRead(username, ids)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	unread, err := countUnreadNotifications(username)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"marked": marked, "unread": unread})
+}
+
+// @Summary See which kinds of notifications the user receives
+// @Produce json
+// @Success 200 {object} map[string]bool "comment, reply, like, follow and match: false when the kind is muted"
+// @Router /u/notifications/preferences [get]
+func getNotificationSettings(c *gin.Context) {
+	prefs, err := getNotificationPreferences(getCurrentUser(c).Username)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+// @Summary Mute or unmute kinds of notifications, the kinds left out are unchanged
+// @Accept json
+// @Produce json
+// @Param preferences body map[string]bool true "comment, reply, like, follow or match: false to mute the kind, true to receive it again"
+// @Success 200 {object} map[string]bool "The preferences after the change"
+// @Failure 400 {object} apiError "validation_failed, with the reason on each unknown kind"
+// @Router /u/notifications/preferences [patch]
+func updateNotificationSettings(c *gin.Context) {
+	var changes map[string]bool
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+	problems := map[string]string{}
+	for kind := range changes {
+		if !isNotificationKind(kind) {
+			problems[kind] = "must be one of " + strings.Join(notificationKinds, ", ")
+		}
+	}
+	if len(problems) > 0 {
+		abortWithFieldErrors(c, "Invalid notification preferences", problems)
+		return
+	}
+
+	username := getCurrentUser(c).Username
+	if err := setNotificationPreferences(username, changes); err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	getNotificationSettings(c)
+}
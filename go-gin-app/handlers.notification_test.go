@@ -0,0 +1,77 @@
+// handlers.notification_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Test the notification routes
+func TestNotificationRoutes(t *testing.T) {
+	defer DB.Exec("DELETE FROM notifications WHERE recipient = 'user3'")
+	defer DB.Exec("DELETE FROM notification_mutes WHERE username = 'user3'")
+	defer DB.Exec("DELETE FROM subscribe WHERE star = 'user3'")
+
+	r := getAppRouter()
+	send := func(method string, path string, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(getSessionCookie(t, "user3"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, follower := range []string{"user1", "user2", "user_rl"} {
+		if err := performSubscribe("user3", follower); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := send("GET", "/u/notifications?limit=2", "")
+	var page notificationPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); w.Code != http.StatusOK || err != nil || len(page.Notifications) != 2 || page.Unread != 3 || page.NextBefore == 0 {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+	if page.Notifications[0].Actor != "user_rl" || page.Notifications[0].Kind != notifyFollow {
+		t.Errorf("got %+v", page.Notifications[0])
+	}
+
+	if w := send("POST", "/u/notifications/read", fmt.Sprintf(`{"ids": [%d]}`, page.Notifications[0].ID)); w.Code != http.StatusOK || w.Body.String() != `{"marked":1,"unread":2}` {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("GET", "/u/notifications?unread=true", ""); w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"actor":"user_rl"`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("POST", "/u/notifications/read_all", ""); w.Code != http.StatusOK || w.Body.String() != `{"marked":2,"unread":0}` {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("GET", "/u/notifications/unread_count", ""); w.Code != http.StatusOK || w.Body.String() != `{"unread":0}` {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+
+	if w := send("PATCH", "/u/notifications/preferences", `{"like": false}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"like":false`) || !strings.Contains(w.Body.String(), `"follow":true`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("PATCH", "/u/notifications/preferences", `{"poke": false}`); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d for an unknown kind", w.Code)
+	}
+
+	for _, query := range []string{"unread=maybe", "limit=0", "limit=101", "before=x"} {
+		if w := send("GET", "/u/notifications?"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", query, w.Code)
+		}
+	}
+	if w := send("POST", "/u/notifications/read", `{"ids": []}`); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d without IDs", w.Code)
+	}
+	tooMany := "1" + strings.Repeat(", 1", maxNotificationIDs)
+	if w := send("POST", "/u/notifications/read", `{"ids": [`+tooMany+`]}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"ids"`) {
+		t.Errorf("got %d %s for %d IDs", w.Code, w.Body, maxNotificationIDs+1)
+	}
+}
@@ -0,0 +1,76 @@
+// handlers.profile.go
+
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get the public profile of a user. The age replaces the birthday, and the fields the user hides from the viewer are left out
+// @Produce json
+// @Param username path string true "The user"
+// @Success 200 {object} profile "The fields the viewer may see"
+// @Failure 404 {object} apiError "The user does not exist or one of the users blocked the other"
+// @Router /u/profile/:username [get]
+func getProfile(c *gin.Context) {
+	p, err := getPublicProfile(getCurrentUser(c).Username, c.Param("username"))
+	if err == sql.ErrNoRows {
+		abortWithAPIError(c, http.StatusNotFound, "The user does not exist")
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// @Summary Get who may see each field of the profile of the user
+// @Produce json
+// @Success 200 {object} map[string]string "public, followers or matches for each field"
+// @Router /u/info/visibility [get]
+func getProfileVisibilitySettings(c *gin.Context) {
+	visibility, err := getProfileVisibility(getCurrentUser(c).Username)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, visibility)
+}
+
+// @Summary Change who may see fields of the profile, the fields left out are unchanged. Followers only shows the field to the followers the user follows back and to matches
+// @Accept json
+// @Produce json
+// @Param visibility body map[string]string true "age, gender, pronouns, bio, major, gradYear, tags or photos: public, followers or matches"
+// @Success 200 {object} map[string]string "The visibility after the change"
+// @Failure 400 {object} apiError "validation_failed, with the reason on each invalid field"
+// @Router /u/info/visibility [patch]
+func updateProfileVisibilitySettings(c *gin.Context) {
+	var changes map[string]string
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+	problems := map[string]string{}
+	for field, v := range changes {
+		if !isProfileField(field) {
+			problems[field] = "must be one of " + strings.Join(profileFields, ", ")
+		} else if v != visibilityPublic && v != visibilityFollowers && v != visibilityMatches {
+			problems[field] = "must be public, followers or matches"
+		}
+	}
+	if len(problems) > 0 {
+		abortWithFieldErrors(c, "Invalid profile visibility", problems)
+		return
+	}
+
+	if err := setProfileVisibility(getCurrentUser(c).Username, changes); err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	getProfileVisibilitySettings(c)
+}
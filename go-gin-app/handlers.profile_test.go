@@ -0,0 +1,91 @@
+// handlers.profile_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test editing a profile, reading it back through /u/info and seeing it
+// from another account through /u/profile/:username
+func TestProfileRoutes(t *testing.T) {
+	owner := user{Gatorlink: "profRoutes@ufl.edu", Username: "profRoutes", Password: "p", Gender: "male", Birthday: "1999-09-09"}
+	registerActiveUser(t, owner)
+	defer deleteUser(owner.Username)
+
+	original := appConfig
+	defer func() { appConfig = original }()
+	appConfig.ImageDir = t.TempDir()
+	appConfig.PublicBaseURL = "https://api.example.com"
+	os.WriteFile(filepath.Join(appConfig.ImageDir, "gallery.jpg"), []byte("jpg"), 0600)
+	setImageOwner("gallery.jpg", owner.Username)
+	defer deleteImageOwner("gallery.jpg")
+	os.WriteFile(filepath.Join(appConfig.ImageDir, "theirs.jpg"), []byte("jpg"), 0600)
+	setImageOwner("theirs.jpg", "user2")
+	defer deleteImageOwner("theirs.jpg")
+
+	r := getAppRouter()
+	send := func(method string, path string, payload string, username string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(getSessionCookie(t, username))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, payload := range []string{`{"photos": ["theirs.jpg"]}`, `{"photos": ["missing.jpg"]}`, `{"tags": ["", "x"]}`, `{"bio": 5}`,
+		`{"tags": ["a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"]}`} {
+		if w := send("PATCH", "/u/info", payload, owner.Username); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", payload, w.Code)
+		}
+	}
+	if w := send("PATCH", "/u/info", `{"bio": "Hi there", "pronouns": "he/him", "tags": ["Jazz", "jazz", "Chess"], "photos": ["gallery.jpg"]}`, owner.Username); w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body)
+	}
+
+	// The own profile has the private fields but never the password
+	w := send("GET", "/u/info", "", owner.Username)
+	var mine ownProfile
+	if err := json.Unmarshal(w.Body.Bytes(), &mine); w.Code != http.StatusOK || err != nil || strings.Contains(w.Body.String(), "password") ||
+		mine.Gatorlink != "profroutes@ufl.edu" || mine.Birthday != "1999-09-09" || strings.Join(mine.Tags, ",") != "jazz,chess" ||
+		len(mine.Photos) != 1 || mine.Photos[0].URL != "https://api.example.com/image/download/gallery.jpg" {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+
+	w = send("GET", "/u/profile/"+owner.Username, "", "user2")
+	var public profile
+	if err := json.Unmarshal(w.Body.Bytes(), &public); w.Code != http.StatusOK || err != nil || public.Age == nil || public.Bio == nil || *public.Bio != "Hi there" {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	for _, private := range []string{"password", "gatorId", "birthday", "@ufl.edu", "visibility"} {
+		if strings.Contains(w.Body.String(), private) {
+			t.Errorf("the public profile has %s: %s", private, w.Body)
+		}
+	}
+
+	if w := send("PATCH", "/u/info/visibility", `{"bio": "friends", "password": "public"}`, owner.Username); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), `"bio"`) || !strings.Contains(w.Body.String(), `"password"`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("PATCH", "/u/info/visibility", `{"bio": "matches", "photos": "followers"}`, owner.Username); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"bio":"matches"`) {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	if w := send("GET", "/u/profile/"+owner.Username, "", "user2"); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "Hi there") || strings.Contains(w.Body.String(), "gallery.jpg") {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+	// The owner still sees everything
+	if w := send("GET", "/u/profile/"+owner.Username, "", owner.Username); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Hi there") {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+
+	if w := send("GET", "/u/profile/nobodyAtAll", "", "user2"); w.Code != http.StatusNotFound {
+		t.Errorf("got %d for a missing user", w.Code)
+	}
+}
@@ -0,0 +1,84 @@
+// handlers.search.go
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Search the articles and comments, the best matches first
+// @Produce json
+// @Param q query string true "The words to find, text in double quotes is searched as a phrase"
+// @Param author query string false "Only the articles and comments of this user"
+// @Param from query string false "Only what was posted on or after this day, e.g. 2022-04-01"
+// @Param to query string false "Only what was posted on or before this day, e.g. 2022-04-30"
+// @Param type query string false "article or comment, both by default"
+// @Param limit query int false "The number of results per page, 1 to 50, 20 by default"
+// @Param offset query int false "The nextOffset of the previous response, omit it for the first page"
+// @Success 200 {object} searchPage "The matches with highlighted titles and snippets"
+// @Failure 400 {object} apiError "validation_failed"
+// @Failure 503 {object} apiError "Search is not available on this server"
+// @Router /search [get]
+func search(c *gin.Context) {
+	problems := map[string]string{}
+
+	q := searchQuery{
+		Text:   c.Query("q"),
+		Author: c.Query("author"),
+		From:   c.Query("from"),
+		To:     c.Query("to"),
+		Kind:   c.Query("type"),
+		Limit:  defaultSearchLimit,
+	}
+
+	if buildMatchQuery(q.Text) == "" {
+		problems["q"] = "is required"
+	}
+	if q.Kind != "" && q.Kind != "article" && q.Kind != "comment" {
+		problems["type"] = "must be article or comment"
+	}
+	for name, value := range map[string]string{"from": q.From, "to": q.To} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			problems[name] = "must be a day such as 2022-04-30"
+		}
+	}
+	if raw, ok := c.GetQuery("limit"); ok {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			problems["limit"] = fmt.Sprintf("must be a number from 1 to %d", maxSearchLimit)
+		}
+		q.Limit = n
+	}
+	if raw, ok := c.GetQuery("offset"); ok {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			problems["offset"] = "must be a number from 0"
+		}
+		q.Offset = n
+	}
+
+	if len(problems) > 0 {
+		abortWithFieldErrors(c, "Invalid search", problems)
+		return
+	}
+
+	page, err := searchContent(q)
+	if err == errSearchUnavailable {
+		abortWithAPIError(c, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
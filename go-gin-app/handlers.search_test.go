@@ -0,0 +1,31 @@
+// handlers.search_test.go
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test that invalid search parameters are refused
+func TestSearchParameters(t *testing.T) {
+	r := getAppRouter()
+	for _, query := range []string{"", "q=%22%22", "q=a&type=user", "q=a&from=yesterday", "q=a&to=2022-13-01", "q=a&limit=51", "q=a&offset=-1"} {
+		req, _ := http.NewRequest("GET", "/search?"+query, nil)
+		req.AddCookie(getSessionCookie(t, "user1"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", query, w.Code)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/search?q=a", nil)
+	req.AddCookie(getSessionCookie(t, "user1"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if want := map[bool]int{true: http.StatusOK, false: http.StatusServiceUnavailable}[searchEnabled]; w.Code != want {
+		t.Errorf("got %d, want %d", w.Code, want)
+	}
+}
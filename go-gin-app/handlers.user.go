@@ -3,12 +3,13 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
-	"fmt"
 	"log"
-	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -29,69 +30,70 @@ func showLoginPage(c *gin.Context) {
 // @Param username header string true "Username"
 // @Param password header string true "Password"
 // @Success 200 {string} string "Log in successfully"
-// @Failure 400 {string} string "Failed to log in"
+// @Failure 400 {object} apiError "Failed to log in"
+// @Failure 403 {object} apiError "The account is not verified yet"
 // @Router /u/login [post]
 func performLogin(c *gin.Context) {
 	// Obtain the POSTed username and password values
 	//username := c.PostForm("username")
 	//password := c.PostForm("password")
 	var u mingleUser
-	if err := c.BindJSON(&u); err != nil {
-		//c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		c.AbortWithError(http.StatusBadRequest, err)
+	if err := c.ShouldBindJSON(&u); err != nil {
+		abortWithInvalidBody(c, err)
 		return
 	}
 
-	validationErr := validate.Struct(u)
-	if validationErr != nil {
-		//c.JSON(http.StatusBadRequest, gin.H{"error": validationErr})
-		c.AbortWithError(http.StatusBadRequest, validationErr)
-		fmt.Println(validationErr)
+	if err := validate.Struct(u); err != nil {
+		abortWithInvalidBody(c, err)
 		return
 	}
 
-	var sameSiteCookie http.SameSite
-
 	// Check if the username/password combination is valid
 	valid, err := isUserValid(u)
-	if valid && err == nil {
-		// If the username/password is valid set the token in a cookie
-		//token := generateSessionToken()
-		//token = token + " " + u.Username + " " + u.Password
-		jsonstr, _ := json.Marshal(u)
-		c.SetSameSite(sameSiteCookie)
-		// maxAge: seconds
-		c.SetCookie("token", string(jsonstr), 36000, "", "localhost", false, true)
-		c.Set("is_logged_in", true)
-
-		//loggedInInterface, _ := c.Get("is_logged_in")
-		//loggedIn := loggedInInterface.(bool)
-		//
-		//fmt.Println("Print at performLogin()")
-		//fmt.Println(loggedIn)
-
-		render(c, gin.H{
-			"title":   "Successful Login",
-			"payload": "Successful Login"}, "login-successful.html")
-		//c.JSON(http.StatusOK, gin.H{"message": "Log in Successfully"})
-
-	} else {
-		// If the username/password combination is invalid,
-		// show the error message on the login page
-		c.HTML(http.StatusBadRequest, "login.html", gin.H{
-			"ErrorTitle":   "Login Failed",
-			"ErrorMessage": "Invalid credentials provided"})
+	if err == errAccountNotVerified {
+		abortWithAPIError(c, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	if !valid {
+		abortWithAPIError(c, http.StatusBadRequest, "Invalid credentials provided")
+		return
+	}
 
-		//c.JSON(http.StatusBadRequest, gin.H{"error": "It's not a valid user"})
+	// If the username/password is valid start a session and
+	// set its ID in a cookie
+	s, err := createSession(u.Username)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
 	}
+	setSessionCookie(c, s)
+
+	//loggedInInterface, _ := c.Get("is_logged_in")
+	//loggedIn := loggedInInterface.(bool)
+	//
+	//fmt.Println("Print at performLogin()")
+	//fmt.Println(loggedIn)
+
+	render(c, gin.H{
+		"title":   "Successful Login",
+		"payload": "Successful Login"}, "login-successful.html")
+	//c.JSON(http.StatusOK, gin.H{"message": "Log in Successfully"})
 }
 
-func generateSessionToken() string {
-	// We're using a random 16 character string as the session token
-	// This is NOT a secure way of generating session tokens
-	// DO NOT USE THIS IN PRODUCTION
+// Set the session ID in the "token" cookie and mark the request as logged in
+func setSessionCookie(c *gin.Context, s session) {
+	var sameSiteCookie http.SameSite
 
-	return strconv.FormatInt(rand.Int63(), 16)
+	c.SetSameSite(sameSiteCookie)
+	// maxAge: seconds
+	c.SetCookie("token", s.ID, int(sessionLifetime.Seconds()), "", appConfig.CookieDomain, false, true)
+	if err := setCurrentUser(c, s); err != nil {
+		log.Println(err)
+	}
 }
 
 // @Summary Logout
@@ -99,12 +101,17 @@ func generateSessionToken() string {
 // @Success 200 {string} string "Log out successfully"
 // @Router /u/logout [get]
 func logout(c *gin.Context) {
+	// Revoke the session so the cookie can't be replayed
+	if err := revokeSession(getCurrentUser(c).SessionID); err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
 
 	var sameSiteCookie http.SameSite
 
 	// Clear the cookie
 	c.SetSameSite(sameSiteCookie)
-	c.SetCookie("token", "", -1, "", "localhost", false, true)
+	c.SetCookie("token", "", -1, "", appConfig.CookieDomain, false, true)
 	c.JSON(http.StatusOK, gin.H{"payload": "Log out successfully"})
 
 	//loggedInInterface, _ := c.Get("is_logged_in")
@@ -126,119 +133,362 @@ func showRegistrationPage(c *gin.Context) {
 		"title": "Register"}, "register.html")
 }
 
-// @Summary Register a new user
-// @Param gatorlink header string true "Gatorlink"
-// @Param gatorPW header string true "GatorPW"
+// @Summary Register a new user. The account is pending until the code emailed to the GatorLink is sent to /u/verify
+// @Accept json
+// @Produce json
+// @Param gatorlink header string true "GatorLink username or @ufl.edu address"
 // @Param username header string true "Username"
 // @Param password header string true "Password"
-// @Success 200 {int} int "Register successfully, return the number of rows been affected"
-// @Failure 400 {error} error "ErrorMessage"
+// @Param gender header string true "male, female or unknown"
+// @Param birthday header string false "Birthday in the form 2006-01-02"
+// @Success 200 {string} string "The verification code was sent"
+// @Failure 400 {object} apiError "validation_failed, with the reason on the username, password, gatorlink, gender or birthday field"
+// @Failure 409 {object} apiError "The GatorLink already belongs to an active account"
 // @Router /u/register [post]
 func register(c *gin.Context) {
-	// Obtain the POSTed username and password values
-	//username := c.PostForm("username")
-	//password := c.PostForm("password")
+	var newUser user
+	if err := c.ShouldBindJSON(&newUser); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
 
-	var sameSiteCookie http.SameSite
+	if err := validate.Struct(newUser); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
 
-	var newUser user
-	if err := c.BindJSON(&newUser); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	_, err := registerNewUser(newUser)
+	switch err {
+	case nil:
+	case errInvalidUsername, errUsernameTaken:
+		abortWithFieldErrors(c, "Registration failed", map[string]string{"username": err.Error()})
+		return
+	case errEmptyPassword:
+		abortWithFieldErrors(c, "Registration failed", map[string]string{"password": err.Error()})
+		return
+	case errInvalidGatorlink:
+		abortWithFieldErrors(c, "Registration failed", map[string]string{"gatorlink": err.Error()})
+		return
+	case errInvalidGender:
+		abortWithFieldErrors(c, "Registration failed", map[string]string{"gender": err.Error()})
+		return
+	case errInvalidBirthday, errFutureBirthday:
+		abortWithFieldErrors(c, "Registration failed", map[string]string{"birthday": err.Error()})
+		return
+	case errGatorlinkInUse:
+		abortWithAPIError(c, http.StatusConflict, err.Error())
+		return
+	default:
+		abortWithInternalError(c, err)
 		return
 	}
 
-	validationErr := validate.Struct(newUser)
-	if validationErr != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
-		fmt.Println(validationErr)
+	sendVerificationCode(c, newUser.Username)
+}
+
+// Email a new verification code to a pending user. If the email can't be
+// sent, the user can ask for another code with /u/verify/resend
+func sendVerificationCode(c *gin.Context, username string) {
+	code, gatorId, err := startVerification(username)
+	switch err {
+	case nil:
+	case errNothingToVerify:
+		abortWithAPIError(c, http.StatusNotFound, err.Error())
+		return
+	case errResendTooSoon:
+		abortWithAPIError(c, http.StatusTooManyRequests, err.Error())
+		return
+	default:
+		abortWithInternalError(c, err)
 		return
 	}
 
-	if num, err := registerNewUser(newUser); err == nil {
-		// If the user is created, set the token in a cookie and log the user in
-		//token := generateSessionToken()
-		//token = token + " " + newUser.Username + " " + newUser.Password
-		ufuser := mingleUser{newUser.Username, newUser.Password}
-		jsonstr, _ := json.Marshal(ufuser)
-		c.SetSameSite(sameSiteCookie)
-		c.SetCookie("token", string(jsonstr), 36000, "", "localhost", false, true)
-		c.Set("is_logged_in", true)
+	if err := sendVerificationEmail(username, gatorId, code); err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payload": "A verification code was sent to " + gatorId})
+}
 
-		render(c, gin.H{
-			"title":   "Successful registration & Login",
-			"payload": num}, "login-successful.html")
-		//c.JSON(http.StatusOK, gin.H{"message": "Register successfully"})
+type verificationRequest struct {
+	Username string `form:"username" json:"username" validate:"required"`
+	Code     string `form:"code" json:"code" validate:"required"`
+}
 
+// @Summary Activate a pending account with the code emailed to its GatorLink, and log in. The link in the email uses GET with the query parameters
+// @Accept json
+// @Produce json
+// @Param username header string true "Username"
+// @Param code header string true "The 6 digit code"
+// @Success 200 {string} string "The account is active and logged in"
+// @Failure 400 {object} apiError "validation_failed, the code is wrong or has expired"
+// @Failure 404 {object} apiError "No account is waiting for verification with this username"
+// @Failure 409 {object} apiError "Another account with the GatorLink was activated first"
+// @Failure 429 {object} apiError "Too many wrong codes, a new one must be requested"
+// @Router /u/verify [post]
+func verifyAccount(c *gin.Context) {
+	var req verificationRequest
+	var err error
+	if c.Request.Method == http.MethodGet {
+		err = c.ShouldBindQuery(&req)
 	} else {
-		// If the username/password combination is invalid,
-		// show the error message on the login page
-		log.Println(err)
-		c.HTML(http.StatusBadRequest, "register.html", gin.H{
-			"ErrorTitle":   "Registration Failed",
-			"ErrorMessage": err.Error()})
-		//c.JSON(http.StatusBadRequest, err.Error())
+		err = c.ShouldBindJSON(&req)
+	}
+	if err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
 
+	switch err := verifyUser(req.Username, req.Code); err {
+	case nil:
+	case errInvalidCode:
+		abortWithFieldErrors(c, "Verification failed", map[string]string{"code": err.Error()})
+		return
+	case errNothingToVerify:
+		abortWithAPIError(c, http.StatusNotFound, err.Error())
+		return
+	case errGatorlinkInUse:
+		abortWithAPIError(c, http.StatusConflict, err.Error())
+		return
+	case errTooManyAttempts:
+		abortWithAPIError(c, http.StatusTooManyRequests, err.Error())
+		return
+	default:
+		abortWithInternalError(c, err)
+		return
 	}
+
+	// The account is active, start a session and log the user in
+	s, err := createSession(req.Username)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	setSessionCookie(c, s)
+
+	render(c, gin.H{
+		"title":   "Successful registration & Login",
+		"payload": "Successful registration & Login"}, "login-successful.html")
 }
 
-// @Summary Modify three types of user information: password, birthday and gender. Birthday must be in the form "2010-12-30", and the gender can be male, female or unknown
+// @Summary Email a new verification code to a pending account, at most once a minute
+// @Accept json
 // @Produce json
+// @Param username header string true "Username"
+// @Success 200 {string} string "The verification code was sent"
+// @Failure 404 {object} apiError "No account is waiting for verification with this username"
+// @Failure 429 {object} apiError "A code was sent less than a minute ago"
+// @Router /u/verify/resend [post]
+func resendVerification(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" validate:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+
+	sendVerificationCode(c, req.Username)
+}
+
+// @Summary Modify the profile of the user. Birthday must be in the form "2010-12-30" and not in the future, the gender can be male, female or unknown, major is at most 100 characters, grad_year a year from 1950 to 2100, bio at most 500 characters and pronouns at most 30; "" and null clear them. tags (at most 10) and photos (at most 6 file names of images uploaded with /image/upload) replace the lists. Any other field is rejected
+// @Accept json
+// @Produce json
+// @Param profile body object true "The fields to change: birthday, gender, major, grad_year, bio, pronouns, tags and/or photos"
 // @Success 200 {string} string "Success"
-// @Failure 400 {error} error "Failure"
-// @Router /u/info/:item [patch]
+// @Failure 400 {object} apiError "validation_failed, with fields mapping each rejected field to the reason"
+// @Failure 500 {object} apiError "Failure"
+// @Router /u/info [patch]
 func updateUserInfo(c *gin.Context) {
-	//item := c.Param("item")
-	var tempUser mingleUser
-	token, err := c.Cookie("token")
-	if err != nil {
-		log.Println("at 188", err)
-		c.AbortWithError(http.StatusBadRequest, err)
-	}
+	tempUser := getCurrentUser(c)
 
-	err = json.Unmarshal([]byte(token), &tempUser)
-	if err != nil {
-		log.Println("at 194", err)
-		c.AbortWithError(http.StatusBadRequest, err)
+	var content map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&content); err != nil {
+		abortWithInvalidBody(c, err)
+		return
 	}
 
-	var content map[string]string
-	if err = c.BindJSON(&content); err != nil {
-		fmt.Println(content)
-		log.Println("at 201", err)
-		c.AbortWithError(http.StatusBadRequest, err)
+	update, fieldErrs := parseProfileUpdate(content)
+	if update.Photos != nil {
+		for _, filename := range *update.Photos {
+			own, err := isOwnImage(tempUser.Username, filename)
+			if err != nil {
+				abortWithInternalError(c, err)
+				return
+			}
+			if !own {
+				fieldErrs["photos"] = "must be images you uploaded"
+			}
+		}
 	}
-	num, errUpdate := updateUserItem(tempUser.Username, content)
-	if int(num) != len(content) || errUpdate != nil {
-		log.Println("at 206", errUpdate)
-		c.AbortWithError(http.StatusBadRequest, errUpdate)
+	if len(fieldErrs) != 0 {
+		abortWithFieldErrors(c, "Invalid profile update", fieldErrs)
+		return
+	}
+
+	if err := updateUserProfile(tempUser.Username, update); err != nil {
+		abortWithInternalError(c, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "success"})
 }
 
-// @Summary Get user information by username
+// @Summary Change the password of the user, the old password is required
+// @Accept json
 // @Produce json
-// @Success 200 {object} user "Contains password, gatorId, birthday and gender"
-// @Failure 500 {error} error "Failure"
-// @Router /u/info [get]
-func getUserInfo(c *gin.Context) {
-	var tempUser mingleUser
-	token, err := c.Cookie("token")
-	if err != nil {
-		log.Println("at getUserInfo1", err)
-		c.AbortWithError(http.StatusBadRequest, err)
+// @Param password body passwordChange true "The old and the new password"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apiError "validation_failed, with fields mapping each rejected field to the reason"
+// @Failure 500 {object} apiError "Failure"
+// @Router /u/password [patch]
+func updatePassword(c *gin.Context) {
+	tempUser := getCurrentUser(c)
+
+	var change passwordChange
+	if err := c.ShouldBindJSON(&change); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+	if err := validate.Struct(change); err != nil {
+		abortWithInvalidBody(c, err)
+		return
 	}
 
-	err = json.Unmarshal([]byte(token), &tempUser)
+	err := changeUserPassword(tempUser.Username, change)
+	if err == errWrongPassword {
+		abortWithFieldErrors(c, "Invalid password change", map[string]string{"old_password": err.Error()})
+		return
+	}
+	if err == errEmptyPassword {
+		abortWithFieldErrors(c, "Invalid password change", map[string]string{"new_password": err.Error()})
+		return
+	}
 	if err != nil {
-		log.Println("at getUserInfo2", err)
-		c.AbortWithError(http.StatusBadRequest, err)
+		abortWithInternalError(c, err)
+		return
 	}
 
-	userInfo, err := getUserByUsername(tempUser.Username)
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
 
+// Password reset requests allowed per account and per IP in an hour
+var (
+	passwordResetAccountLimiter = newRateLimiter(3, time.Hour)
+	passwordResetIPLimiter      = newRateLimiter(10, time.Hour)
+)
+
+// @Summary Email a password reset token to the GatorLink of an account. The answer is the same whether the account exists or not
+// @Accept json
+// @Produce json
+// @Param username header string true "Username"
+// @Success 200 {string} string "If the account exists, a reset token was sent"
+// @Failure 400 {object} apiError "validation_failed"
+// @Failure 429 {object} apiError "Too many reset requests for the account or from the IP"
+// @Router /u/password/forgot [post]
+func forgotPassword(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" validate:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+
+	if !passwordResetIPLimiter.allow(c.ClientIP()) || !passwordResetAccountLimiter.allow(strings.ToLower(req.Username)) {
+		abortWithAPIError(c, http.StatusTooManyRequests, "Too many password reset requests, try again later")
+		return
+	}
+
+	token, gatorId, err := createPasswordReset(req.Username)
+	switch err {
+	case nil:
+		// A failed email is only logged, the answer must not tell whether
+		// the account exists
+		if err := sendPasswordResetEmail(req.Username, gatorId, token); err != nil {
+			log.Printf("[%s] password reset email for %s: %v", getRequestID(c), req.Username, err)
+		}
+	case errNothingToReset:
+	default:
+		abortWithInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payload": "If the account exists, a reset token was sent to its GatorLink"})
+}
+
+type passwordReset struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+// @Summary Set a new password with the token emailed by /u/password/forgot. Every session of the account is logged out
+// @Accept json
+// @Produce json
+// @Param reset body passwordReset true "The reset token and the new password"
+// @Success 200 {string} string "Success"
+// @Failure 400 {object} apiError "validation_failed, the token is invalid, expired or used, or the password is empty"
+// @Failure 429 {object} apiError "Too many attempts from the IP"
+// @Router /u/password/reset [post]
+func resetPassword(c *gin.Context) {
+	var reset passwordReset
+	if err := c.ShouldBindJSON(&reset); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+	if err := validate.Struct(reset); err != nil {
+		abortWithInvalidBody(c, err)
+		return
+	}
+
+	if !passwordResetIPLimiter.allow(c.ClientIP()) {
+		abortWithAPIError(c, http.StatusTooManyRequests, "Too many password reset requests, try again later")
+		return
+	}
+
+	switch err := resetPasswordWithToken(reset.Token, reset.NewPassword); err {
+	case nil:
+	case errInvalidResetToken:
+		abortWithFieldErrors(c, "Invalid password reset", map[string]string{"token": err.Error()})
+		return
+	case errEmptyPassword:
+		abortWithFieldErrors(c, "Invalid password reset", map[string]string{"new_password": err.Error()})
+		return
+	default:
+		abortWithInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success"})
+}
+
+// @Summary Get the profile of the user with the private fields and who may see each field. The password is never returned
+// @Produce json
+// @Success 200 {object} ownProfile "The profile, with gatorId, birthday, role and visibility"
+// @Failure 500 {object} apiError "Failure"
+// @Router /u/info [get]
+func getUserInfo(c *gin.Context) {
+	tempUser := getCurrentUser(c)
+
+	userInfo, err := getOwnProfile(tempUser.Username)
 	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, err)
+		abortWithInternalError(c, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, userInfo)
@@ -248,26 +498,20 @@ func getUserInfo(c *gin.Context) {
 // @Produce json
 // @Param articleId path int true "The id of the article"
 // @Success 200 {int} int "There are four possibilities. 0: no reaction; 1: thumbs up; 2: thumbs down; -1: error"
-// @Failure 400 {error} error "Unable to get the cookie"
-// @Failure 500 {error} error "Failure"
+// @Failure 404 {object} apiError "Invalid article ID or the article does not exist"
+// @Failure 500 {object} apiError "Failure"
 // @Router /u/article/:articleId [get]
 func checkReaction(c *gin.Context) {
-	var tempUser mingleUser
-	token, _ := c.Cookie("token")
-	if err := json.Unmarshal([]byte(token), &tempUser); err != nil {
-		log.Println(err)
-		c.AbortWithError(http.StatusBadRequest, err)
-	}
+	tempUser := getCurrentUser(c)
 
-	articleId, err := strconv.Atoi(c.Param("articleId"))
-	if err != nil {
-		log.Println(err)
-		c.AbortWithError(http.StatusInternalServerError, err)
+	articleId, ok := getExistingArticleId(c, "articleId")
+	if !ok {
+		return
 	}
-	status, _, err := checkArticleStatus(tempUser.Username, articleId)
+	status, err := checkArticleStatus(tempUser.Username, articleId)
 	if err != nil {
-		log.Println(err)
-		c.AbortWithError(http.StatusInternalServerError, err)
+		abortWithInternalError(c, err)
+		return
 	}
 	c.JSON(http.StatusOK, status)
 }
@@ -276,68 +520,121 @@ func checkReaction(c *gin.Context) {
 // @Produce json
 // @Param articleId path int true "The id of the article"
 // @Param thumbsup body string true "0, object; 1, support" SchemaExample(Subject: thumbsup\r\n\r\n1\r\n)
-// @Success 200 {int} int "Success"
-// @Failure 400 {error} error "Unable to get the cookie"
-// @Failure 500 {error} error "Failure"
+// @Success 200 {object} map[string]interface{} "The new numbers of likes and dislikes of the article"
+// @Failure 400 {object} apiError "Invalid request body"
+// @Failure 404 {object} apiError "Invalid article ID or the article does not exist"
+// @Failure 500 {object} apiError "Failure"
 // @Router /u/article/:articleId [patch]
 func changeReaction(c *gin.Context) {
-	var tempUser mingleUser
-	token, _ := c.Cookie("token")
-	if err := json.Unmarshal([]byte(token), &tempUser); err != nil {
-		log.Println(err)
-		c.AbortWithError(http.StatusBadRequest, err)
+	tempUser := getCurrentUser(c)
+
+	articleId, ok := getExistingArticleId(c, "articleId")
+	if !ok {
+		return
 	}
 
-	articleId, err := strconv.Atoi(c.Param("articleId"))
-	if err != nil {
-		log.Println(err)
-		c.AbortWithError(http.StatusInternalServerError, err)
+	status, ok := bindReaction(c)
+	if !ok {
+		return
 	}
 
+	respondWithArticleReaction(c, tempUser.Username, articleId, status)
+}
+
+// Read the reaction in a {"thumbsup": 0 or 1} body.
+// Aborts with 400 and returns false if the body is invalid
+func bindReaction(c *gin.Context) (int, bool) {
 	//thumbsUpMap["thumbsup"] = 0, 点踩
 	//thumbsUpMap["thumbsup"] = 1, 点赞
 	var thumbsUpMap map[string]int
-	if err = c.BindJSON(&thumbsUpMap); err != nil {
-		log.Println(err)
-		c.AbortWithError(http.StatusBadRequest, err)
+	if err := c.ShouldBindJSON(&thumbsUpMap); err != nil {
+		abortWithInvalidBody(c, err)
+		return reactionNone, false
 	}
 
-	var errUpdate error
-	var affectUsers, affectArticles int64
-	//status = true  点赞
-	//status = false 点踩
-	if thumbsUpMap["thumbsup"] == 0 {
+	switch thumbsUp, ok := thumbsUpMap["thumbsup"]; {
+	case ok && thumbsUp == 0:
 		//点踩
-		affectUsers, affectArticles, errUpdate = changeArticleStatus(tempUser.Username, articleId, false)
-	} else if thumbsUpMap["thumbsup"] == 1 {
+		return reactionDislike, true
+	case ok && thumbsUp == 1:
 		//点赞
-		affectUsers, affectArticles, errUpdate = changeArticleStatus(tempUser.Username, articleId, true)
+		return reactionLike, true
 	}
-	if errUpdate != nil {
-		log.Println(err)
-		c.AbortWithError(http.StatusInternalServerError, errUpdate)
+	abortWithFieldErrors(c, "Invalid reaction", map[string]string{"thumbsup": "must be 0 or 1"})
+	return reactionNone, false
+}
+
+// @Summary Clear user's reaction to an article.
+// @Produce json
+// @Param articleId path int true "The id of the article"
+// @Success 200 {object} map[string]interface{} "The new numbers of likes and dislikes of the article"
+// @Failure 404 {object} apiError "Invalid article ID or the article does not exist"
+// @Failure 500 {object} apiError "Failure"
+// @Router /u/article/:articleId [delete]
+func clearReaction(c *gin.Context) {
+	tempUser := getCurrentUser(c)
+
+	articleId, ok := getExistingArticleId(c, "articleId")
+	if !ok {
+		return
 	}
-	fmt.Println("affectUsers: ", affectUsers, " affectArticles: ", affectArticles)
-	c.JSON(http.StatusOK, gin.H{"message": "Success"})
+
+	respondWithArticleReaction(c, tempUser.Username, articleId, reactionNone)
+}
+
+// Store the reaction and answer with the new counts of the article
+func respondWithArticleReaction(c *gin.Context, username string, articleId int, status int) {
+	likes, dislikes, err := changeArticleStatus(username, articleId, status)
+	if err == sql.ErrNoRows {
+		abortWithAPIError(c, http.StatusNotFound, "The article does not exist")
+		return
+	}
+	if err != nil {
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Success", "likes": likes, "dislikes": dislikes})
+}
+
+// Parse the article ID in the path and make sure the article exists.
+// Aborts with 404 and returns false otherwise
+func getExistingArticleId(c *gin.Context, param string) (int, bool) {
+	a, ok := getExistingArticle(c, param)
+	return a.ID, ok
+}
+
+// Like getExistingArticleId, returning the whole article
+func getExistingArticle(c *gin.Context, param string) (article, bool) {
+	articleId, err := strconv.Atoi(c.Param(param))
+	if err != nil {
+		abortWithAPIError(c, http.StatusNotFound, "Invalid article ID")
+		return article{}, false
+	}
+	a, err := getArticleByID(articleId)
+	if err != nil {
+		abortWithInternalError(c, err)
+		return article{}, false
+	}
+	if a.ID != articleId {
+		abortWithAPIError(c, http.StatusNotFound, "The article does not exist")
+		return article{}, false
+	}
+	return a, true
 }
 
 // @Summary Get the number of likes a user received.
 // @Produce json
 // @Success 200 {int} int "The number of likes a user received"
-// @Failure 400 {error} error "Unable to get the cookie"
-// @Failure 500 {error} error "Server internal error"
+// @Failure 401 {object} apiError "Not logged in"
+// @Failure 500 {object} apiError "Server internal error"
 // @Router /u/likes [get]
 func likesReceivedByUser(c *gin.Context) {
-	var tempUser mingleUser
-	token, _ := c.Cookie("token")
-	if err := json.Unmarshal([]byte(token), &tempUser); err != nil {
-		log.Println(err)
-		c.AbortWithError(http.StatusBadRequest, err)
-	}
+	tempUser := getCurrentUser(c)
 
 	likes, err := getLikesReceived(tempUser.Username)
 	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, err)
+		abortWithInternalError(c, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, likes)
@@ -345,58 +642,51 @@ func likesReceivedByUser(c *gin.Context) {
 
 func subscribeSomeone(c *gin.Context) {
 	star := c.Param("username")
-	var tempuser mingleUser
-	token, _ := c.Cookie("token")
-	if err := json.Unmarshal([]byte(token), &tempuser); err == nil {
-		res := performSubscribe(star, tempuser.Username)
-		c.JSON(http.StatusOK, res)
-	} else {
-		c.AbortWithStatus(http.StatusUnauthorized)
-		fmt.Println("subscribe fail")
+	if exist, err := isUserExist(star); err != nil {
+		abortWithInternalError(c, err)
+		return
+	} else if !exist {
+		abortWithAPIError(c, http.StatusNotFound, "The user does not exist")
+		return
 	}
+	tempuser := getCurrentUser(c)
+	switch err := performSubscribe(star, tempuser.Username); err {
+	case nil:
+	case errFollowSelf:
+		abortWithAPIError(c, http.StatusBadRequest, err.Error())
+		return
+	case errAlreadyFollowing:
+		abortWithAPIError(c, http.StatusConflict, err.Error())
+		return
+	case errBlocked:
+		abortWithAPIError(c, http.StatusForbidden, err.Error())
+		return
+	default:
+		abortWithInternalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, nil)
 }
 
 func getMyStars(c *gin.Context) {
-	var tempUser mingleUser
-	token, err := c.Cookie("token")
-	if err != nil {
-		log.Println("at getUserInfo1", err)
-		c.AbortWithError(http.StatusBadRequest, err)
-	}
-
-	err = json.Unmarshal([]byte(token), &tempUser)
-	if err != nil {
-		log.Println("at getUserInfo2", err)
-		c.AbortWithError(http.StatusBadRequest, err)
-	}
+	tempUser := getCurrentUser(c)
 
 	userInfo, err := getUserStar(tempUser.Username)
-
 	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, err)
+		abortWithInternalError(c, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, userInfo)
 }
 
 func getMyFollowers(c *gin.Context) {
-	var tempUser mingleUser
-	token, err := c.Cookie("token")
-	if err != nil {
-		log.Println("at getUserInfo1", err)
-		c.AbortWithError(http.StatusBadRequest, err)
-	}
-
-	err = json.Unmarshal([]byte(token), &tempUser)
-	if err != nil {
-		log.Println("at getUserInfo2", err)
-		c.AbortWithError(http.StatusBadRequest, err)
-	}
+	tempUser := getCurrentUser(c)
 
 	userInfo, err := getUserFollower(tempUser.Username)
-
 	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, err)
+		abortWithInternalError(c, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, userInfo)
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Test that a GET request to the login page returns
@@ -22,7 +24,7 @@ func TestShowLoginPageAuthenticated(t *testing.T) {
 	r := getRouter(true)
 
 	// Set the token cookie to simulate an authenticated user
-	http.SetCookie(w, &http.Cookie{Name: "token", Value: "123"})
+	http.SetCookie(w, getSessionCookie(t, "user1"))
 
 	// Define the route similar to its definition in the routes file
 	r.GET("/u/login", ensureNotLoggedIn(), showLoginPage)
@@ -73,7 +75,7 @@ func TestLoginAuthenticated(t *testing.T) {
 	r := getRouter(true)
 
 	// Set the token cookie to simulate an authenticated user
-	http.SetCookie(w, &http.Cookie{Name: "token", Value: "123"})
+	http.SetCookie(w, getSessionCookie(t, "user1"))
 
 	// Define the route similar to its definition in the routes file
 	r.POST("/u/login", ensureNotLoggedIn(), performLogin)
@@ -166,7 +168,7 @@ func TestShowRegistrationPageAuthenticated(t *testing.T) {
 	r := getRouter(true)
 
 	// Set the token cookie to simulate an authenticated user
-	http.SetCookie(w, &http.Cookie{Name: "token", Value: "123"})
+	http.SetCookie(w, getSessionCookie(t, "user1"))
 
 	// Define the route similar to its definition in the routes file
 	r.GET("/u/register", ensureNotLoggedIn(), showRegistrationPage)
@@ -217,7 +219,7 @@ func TestRegisterAuthenticated(t *testing.T) {
 	r := getRouter(true)
 
 	// Set the token cookie to simulate an authenticated user
-	http.SetCookie(w, &http.Cookie{Name: "token", Value: "%7B%22username%22%3A%22user1%22%2C%22password%22%3A%22pass1%22%7D"})
+	http.SetCookie(w, getSessionCookie(t, "user1"))
 
 	// Define the route similar to its definition in the routes file
 	r.POST("/u/register", ensureNotLoggedIn(), register)
@@ -261,8 +263,26 @@ func TestRegisterUnauthenticated(t *testing.T) {
 	r.ServeHTTP(w, req)
 
 	fmt.Println("TestRegisterUnauthenticated 263", w.Code)
-	// Test that the http status code is 200
-	if w.Code != http.StatusOK {
+	// Test that the http status code is 200 and that no session was started
+	// before the GatorLink is verified
+	if w.Code != http.StatusOK || len(w.Result().Cookies()) != 0 {
+		t.Fail()
+	}
+
+	// A pending account can't log in yet
+	if valid, err := isUserValid(mingleUser{Username: "u1", Password: "p1"}); valid || err != errAccountNotVerified {
+		t.Fail()
+	}
+
+	// Verify the account with the code sent to the GatorLink
+	r.POST("/u/verify", ensureNotLoggedIn(), verifyAccount)
+	verifyPayload := `{"username": "u1", "code": "` + testMailer.lastCode(t, "u1@ufl.edu") + `"}`
+	req, _ = http.NewRequest("POST", "/u/verify", strings.NewReader(verifyPayload))
+	req.Header.Add("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || len(w.Result().Cookies()) != 1 {
 		t.Fail()
 	}
 
@@ -309,6 +329,251 @@ func TestRegisterUnauthenticatedUnavailableUsername(t *testing.T) {
 	}
 }
 
+// Test that registering needs a valid gender and, when given, a valid
+// birthday, and that nothing is stored otherwise
+func TestRegisterRejectsInvalidProfile(t *testing.T) {
+	r := getRouter(true)
+	r.POST("/u/register", ensureNotLoggedIn(), register)
+
+	for payload, field := range map[string]string{
+		`{"username": "badProfile", "password": "p1", "gatorlink": "badprofile@ufl.edu"}`:                                               "gender",
+		`{"username": "badProfile", "password": "p1", "gatorlink": "badprofile@ufl.edu", "gender": "robot"}`:                            "gender",
+		`{"username": "badProfile", "password": "p1", "gatorlink": "badprofile@ufl.edu", "gender": "female", "birthday": "someday"}`:    "birthday",
+		`{"username": "badProfile", "password": "p1", "gatorlink": "badprofile@ufl.edu", "gender": "female", "birthday": "2999-01-01"}`: "birthday",
+	} {
+		req, _ := http.NewRequest("POST", "/u/register", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"`+field+`"`) {
+			t.Errorf("%s: got %d %s", payload, w.Code, w.Body)
+		}
+	}
+	if available, _ := isUsernameAvailable("badProfile"); !available {
+		t.Error("a user with an invalid profile was stored")
+	}
+}
+
+// Test that logging out revokes the session so that the cookie
+// can't be used again
+func TestLogoutRevokesSession(t *testing.T) {
+	cookie := getSessionCookie(t, "user1")
+
+	r := getRouter(true)
+	r.GET("/u/logout", ensureLoggedIn(), logout)
+
+	req, _ := http.NewRequest("GET", "/u/logout", nil)
+	req.AddCookie(cookie)
+	testHTTPResponse(t, r, req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusOK
+	})
+
+	// The same cookie is rejected after logging out
+	req, _ = http.NewRequest("GET", "/u/logout", nil)
+	req.AddCookie(cookie)
+	testHTTPResponse(t, r, req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusUnauthorized
+	})
+}
+
+// Test that PATCH /u/info rejects fields outside the whitelist and
+// leaves the user unchanged
+func TestUpdateUserInfoRejectsUneditableFields(t *testing.T) {
+	original, _ := getUserByUsername("user1")
+
+	r := getRouter(true)
+	r.PATCH("/u/info", ensureLoggedIn(), updateUserInfo)
+
+	payload := `{"gender": "female", "gatorId": "x', password='hacked"}`
+	req, _ := http.NewRequest("PATCH", "/u/info", strings.NewReader(payload))
+	req.Header.Add("Content-Type", "application/json")
+	req.AddCookie(getSessionCookie(t, "user1"))
+
+	testHTTPResponse(t, r, req, func(w *httptest.ResponseRecorder) bool {
+		var body struct {
+			Fields map[string]string `json:"fields"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code == http.StatusBadRequest && err == nil && body.Fields["gatorId"] != ""
+	})
+
+	// Nothing was written, not even the valid gender
+	updated, _ := getUserByUsername("user1")
+	if updated != original {
+		t.Fail()
+	}
+}
+
+// Test that PATCH /u/info updates whitelisted fields
+func TestUpdateUserInfo(t *testing.T) {
+	original, _ := getUserByUsername("user_mj")
+
+	r := getRouter(true)
+	r.PATCH("/u/info", ensureLoggedIn(), updateUserInfo)
+
+	req, _ := http.NewRequest("PATCH", "/u/info", strings.NewReader(`{"gender": "unknown"}`))
+	req.Header.Add("Content-Type", "application/json")
+	req.AddCookie(getSessionCookie(t, "user_mj"))
+
+	testHTTPResponse(t, r, req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusOK
+	})
+
+	updated, _ := getUserByUsername("user_mj")
+	if updated.Gender != "unknown" {
+		t.Fail()
+	}
+
+	updateUserProfile("user_mj", profileUpdate{Gender: &original.Gender})
+}
+
+// Test liking an article and clearing the reaction through the API
+func TestChangeAndClearReaction(t *testing.T) {
+	r := getRouter(true)
+	r.PATCH("/u/article/:articleId", ensureLoggedIn(), changeReaction)
+	r.DELETE("/u/article/:articleId", ensureLoggedIn(), clearReaction)
+	cookie := getSessionCookie(t, "user_mj")
+
+	changeArticleStatus("user_mj", 4, reactionNone)
+	original, _ := getArticleByID(4)
+
+	req, _ := http.NewRequest("PATCH", "/u/article/4", strings.NewReader(`{"thumbsup": 1}`))
+	req.Header.Add("Content-Type", "application/json")
+	req.AddCookie(cookie)
+	testHTTPResponse(t, r, req, func(w *httptest.ResponseRecorder) bool {
+		var body struct {
+			Likes int `json:"likes"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code == http.StatusOK && err == nil && body.Likes == original.Likes+1
+	})
+
+	// Only 0 and 1 are valid values of thumbsup
+	req, _ = http.NewRequest("PATCH", "/u/article/4", strings.NewReader(`{"thumbsup": 5}`))
+	req.Header.Add("Content-Type", "application/json")
+	req.AddCookie(cookie)
+	testHTTPResponse(t, r, req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusBadRequest
+	})
+
+	req, _ = http.NewRequest("DELETE", "/u/article/4", nil)
+	req.AddCookie(cookie)
+	testHTTPResponse(t, r, req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusOK
+	})
+
+	if status, _ := checkArticleStatus("user_mj", 4); status != reactionNone {
+		t.Fail()
+	}
+	if updated, _ := getArticleByID(4); updated.Likes != original.Likes {
+		t.Fail()
+	}
+
+	// Reacting to a missing article
+	req, _ = http.NewRequest("DELETE", "/u/article/100000", nil)
+	req.AddCookie(cookie)
+	testHTTPResponse(t, r, req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusNotFound
+	})
+}
+
+// Test the password reset through the API, and that forgot-password
+// requests are throttled without revealing which accounts exist
+func TestForgotAndResetPassword(t *testing.T) {
+	passwordResetAccountLimiter = newRateLimiter(3, time.Hour)
+	passwordResetIPLimiter = newRateLimiter(10, time.Hour)
+
+	u := user{Gatorlink: "forgetful@ufl.edu", Username: "forgetful", Password: "oldPass", Gender: "unknown"}
+	registerActiveUser(t, u)
+	defer deleteUser(u.Username)
+
+	r := getRouter(true)
+	r.POST("/u/password/forgot", forgotPassword)
+	r.POST("/u/password/reset", resetPassword)
+
+	post := func(path string, payload string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, strings.NewReader(payload))
+		req.Header.Add("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	known := post("/u/password/forgot", `{"username": "forgetful"}`)
+	unknown := post("/u/password/forgot", `{"username": "nobody"}`)
+	if known.Code != http.StatusOK || unknown.Code != http.StatusOK || known.Body.String() != unknown.Body.String() {
+		t.Errorf("got %d %s and %d %s", known.Code, known.Body, unknown.Code, unknown.Body)
+	}
+
+	// The token is the only 64 character word of the email
+	var token string
+	sent := testMailer.sent["forgetful@ufl.edu"]
+	for _, word := range strings.Fields(sent[len(sent)-1]) {
+		if len(word) == 64 {
+			token = word
+		}
+	}
+
+	if w := post("/u/password/reset", `{"token": "wrong", "new_password": "newPass"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("a wrong token got %d", w.Code)
+	}
+	if w := post("/u/password/reset", `{"token": "`+token+`", "new_password": "newPass"}`); w.Code != http.StatusOK {
+		t.Errorf("the reset failed with %d %s", w.Code, w.Body)
+	}
+	if valid, _ := isUserValid(mingleUser{Username: u.Username, Password: "newPass"}); !valid {
+		t.Error("the new password doesn't work")
+	}
+
+	// Two more requests for the account are allowed in the hour, whatever
+	// the case of the username
+	post("/u/password/forgot", `{"username": "forgetful"}`)
+	post("/u/password/forgot", `{"username": "Forgetful"}`)
+	if w := post("/u/password/forgot", `{"username": "forgetful"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("the account was not throttled: %d", w.Code)
+	}
+	// 7 requests were made from the IP so far
+	for i := 0; i < 3; i++ {
+		post("/u/password/forgot", `{"username": "someone`+strconv.Itoa(i)+`"}`)
+	}
+	if w := post("/u/password/forgot", `{"username": "someoneelse"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("the IP was not throttled: %d", w.Code)
+	}
+}
+
+// Test that a forged X-Forwarded-For doesn't escape the per-IP limit of
+// password resets, and that the header is used behind a trusted proxy
+func TestPasswordResetForwardedFor(t *testing.T) {
+	original := appConfig
+	defer func() { appConfig = original }()
+	post := func(r http.Handler, i int) int {
+		req := httptest.NewRequest("POST", "/u/password/forgot", strings.NewReader(`{"username": "someone`+strconv.Itoa(i)+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", "203.0.113."+strconv.Itoa(i))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	passwordResetIPLimiter = newRateLimiter(10, time.Hour)
+	r := getAppRouter()
+	for i := 0; i < 10; i++ {
+		post(r, i)
+	}
+	if code := post(r, 10); code != http.StatusTooManyRequests {
+		t.Errorf("a forged X-Forwarded-For escaped the limit: %d", code)
+	}
+
+	// httptest requests come from 192.0.2.1
+	passwordResetIPLimiter = newRateLimiter(10, time.Hour)
+	appConfig.TrustedProxies = []string{"192.0.2.1"}
+	r = getAppRouter()
+	for i := 0; i < 11; i++ {
+		if code := post(r, i); code != http.StatusOK {
+			t.Errorf("client %d behind the proxy got %d", i, code)
+		}
+	}
+}
+
 func getLoginPOSTPayload() string {
 	//params := url.Values{}
 	//params.Add("username", "user1")
@@ -333,8 +598,7 @@ func getRegistrationPOSTPayload() string {
 		"username": "u1",
 		"password": "p1",
 		"gender": "unknown",
-		"gatorlink": "user1@ufl.edu",
-		"gatorPW": "1111"
+		"gatorlink": "u1@ufl.edu"
 	}`
 	return testUser
 }
@@ -344,8 +608,37 @@ func getRegistrationPOSTPayloadUsedUsername() string {
 		"username": "user1",
 		"password": "p1",
 		"gender": "unknown",
-		"gatorlink": "user1@ufl.edu",
-		"gatorPW": "1111"
+		"gatorlink": "someone@ufl.edu"
 	}`
 	return testUser
 }
+
+// Test the answers of /u/subscribe for a new follow, a repeated one, the
+// user themselves and a missing user
+func TestSubscribeSomeone(t *testing.T) {
+	defer DB.Exec("DELETE FROM subscribe WHERE star = 'user_mj' AND follower = 'user2'")
+	defer DB.Exec("DELETE FROM notifications WHERE recipient = 'user_mj'")
+
+	r := getAppRouter()
+	send := func(star string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/u/subscribe/"+star, nil)
+		req.AddCookie(getSessionCookie(t, "user2"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, step := range []struct {
+		star string
+		code int
+	}{
+		{"user_mj", http.StatusOK},
+		{"user_mj", http.StatusConflict},
+		{"user2", http.StatusBadRequest},
+		{"nobodyAtAll", http.StatusNotFound},
+	} {
+		if w := send(step.star); w.Code != step.code || strings.Contains(w.Body.String(), "constraint") {
+			t.Errorf("%s: got %d %s, want %d", step.star, w.Code, w.Body, step.code)
+		}
+	}
+}
@@ -3,30 +3,107 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 var router *gin.Engine
 
+// How long in-flight requests may take to finish once a shutdown signal
+// is received
+const shutdownTimeout = 15 * time.Second
+
+// How often deleted content past the retention period is purged
+const purgeInterval = time.Hour
+
 // @title UFMingle
 // @version 2.0
 // @description An on-campus dating application
 // @termOfService https://github.com/NameNotBeenUsed/UFMingle/tree/backend_v1.0
 func main() {
-	connDBErr := ConnectDB()
+	cfg, err := loadConfig(os.Args[1:], os.LookupEnv)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(2)
+	}
+	appConfig = cfg
+	printConfig(os.Stdout, appConfig)
+
+	connDBErr := ConnectDB(appConfig.DBPath)
 	if connDBErr != nil {
 		fmt.Println(connDBErr.Error())
+		os.Exit(1)
+	}
+	defer DB.Close()
+
+	if err := run(); err != nil {
+		fmt.Println(err.Error())
+		DB.Close()
+		os.Exit(1)
+	}
+}
+
+// Prepare the database and serve requests until SIGINT or SIGTERM
+func run() error {
+	if appConfig.MigrateDryRun {
+		return printPendingMigrations(DB, os.Stdout)
+	}
+
+	// Bring the schema up to date before serving any request
+	if err := migrateDB(DB); err != nil {
+		return err
+	}
+
+	if appConfig.GrantAdmin != "" {
+		if err := setUserRole(appConfig.GrantAdmin, roleAdmin); err != nil {
+			return fmt.Errorf("grant admin to %s: %v", appConfig.GrantAdmin, err)
+		}
+		fmt.Printf("%s is now an admin\n", appConfig.GrantAdmin)
+		return nil
+	}
+
+	if appConfig.RebuildSearchIndex {
+		num, err := rebuildSearchIndex(DB)
+		if err != nil {
+			return fmt.Errorf("rebuild the search index: %v", err)
+		}
+		fmt.Printf("Indexed %d articles and comments\n", num)
+		return nil
+	}
+	if err := setupSearchIndex(DB); err == errSearchUnavailable {
+		fmt.Println("Search is disabled, build with -tags sqlite_fts5 to enable it")
+	} else if err != nil {
+		return err
+	}
+
+	for _, dir := range []string{appConfig.AvatarDir, appConfig.ImageDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
 	}
-	createTables()
+
+	m, err := newMailer(appConfig)
+	if err != nil {
+		return err
+	}
+	appMailer = m
 
 	// Set Gin to production mode
 	gin.SetMode(gin.ReleaseMode)
 
-	// Set the router as the default one provided by Gin
-	router = gin.Default()
+	// Logging and recovery are added by initializeRoutes
+	router, err = newEngine()
+	if err != nil {
+		return err
+	}
 
 	// Process the templates at the start so that they don't have to be loaded
 	// from the disk again. This makes serving HTML pages very fast.
@@ -36,7 +113,46 @@ func main() {
 	initializeRoutes()
 
 	// Start serving the application
-	router.Run()
+	ln, err := net.Listen("tcp", appConfig.ListenAddr)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Listening on", ln.Addr())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Remove the deleted content once it can't be restored anymore
+	go runPurge(ctx, appConfig.purgeRetention(), purgeInterval)
+
+	return serve(ctx, ln, router)
+}
+
+// Serve HTTP requests on ln until ctx is done, then stop accepting
+// connections and wait for the requests in flight to finish
+func serve(ctx context.Context, ln net.Listener, handler http.Handler) error {
+	server := &http.Server{Handler: handler}
+	// The event streams never finish on their own
+	server.RegisterOnShutdown(events.close)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("Shutting down, waiting for the requests in flight")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	return nil
 }
 
 // Render one of HTML, JSON or CSV based on the 'Accept' header of the request
@@ -59,3 +175,13 @@ func render(c *gin.Context, data gin.H, templateName string) {
 		c.HTML(http.StatusOK, templateName, data)
 	}
 }
+
+// Create the engine of the server. X-Forwarded-For is only used for the
+// client IP when the request comes from one of the trusted proxies
+func newEngine() (*gin.Engine, error) {
+	engine := gin.New()
+	if err := engine.SetTrustedProxies(appConfig.TrustedProxies); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
@@ -3,11 +3,33 @@
 package main
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
+// The user resolved from the session cookie by setUserStatus
+type currentUser struct {
+	Username  string
+	SessionID string
+	Role      string
+}
+
+// The roles of the accounts, from the least to the most privileged
+const (
+	roleUser      = "user"
+	roleModerator = "moderator"
+	roleAdmin     = "admin"
+)
+
+var roleRanks = map[string]int{roleUser: 0, roleModerator: 1, roleAdmin: 2}
+
+// Check if a role grants at least the privileges of another one
+func hasRole(role string, required string) bool {
+	return roleRanks[role] >= roleRanks[required]
+}
+
 // This middleware ensures that a request will be aborted with an error
 // if the user is not logged in
 func ensureLoggedIn() gin.HandlerFunc {
@@ -16,14 +38,15 @@ func ensureLoggedIn() gin.HandlerFunc {
 		// the user is not logged in
 		loggedInInterface, _ := c.Get("is_logged_in")
 		loggedIn := loggedInInterface.(bool)
+		_, hasUser := c.Get("current_user")
 
 		//fmt.Println("Print at ensureLoggedIn()")
 		//fmt.Println(loggedIn)
 
-		if !loggedIn {
+		if !loggedIn || !hasUser {
 			//if token, err := c.Cookie("token"); err != nil || token == "" {
 
-			c.AbortWithStatus(http.StatusUnauthorized)
+			abortWithAPIError(c, http.StatusUnauthorized, "You need to log in")
 			//articles, err := getAllArticles()
 			//if err != nil {
 			//	log.Fatal(err)
@@ -51,20 +74,80 @@ func ensureNotLoggedIn() gin.HandlerFunc {
 
 		if loggedIn {
 			//if token, err := c.Cookie("token"); err == nil || token != "" {
-			c.AbortWithStatus(http.StatusUnauthorized)
+			abortWithAPIError(c, http.StatusUnauthorized, "You are already logged in")
 			//c.JSON(http.StatusUnauthorized, `"message": "User is already logged in."`)
 			//}
 		}
 	}
 }
 
-// This middleware sets whether the user is logged in or not
+// This middleware sets whether the user is logged in or not.
+// The "token" cookie must hold the ID of a session that is neither expired
+// nor revoked; the owner of the session is stored as "current_user"
 func setUserStatus() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if token, err := c.Cookie("token"); err == nil || token != "" {
-			c.Set("is_logged_in", true)
-		} else {
-			c.Set("is_logged_in", false)
+		c.Set("is_logged_in", false)
+
+		token, err := c.Cookie("token")
+		if err != nil || token == "" {
+			return
+		}
+
+		s, err := getActiveSession(token)
+		if err != nil {
+			if err != errInvalidSession {
+				log.Println(err)
+			}
+			return
+		}
+
+		if err := setCurrentUser(c, s); err != nil {
+			log.Println(err)
 		}
 	}
 }
+
+// Mark the request as made by the owner of the session, with the current
+// role of the account
+func setCurrentUser(c *gin.Context, s session) error {
+	role, err := getUserRole(s.Username)
+	if err != nil {
+		return err
+	}
+	c.Set("is_logged_in", true)
+	c.Set("current_user", currentUser{Username: s.Username, SessionID: s.ID, Role: role})
+	return nil
+}
+
+// This middleware ensures that a request will be aborted with an error if
+// the role of the user is below the given one. It must come after
+// ensureLoggedIn
+func ensureRole(required string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasRole(getCurrentUser(c).Role, required) {
+			abortWithAPIError(c, http.StatusForbidden, "You are not allowed to do this")
+		}
+	}
+}
+
+// Check if the user may modify or delete a resource of the owner: only the
+// owner and moderators can. A resource without owner is left to moderators
+func canModify(u currentUser, owner string) bool {
+	return (owner != "" && u.Username == owner) || hasRole(u.Role, roleModerator)
+}
+
+// Abort with 403 unless the current user may modify a resource of the owner.
+// Returns false if the handler must return
+func ensureCanModify(c *gin.Context, owner string) bool {
+	if !canModify(getCurrentUser(c), owner) {
+		abortWithAPIError(c, http.StatusForbidden, "Only the owner or a moderator can do this")
+		return false
+	}
+	return true
+}
+
+// Return the user set by setUserStatus. Only call this from handlers
+// behind ensureLoggedIn
+func getCurrentUser(c *gin.Context) currentUser {
+	return c.MustGet("current_user").(currentUser)
+}
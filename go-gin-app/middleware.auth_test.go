@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -79,13 +80,16 @@ func TestSetUserStatusAuthenticated(t *testing.T) {
 		if !exists || !loggedInInterface.(bool) {
 			t.Fail()
 		}
+		if getCurrentUser(c).Username != "user1" {
+			t.Fail()
+		}
 	})
 
 	// Create a response recorder
 	w := httptest.NewRecorder()
 
-	// Set the cookie
-	http.SetCookie(w, &http.Cookie{Name: "token", Value: "123"})
+	// Set the cookie of a freshly created session
+	http.SetCookie(w, getSessionCookie(t, "user1"))
 
 	// Create a request to send to the above route
 	req, _ := http.NewRequest("GET", "/", nil)
@@ -117,10 +121,88 @@ func TestSetUserStatusUnauthenticated(t *testing.T) {
 	r.ServeHTTP(w, req)
 }
 
+// Test that setUserStatus rejects session IDs that are unknown, expired
+// or revoked
+func TestSetUserStatusInvalidSession(t *testing.T) {
+	expired := getSessionCookie(t, "user1")
+	if _, err := DB.Exec("UPDATE sessions SET expires_at = ? WHERE session_id = ?", time.Now().UTC().Add(-time.Minute), expired.Value); err != nil {
+		t.Fatal(err)
+	}
+
+	revoked := getSessionCookie(t, "user1")
+	if err := revokeSession(revoked.Value); err != nil {
+		t.Fatal(err)
+	}
+
+	unknown := &http.Cookie{Name: "token", Value: "123"}
+
+	for _, cookie := range []*http.Cookie{unknown, expired, revoked} {
+		r := getRouter(false)
+		r.GET("/", setUserStatus(), ensureLoggedIn(), func(c *gin.Context) {
+			// The session is not valid, so this handler should not be executed
+			t.Fail()
+		})
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.AddCookie(cookie)
+
+		testHTTPResponse(t, r, req, func(w *httptest.ResponseRecorder) bool {
+			return w.Code == http.StatusUnauthorized
+		})
+	}
+}
+
+// Test that ensureRole only lets users with at least the role through
+func TestEnsureRole(t *testing.T) {
+	for _, tc := range []struct {
+		role     string
+		required string
+		code     int
+	}{
+		{roleUser, roleModerator, http.StatusForbidden},
+		{"", roleModerator, http.StatusForbidden},
+		{roleModerator, roleModerator, http.StatusOK},
+		{roleAdmin, roleModerator, http.StatusOK},
+		{roleModerator, roleAdmin, http.StatusForbidden},
+	} {
+		r := getRouter(false)
+		r.GET("/", func(c *gin.Context) {
+			c.Set("is_logged_in", true)
+			c.Set("current_user", currentUser{Username: "user1", Role: tc.role})
+		}, ensureLoggedIn(), ensureRole(tc.required), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		testMiddlewareRequest(t, r, tc.code)
+	}
+}
+
+// Test that the role of the account is read with the session
+func TestSetUserStatusRole(t *testing.T) {
+	setUserRole("user_rl", roleModerator)
+	defer setUserRole("user_rl", roleUser)
+
+	r := getRouter(false)
+	r.GET("/", setUserStatus(), ensureLoggedIn(), func(c *gin.Context) {
+		if getCurrentUser(c).Role != roleModerator {
+			t.Error(getCurrentUser(c))
+		}
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.AddCookie(getSessionCookie(t, "user_rl"))
+	testHTTPResponse(t, r, req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusOK
+	})
+}
+
 // This is a middleware that will set the value of "is_logged_in" to
 // true or false depending on the value passed in. This is used only for testing
 func setLoggedIn(b bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Set("is_logged_in", b)
+		if b {
+			c.Set("current_user", currentUser{Username: "user1"})
+		}
 	}
 }
@@ -0,0 +1,120 @@
+// middleware.error.go
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// A request ID sent by a proxy is kept if it looks harmless in a log line
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Hold back the header of a response that was aborted without a body, so
+// that handleErrors can still write a JSON body for it
+type errorBodyWriter struct {
+	gin.ResponseWriter
+}
+
+func (w *errorBodyWriter) WriteHeaderNow() {}
+
+// This middleware gives every request an ID, recovers from panics and turns
+// a response that was aborted without a body into an apiError body
+func handleErrors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = generateRequestID()
+		}
+		c.Set("request_id", requestID)
+		c.Header(requestIDHeader, requestID)
+
+		writer := &errorBodyWriter{c.Writer}
+		c.Writer = writer
+		defer func() {
+			c.Writer = writer.ResponseWriter
+		}()
+
+		defer func() {
+			if r := recover(); r != nil {
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+				log.Printf("[%s] panic: %v\n%s", requestID, r, debug.Stack())
+				if writer.Written() {
+					c.Abort()
+					return
+				}
+				c.Status(http.StatusInternalServerError)
+				writeErrorBody(c)
+				c.Abort()
+			}
+		}()
+
+		c.Next()
+
+		if !writer.Written() && writer.Status() >= 400 {
+			writeErrorBody(c)
+		}
+	}
+}
+
+// Write the apiError body for the status of the response. Client errors
+// show the last error of the handler, server errors are only logged
+func writeErrorBody(c *gin.Context) {
+	status := c.Writer.Status()
+	requestID := getRequestID(c)
+
+	message := http.StatusText(status)
+	if status >= 500 {
+		for _, err := range c.Errors {
+			log.Printf("[%s] %s %s: %v", requestID, c.Request.Method, c.Request.URL.Path, err.Err)
+		}
+		message = "Internal server error"
+	} else if err := c.Errors.Last(); err != nil {
+		message = err.Error()
+	}
+
+	c.JSON(status, apiError{Code: getAPIErrorCode(status), Message: message, RequestID: requestID})
+}
+
+// Return the ID given to the request by handleErrors
+func getRequestID(c *gin.Context) string {
+	return c.GetString("request_id")
+}
+
+// Generate a request ID from 8 bytes of crypto/rand
+func generateRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// The gin logger with the request ID of every line
+func requestLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		requestID, _ := param.Keys["request_id"].(string)
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v | %s\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			param.StatusCode,
+			param.Latency,
+			param.ClientIP,
+			param.Method,
+			param.Path,
+			requestID,
+			param.ErrorMessage,
+		)
+	})
+}
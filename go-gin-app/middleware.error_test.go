@@ -0,0 +1,105 @@
+// middleware.error_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Helper function to create a router with the error middleware
+func getErrorRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(handleErrors())
+	r.GET("/ok", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"message": "ok"}) })
+	r.GET("/notfound", func(c *gin.Context) { c.AbortWithStatus(http.StatusNotFound) })
+	r.GET("/bad", func(c *gin.Context) { c.AbortWithError(http.StatusBadRequest, errors.New("bad input")) })
+	r.GET("/internal", func(c *gin.Context) {
+		c.AbortWithError(http.StatusInternalServerError, errors.New("no such table: secret"))
+	})
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+	return r
+}
+
+// Helper function to send a GET request and decode the error body
+func getErrorResponse(t *testing.T, r *gin.Engine, path string, requestID string) (*httptest.ResponseRecorder, apiError) {
+	req, _ := http.NewRequest("GET", path, nil)
+	if requestID != "" {
+		req.Header.Set(requestIDHeader, requestID)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var body apiError
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w, body
+}
+
+// Test that aborted requests get an apiError body with the request ID
+func TestHandleErrorsWritesJSONBody(t *testing.T) {
+	r := getErrorRouter()
+
+	w, body := getErrorResponse(t, r, "/notfound", "")
+	if w.Code != http.StatusNotFound || body.Code != "not_found" || body.Message != "Not Found" || body.RequestID == "" || w.Header().Get(requestIDHeader) != body.RequestID {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+
+	w, body = getErrorResponse(t, r, "/bad", "")
+	if w.Code != http.StatusBadRequest || body.Code != "bad_request" || body.Message != "bad input" {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+
+	// The details of server errors are only logged
+	w, body = getErrorResponse(t, r, "/internal", "")
+	if w.Code != http.StatusInternalServerError || body.Code != "internal_error" || body.Message != "Internal server error" {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+
+	// Successful responses are left alone
+	w, _ = getErrorResponse(t, r, "/ok", "")
+	if w.Code != http.StatusOK || w.Body.String() != `{"message":"ok"}` {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+}
+
+// Test that a panic is answered with a 500 instead of killing the server
+func TestHandleErrorsRecoversPanics(t *testing.T) {
+	r := getErrorRouter()
+
+	w, body := getErrorResponse(t, r, "/panic", "")
+	if w.Code != http.StatusInternalServerError || body.Code != "internal_error" || body.Message != "Internal server error" || body.RequestID == "" {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+
+	w, _ = getErrorResponse(t, r, "/ok", "")
+	if w.Code != http.StatusOK {
+		t.Fail()
+	}
+}
+
+// Test that a request ID from a proxy is kept only if it is well formed
+func TestHandleErrorsRequestID(t *testing.T) {
+	r := getErrorRouter()
+
+	_, body := getErrorResponse(t, r, "/notfound", "proxy-id.123")
+	if body.RequestID != "proxy-id.123" {
+		t.Fail()
+	}
+
+	_, body = getErrorResponse(t, r, "/notfound", "bad id\nwith a newline")
+	if body.RequestID == "" || body.RequestID == "bad id\nwith a newline" {
+		t.Fail()
+	}
+
+	// Every request gets its own ID
+	_, first := getErrorResponse(t, r, "/notfound", "")
+	_, second := getErrorResponse(t, r, "/notfound", "")
+	if first.RequestID == second.RequestID {
+		t.Fail()
+	}
+}
@@ -0,0 +1,52 @@
+-- The schema created by the old createTables functions. Every statement is
+-- IF NOT EXISTS so that databases created before schema_version existed
+-- are adopted as they are.
+
+CREATE TABLE IF NOT EXISTS gatorlink(
+	gatorId  TEXT PRIMARY KEY NOT NULL,
+	password TEXT             NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS users(
+	username      TEXT PRIMARY KEY NOT NULL,
+	password      TEXT             NOT NULL,
+	gatorId       TEXT             NOT NULL,
+	birthday      date             default (date('2020-12-30')),
+	gender        TEXT             default 'unknown' check(gender = 'male' or gender = 'female' or gender = 'unknown'),
+	profile_photo TEXT             default 'test.jpg',
+	like_list     TEXT             default '',
+	dislike_list  TEXT             default '',
+	foreign key (gatorId) references gatorlink(gatorId)
+);
+
+CREATE TABLE IF NOT EXISTS articles(
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	author    TEXT      NOT NULL,
+	title     TEXT      NOT NULL,
+	post_time timestamp default (CURRENT_TIMESTAMP),
+	content   TEXT      NOT NULL,
+	likes     INTEGER   default 0,
+	dislikes  INTEGER   default 0,
+	FOREIGN KEY (author) REFERENCES users(username)
+);
+
+CREATE TABLE IF NOT EXISTS comment(
+	comment_id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	topic_id        INTEGER NOT NULL,
+	comment_user    TEXT    NOT NULL,
+	comment_content TEXT    NOT NULL,
+	comment_time    timestamp default (CURRENT_TIMESTAMP),
+	likes           INTEGER default 0,
+	dislikes        INTEGER default 0,
+	foreign key (topic_id) references articles(id),
+	foreign key (comment_user) references users(username)
+);
+
+CREATE TABLE IF NOT EXISTS subscribe(
+	star     TEXT NOT NULL,
+	follower TEXT NOT NULL,
+	CONSTRAINT p_key PRIMARY KEY (star, follower),
+	foreign key (star) references users(username),
+	foreign key (follower) references users(username),
+	check(star != follower)
+);
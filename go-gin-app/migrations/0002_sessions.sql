@@ -0,0 +1,10 @@
+-- Server-side sessions, referenced by the "token" cookie
+
+CREATE TABLE IF NOT EXISTS sessions(
+	session_id TEXT PRIMARY KEY NOT NULL,
+	username   TEXT NOT NULL,
+	created_at timestamp default (CURRENT_TIMESTAMP),
+	expires_at timestamp NOT NULL,
+	revoked_at timestamp,
+	foreign key (username) references users(username)
+);
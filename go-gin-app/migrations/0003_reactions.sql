@@ -0,0 +1,32 @@
+-- One row per reaction of a user to an article or a comment. The
+-- comma-separated users.like_list/dislike_list columns are moved into it and
+-- emptied, and the counters of every article are recounted.
+
+CREATE TABLE IF NOT EXISTS reactions(
+	username    TEXT    NOT NULL,
+	target_type TEXT    NOT NULL check(target_type = 'article' or target_type = 'comment'),
+	target_id   INTEGER NOT NULL,
+	kind        TEXT    NOT NULL check(kind = 'like' or kind = 'dislike'),
+	created_at  timestamp default (CURRENT_TIMESTAMP),
+	CONSTRAINT reaction_key UNIQUE (username, target_type, target_id),
+	foreign key (username) references users(username)
+);
+
+CREATE INDEX IF NOT EXISTS reactions_target ON reactions(target_type, target_id, kind);
+
+WITH RECURSIVE split(username, kind, rest, id) AS (
+	SELECT username, 'like', like_list || ',', '' FROM users WHERE like_list IS NOT NULL AND like_list != ''
+	UNION ALL
+	SELECT username, 'dislike', dislike_list || ',', '' FROM users WHERE dislike_list IS NOT NULL AND dislike_list != ''
+	UNION ALL
+	SELECT username, kind, substr(rest, instr(rest, ',') + 1), trim(substr(rest, 1, instr(rest, ',') - 1)) FROM split WHERE rest != ''
+)
+INSERT OR IGNORE INTO reactions (username, target_type, target_id, kind)
+SELECT username, 'article', CAST(id AS INTEGER), kind FROM split
+WHERE id != '' AND CAST(id AS INTEGER) IN (SELECT id FROM articles);
+
+UPDATE users SET like_list = '', dislike_list = '' WHERE like_list != '' OR dislike_list != '';
+
+UPDATE articles SET
+	likes = (SELECT COUNT(*) FROM reactions WHERE target_type = 'article' AND target_id = articles.id AND kind = 'like'),
+	dislikes = (SELECT COUNT(*) FROM reactions WHERE target_type = 'article' AND target_id = articles.id AND kind = 'dislike');
@@ -0,0 +1,27 @@
+-- createArticleTable used to declare the author column as "austhor", while
+-- its foreign key and every query use "author". Rebuild the table with the
+-- right name. The rows are copied by position, so this works whichever name
+-- the column has, and the AUTOINCREMENT counter is carried over so that the
+-- IDs of deleted articles are not handed out again.
+
+CREATE TABLE articles_new(
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	author    TEXT      NOT NULL,
+	title     TEXT      NOT NULL,
+	post_time timestamp default (CURRENT_TIMESTAMP),
+	content   TEXT      NOT NULL,
+	likes     INTEGER   default 0,
+	dislikes  INTEGER   default 0,
+	FOREIGN KEY (author) REFERENCES users(username)
+);
+
+INSERT INTO articles_new (id, author, title, post_time, content, likes, dislikes)
+SELECT * FROM articles;
+
+DELETE FROM sqlite_sequence WHERE name = 'articles_new';
+INSERT INTO sqlite_sequence (name, seq)
+SELECT 'articles_new', max(IFNULL((SELECT seq FROM sqlite_sequence WHERE name = 'articles'), 0), IFNULL((SELECT MAX(id) FROM articles_new), 0));
+
+DROP TABLE articles;
+
+ALTER TABLE articles_new RENAME TO articles;
@@ -0,0 +1,19 @@
+-- Accounts are created as pending and only become active once the code sent
+-- to their GatorLink address is entered. Existing accounts stay active.
+--
+-- Only one active account may use a GatorLink. Some existing GatorLinks
+-- already back several accounts, so this is enforced when an account is
+-- activated rather than by a unique index.
+
+ALTER TABLE users ADD COLUMN status TEXT NOT NULL DEFAULT 'active' check(status = 'pending' or status = 'active');
+
+CREATE INDEX IF NOT EXISTS users_gatorid ON users(gatorId, status);
+
+CREATE TABLE IF NOT EXISTS email_verifications(
+	username   TEXT PRIMARY KEY NOT NULL,
+	code_hash  TEXT NOT NULL,
+	attempts   INTEGER NOT NULL default 0,
+	created_at timestamp NOT NULL,
+	expires_at timestamp NOT NULL,
+	foreign key (username) references users(username)
+);
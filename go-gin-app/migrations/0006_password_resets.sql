@@ -0,0 +1,13 @@
+-- One-time tokens emailed to the GatorLink of an account to reset its
+-- password. Only the SHA-256 of a token is stored
+
+CREATE TABLE IF NOT EXISTS password_resets(
+	token_hash TEXT PRIMARY KEY NOT NULL,
+	username   TEXT NOT NULL,
+	created_at timestamp NOT NULL,
+	expires_at timestamp NOT NULL,
+	used_at    timestamp,
+	foreign key (username) references users(username)
+);
+
+CREATE INDEX IF NOT EXISTS password_resets_username ON password_resets(username);
@@ -0,0 +1,17 @@
+-- Every account has a role. Moderators and admins may modify or delete the
+-- content of other users, only admins may change roles
+
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user' check(role = 'user' or role = 'moderator' or role = 'admin');
+
+-- The owner of each file uploaded to the image directory. Files uploaded
+-- before this table existed have no row and can only be deleted by
+-- moderators
+
+CREATE TABLE IF NOT EXISTS images(
+	filename    TEXT PRIMARY KEY NOT NULL,
+	owner       TEXT NOT NULL,
+	uploaded_at timestamp NOT NULL,
+	foreign key (owner) references users(username)
+);
+
+CREATE INDEX IF NOT EXISTS images_owner ON images(owner);
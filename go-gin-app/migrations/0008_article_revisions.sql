@@ -0,0 +1,15 @@
+-- The previous title and content of an article, saved every time it is
+-- edited
+
+CREATE TABLE IF NOT EXISTS article_revisions(
+	revision_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	article_id  INTEGER NOT NULL,
+	title       TEXT NOT NULL,
+	content     TEXT NOT NULL,
+	edited_at   timestamp NOT NULL,
+	edited_by   TEXT NOT NULL,
+	foreign key (article_id) references articles(id),
+	foreign key (edited_by) references users(username)
+);
+
+CREATE INDEX IF NOT EXISTS article_revisions_article ON article_revisions(article_id, revision_id);
@@ -0,0 +1,20 @@
+-- Deleted articles, comments and accounts are only marked as deleted, so
+-- that moderators can restore them, and are removed for good by the purge
+-- once the retention period is over.
+--
+-- Deleting an article or an account also marks the content under it with
+-- the same deleted_at, so that restoring it brings that content back too.
+-- A deleted account keeps its username and GatorLink until it is purged.
+
+ALTER TABLE articles ADD COLUMN deleted_at timestamp;
+ALTER TABLE articles ADD COLUMN deleted_by TEXT;
+
+ALTER TABLE comment ADD COLUMN deleted_at timestamp;
+ALTER TABLE comment ADD COLUMN deleted_by TEXT;
+
+ALTER TABLE users ADD COLUMN deleted_at timestamp;
+ALTER TABLE users ADD COLUMN deleted_by TEXT;
+
+CREATE INDEX IF NOT EXISTS articles_deleted_at ON articles(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS comment_deleted_at ON comment(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
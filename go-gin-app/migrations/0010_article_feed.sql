@@ -0,0 +1,5 @@
+-- Indexes for the paginated article feed: the newest articles first, and
+-- the number of comments of each article
+
+CREATE INDEX IF NOT EXISTS articles_post_time ON articles(post_time, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS comment_topic ON comment(topic_id) WHERE deleted_at IS NULL;
@@ -0,0 +1,6 @@
+-- A comment can reply to another comment of the same article. Top-level
+-- comments have no parent.
+
+ALTER TABLE comment ADD COLUMN parent_comment_id INTEGER REFERENCES comment(comment_id);
+
+CREATE INDEX IF NOT EXISTS comment_parent ON comment(parent_comment_id) WHERE parent_comment_id IS NOT NULL;
@@ -0,0 +1,3 @@
+-- When the content of a comment was last changed, NULL if it never was
+
+ALTER TABLE comment ADD COLUMN edited_at timestamp;
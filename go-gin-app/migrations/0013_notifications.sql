@@ -0,0 +1,26 @@
+-- What happened to the content and account of a user: comments on their
+-- articles, replies to their comments, likes and new followers. The kinds a
+-- user muted in notification_mutes are not recorded.
+
+CREATE TABLE IF NOT EXISTS notifications(
+	notification_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	recipient       TEXT NOT NULL,
+	kind            TEXT NOT NULL,
+	actor           TEXT NOT NULL,
+	article_id      INTEGER,
+	comment_id      INTEGER,
+	created_at      timestamp NOT NULL,
+	read_at         timestamp,
+	foreign key (recipient) references users(username),
+	foreign key (actor) references users(username)
+);
+
+CREATE INDEX IF NOT EXISTS notifications_recipient ON notifications(recipient, notification_id);
+CREATE INDEX IF NOT EXISTS notifications_unread ON notifications(recipient) WHERE read_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS notification_mutes(
+	username TEXT NOT NULL,
+	kind     TEXT NOT NULL,
+	CONSTRAINT notification_mute_key PRIMARY KEY (username, kind),
+	foreign key (username) references users(username)
+);
@@ -0,0 +1,50 @@
+-- Private conversations between two users, and the users each user blocked.
+-- user_a is the smaller username so that a pair has one conversation. Each
+-- member remembers the last message they read.
+
+CREATE TABLE IF NOT EXISTS conversations(
+	conversation_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_a          TEXT NOT NULL,
+	user_b          TEXT NOT NULL,
+	created_at      timestamp NOT NULL,
+	CONSTRAINT conversation_pair UNIQUE (user_a, user_b),
+	check(user_a < user_b),
+	foreign key (user_a) references users(username),
+	foreign key (user_b) references users(username)
+);
+
+CREATE TABLE IF NOT EXISTS conversation_members(
+	conversation_id INTEGER NOT NULL,
+	username        TEXT NOT NULL,
+	last_read_id    INTEGER NOT NULL default 0,
+	CONSTRAINT conversation_member_key PRIMARY KEY (conversation_id, username),
+	foreign key (conversation_id) references conversations(conversation_id),
+	foreign key (username) references users(username)
+);
+
+CREATE INDEX IF NOT EXISTS conversation_members_user ON conversation_members(username);
+
+CREATE TABLE IF NOT EXISTS messages(
+	message_id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	conversation_id INTEGER NOT NULL,
+	sender          TEXT NOT NULL,
+	content         TEXT NOT NULL,
+	image           TEXT,
+	sent_at         timestamp NOT NULL,
+	foreign key (conversation_id) references conversations(conversation_id),
+	foreign key (sender) references users(username)
+);
+
+CREATE INDEX IF NOT EXISTS messages_conversation ON messages(conversation_id, message_id);
+
+CREATE TABLE IF NOT EXISTS blocks(
+	blocker    TEXT NOT NULL,
+	blocked    TEXT NOT NULL,
+	created_at timestamp NOT NULL,
+	CONSTRAINT block_key PRIMARY KEY (blocker, blocked),
+	check(blocker != blocked),
+	foreign key (blocker) references users(username),
+	foreign key (blocked) references users(username)
+);
+
+CREATE INDEX IF NOT EXISTS blocks_blocked ON blocks(blocked);
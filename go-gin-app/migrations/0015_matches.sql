@@ -0,0 +1,28 @@
+-- The interest or pass of a user on the profile of another user, and the
+-- matches made when two users are interested in each other. user_a is the
+-- smaller username so that a pair has one match.
+
+CREATE TABLE IF NOT EXISTS interests(
+	username   TEXT NOT NULL,
+	target     TEXT NOT NULL,
+	kind       TEXT NOT NULL check(kind = 'interest' or kind = 'pass'),
+	created_at timestamp NOT NULL,
+	CONSTRAINT interest_key PRIMARY KEY (username, target),
+	check(username != target),
+	foreign key (username) references users(username),
+	foreign key (target) references users(username)
+);
+
+CREATE INDEX IF NOT EXISTS interests_target ON interests(target, kind);
+
+CREATE TABLE IF NOT EXISTS matches(
+	user_a     TEXT NOT NULL,
+	user_b     TEXT NOT NULL,
+	matched_at timestamp NOT NULL,
+	CONSTRAINT match_key PRIMARY KEY (user_a, user_b),
+	check(user_a < user_b),
+	foreign key (user_a) references users(username),
+	foreign key (user_b) references users(username)
+);
+
+CREATE INDEX IF NOT EXISTS matches_user_b ON matches(user_b);
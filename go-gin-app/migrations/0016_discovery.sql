@@ -0,0 +1,15 @@
+-- The major and graduation year of a user, and who each user wants to see
+-- in GET /u/discover. Users without preferences see everyone from 18 to 99.
+
+ALTER TABLE users ADD COLUMN major TEXT;
+ALTER TABLE users ADD COLUMN grad_year INTEGER;
+
+CREATE TABLE IF NOT EXISTS discover_preferences(
+	username      TEXT PRIMARY KEY NOT NULL,
+	interested_in TEXT NOT NULL default 'everyone' check(interested_in = 'male' or interested_in = 'female' or interested_in = 'everyone'),
+	min_age       INTEGER NOT NULL default 18,
+	max_age       INTEGER NOT NULL default 99,
+	major         TEXT,
+	grad_year     INTEGER,
+	foreign key (username) references users(username)
+);
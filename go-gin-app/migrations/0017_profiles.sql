@@ -0,0 +1,30 @@
+-- The public profile of a user: a bio, pronouns, tags and a gallery of
+-- uploaded images, and who may see each field of it. Fields without a
+-- visibility row are public
+
+ALTER TABLE users ADD COLUMN bio TEXT;
+ALTER TABLE users ADD COLUMN pronouns TEXT;
+
+CREATE TABLE IF NOT EXISTS profile_tags(
+	username TEXT NOT NULL,
+	tag      TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	PRIMARY KEY (username, tag),
+	foreign key (username) references users(username)
+);
+
+CREATE TABLE IF NOT EXISTS profile_photos(
+	username TEXT NOT NULL,
+	filename TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	PRIMARY KEY (username, filename),
+	foreign key (username) references users(username)
+);
+
+CREATE TABLE IF NOT EXISTS profile_visibility(
+	username   TEXT NOT NULL,
+	field      TEXT NOT NULL,
+	visibility TEXT NOT NULL check(visibility = 'public' or visibility = 'followers' or visibility = 'matches'),
+	PRIMARY KEY (username, field),
+	foreign key (username) references users(username)
+);
@@ -4,7 +4,9 @@ package main
 
 import (
 	"database/sql"
-	"strconv"
+	"errors"
+	"strings"
+	"time"
 )
 
 type article struct {
@@ -41,7 +43,7 @@ type article struct {
 // Return a list of all the articles
 func getAllArticles() ([]article, error) {
 	//return articleList
-	rows, err := DB.Query("SELECT id, author, title, post_time, content, likes, dislikes from articles")
+	rows, err := DB.Query("SELECT id, author, title, post_time, content, likes, dislikes from articles WHERE deleted_at IS NULL")
 	//fmt.Println("getAllArticles")
 	//fmt.Println(err)
 	if err != nil {
@@ -55,40 +57,10 @@ func getAllArticles() ([]article, error) {
 	for rows.Next() {
 		singleArticle := article{}
 		err = rows.Scan(&singleArticle.ID, &singleArticle.Author, &singleArticle.Title, &singleArticle.PostTime, &singleArticle.Content, &singleArticle.Likes, &singleArticle.Dislikes)
-		checkErr(err)
-		articleResult = append(articleResult, singleArticle)
-	}
-
-	err = rows.Err()
-
-	if err != nil {
-		return nil, err
-	}
-
-	return articleResult, err
-}
-
-// Get number count of articles
-// 刷新页面用
-func getArticles(count int) ([]article, error) {
-	rows, err := DB.Query("SELECT id, author, title, post_time, content, likes, dislikes from articles LIMIT" + strconv.Itoa(count))
-	if err != nil {
-		return nil, err
-	}
-
-	defer rows.Close()
-
-	articleResults := make([]article, 0)
-
-	for rows.Next() {
-		singleArticle := article{}
-		err = rows.Scan(&singleArticle.ID, &singleArticle.Author, &singleArticle.Title, &singleArticle.PostTime, &singleArticle.Content, &singleArticle.Likes, &singleArticle.Dislikes)
-
 		if err != nil {
 			return nil, err
 		}
-
-		articleResults = append(articleResults, singleArticle)
+		articleResult = append(articleResult, singleArticle)
 	}
 
 	err = rows.Err()
@@ -97,11 +69,11 @@ func getArticles(count int) ([]article, error) {
 		return nil, err
 	}
 
-	return articleResults, err
+	return articleResult, err
 }
 
 func getArticlesByUser(username string) ([]article, error) {
-	rows, err := DB.Query("SELECT id, author, title, post_time, content, likes, dislikes from articles WHERE author = ?", username)
+	rows, err := DB.Query("SELECT id, author, title, post_time, content, likes, dislikes from articles WHERE author = ? AND deleted_at IS NULL", username)
 	if err != nil {
 		return nil, err
 	}
@@ -136,7 +108,7 @@ func getArticleByID(id int) (article, error) {
 	//	}
 	//}
 
-	stmt, err := DB.Prepare("SELECT id, author, title, post_time, content, likes, dislikes from articles WHERE id = ?")
+	stmt, err := DB.Prepare("SELECT id, author, title, post_time, content, likes, dislikes from articles WHERE id = ? AND deleted_at IS NULL")
 	if err != nil {
 		return article{}, err
 	}
@@ -157,7 +129,7 @@ func getArticleByID(id int) (article, error) {
 }
 
 // Create a new article with the title and content provided
-func createNewArticle(newArticle article, user mingleUser) (int64, error) {
+func createNewArticle(newArticle article, username string) (int64, error) {
 	//// Set the ID of a new article to one more than the number of articles
 	//a := article{ID: len(articleList) + 1, Author: author, Title: title, Content: content}
 	//
@@ -165,7 +137,7 @@ func createNewArticle(newArticle article, user mingleUser) (int64, error) {
 	//articleList = append(articleList, a)
 	//
 	//return &a, nil
-	res, er := isUserValid(user)
+	res, er := isUserExist(username)
 	if !res {
 		return 0, er
 	}
@@ -182,7 +154,7 @@ func createNewArticle(newArticle article, user mingleUser) (int64, error) {
 
 	defer stmt.Close()
 
-	result, execErr := stmt.Exec(user.Username, newArticle.Title, newArticle.Content)
+	result, execErr := stmt.Exec(username, newArticle.Title, newArticle.Content)
 	if execErr != nil {
 		tx.Commit()
 		return 0, execErr
@@ -193,92 +165,180 @@ func createNewArticle(newArticle article, user mingleUser) (int64, error) {
 	}
 	tx.Commit()
 
+	// Push the article to the users online
+	if id, err := result.LastInsertId(); err == nil {
+		if a, err := getArticleByID(int(id)); err == nil {
+			events.publish(event{Type: eventArticle, Data: a})
+		}
+	}
 	return num, nil
 }
 
-func deleteArticleById(id int) (int64, error) {
+// The fields changed by PATCH /article/:article_id, a nil field is left
+// unchanged
+type articleUpdate struct {
+	Title   *string `json:"title"`
+	Content *string `json:"content"`
+}
+
+// A previous version of an article
+type articleRevision struct {
+	ID       int    `json:"id"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	EditedAt string `json:"editedAt"`
+	EditedBy string `json:"editedBy"`
+}
+
+var (
+	errEmptyArticleUpdate = errors.New("Nothing to change, send a title and/or a content")
+	errEmptyTitle         = errors.New("The title can't be empty")
+	errEmptyContent       = errors.New("The content can't be empty")
+)
+
+// Check an update before it is applied, mapping each rejected field to
+// the reason
+func (u articleUpdate) validate() map[string]string {
+	fields := map[string]string{}
+	if u.Title == nil && u.Content == nil {
+		fields["title"] = errEmptyArticleUpdate.Error()
+	}
+	if u.Title != nil && strings.TrimSpace(*u.Title) == "" {
+		fields["title"] = errEmptyTitle.Error()
+	}
+	if u.Content != nil && strings.TrimSpace(*u.Content) == "" {
+		fields["content"] = errEmptyContent.Error()
+	}
+	return fields
+}
+
+// Edit an article, saving its previous title and content as a revision.
+// Returns sql.ErrNoRows if the article does not exist
+func updateArticle(id int, update articleUpdate, editor string) (article, error) {
 	tx, err := DB.Begin()
 	if err != nil {
-		return 0, err
+		return article{}, err
 	}
+	defer tx.Rollback()
 
-	stmt, err := DB.Prepare("DELETE from articles where id = ?")
-	if err != nil {
-		return 0, err
+	var title, content string
+	if err := tx.QueryRow("SELECT title, content FROM articles WHERE id = ? AND deleted_at IS NULL", id).Scan(&title, &content); err != nil {
+		return article{}, err
 	}
-	defer stmt.Close()
 
-	result, err := stmt.Exec(id)
+	if _, err := tx.Exec("INSERT INTO article_revisions (article_id, title, content, edited_at, edited_by) VALUES (?, ?, ?, ?, ?)",
+		id, title, content, time.Now().UTC(), editor); err != nil {
+		return article{}, err
+	}
 
-	if err != nil {
-		tx.Commit()
-		return 0, err
+	if update.Title != nil {
+		title = *update.Title
+	}
+	if update.Content != nil {
+		content = *update.Content
+	}
+	if _, err := tx.Exec("UPDATE articles SET title = ?, content = ? WHERE id = ?", title, content, id); err != nil {
+		return article{}, err
 	}
 
-	num, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
+	if err := tx.Commit(); err != nil {
+		return article{}, err
 	}
+	return getArticleByID(id)
+}
 
-	tx.Commit()
+// List the previous versions of an article, the latest first
+func getArticleRevisions(id int) ([]articleRevision, error) {
+	rows, err := DB.Query("SELECT revision_id, title, content, edited_at, edited_by FROM article_revisions WHERE article_id = ? ORDER BY revision_id DESC", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	return num, nil
+	revisions := make([]articleRevision, 0)
+	for rows.Next() {
+		var r articleRevision
+		var editedAt time.Time
+		if err := rows.Scan(&r.ID, &r.Title, &r.Content, &editedAt, &r.EditedBy); err != nil {
+			return nil, err
+		}
+		r.EditedAt = editedAt.Format(time.RFC3339)
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
 }
 
-func deleteArticleByTitle(title string) (int64, error) {
+// Delete an article with its comments, reactions and revisions
+func deleteArticleById(id int) (int64, error) {
 	tx, err := DB.Begin()
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
 
-	stmt, err := DB.Prepare("DELETE FROM articles WHERE title = ?")
+	num, err := deleteArticleTx(tx, id)
 	if err != nil {
 		return 0, err
 	}
-	defer stmt.Close()
+	return num, tx.Commit()
+}
 
-	result, err := stmt.Exec(title)
+// Delete every article with the title, with their comments, reactions and
+// revisions
+func deleteArticleByTitle(title string) (int64, error) {
+	tx, err := DB.Begin()
 	if err != nil {
-		tx.Commit()
 		return 0, err
 	}
+	defer tx.Rollback()
 
-	num, err := result.RowsAffected()
+	rows, err := tx.Query("SELECT id FROM articles WHERE title = ?", title)
 	if err != nil {
 		return 0, err
 	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
 
-	tx.Commit()
-
-	return num, err
+	var total int64
+	for _, id := range ids {
+		num, err := deleteArticleTx(tx, id)
+		if err != nil {
+			return 0, err
+		}
+		total += num
+	}
+	return total, tx.Commit()
 }
 
-//给一篇文章likes和dislike要加的数字，可能的值有-1/0/1
-//之前是否操作过的逻辑判断放到上一层函数完成
-func reactionToAnArticle(articleId int, like int, dislike int) (int64, error) {
-	//先查询
-	var likeNum, dislikeNum int
-	stmtQuery, errQuery := DB.Prepare("SELECT likes, dislikes FROM articles WHERE id=?")
-	if errQuery != nil {
-		return 0, errQuery
-	}
-	defer stmtQuery.Close()
-	querySqlErr := stmtQuery.QueryRow(articleId).Scan(&likeNum, &dislikeNum)
-	if querySqlErr != nil {
-		return 0, querySqlErr
-	}
-	//再更新
-	stmtUpdate, errUpdate := DB.Prepare("UPDATE articles SET likes=?, dislikes=? WHERE id=?")
-	if errUpdate != nil {
-		return 0, errUpdate
-	}
-	res, errStmt := stmtUpdate.Exec(likeNum+like, dislikeNum+dislike, articleId)
-	if errStmt != nil {
-		return 0, errStmt
-	}
-	affect, errRes := res.RowsAffected()
-	if errRes != nil {
-		return 0, errRes
-	}
-	return affect, nil
+// Delete an article and the rows that reference it, so that foreign keys
+// don't block the deletion
+func deleteArticleTx(tx *sql.Tx, id int) (int64, error) {
+	for _, query := range []string{
+		"DELETE FROM reactions WHERE target_type = 'article' AND target_id = ?",
+		"DELETE FROM reactions WHERE target_type = 'comment' AND target_id IN (SELECT comment_id FROM comment WHERE topic_id = ?)",
+		"DELETE FROM comment WHERE topic_id = ?",
+		"DELETE FROM article_revisions WHERE article_id = ?",
+		"DELETE FROM notifications WHERE article_id = ?",
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM articles WHERE id = ?", id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
@@ -54,10 +54,9 @@ func TestCreateNewArticle(t *testing.T) {
 	//originalLength := len(getAllArticles())
 
 	// With exising user
-	existUser := mingleUser{Username: "user1", Password: "pass1"}
 	newArticle := article{Title: "New test title", Author: "user1", Content: "New test content"}
 	// add another article
-	num, err := createNewArticle(newArticle, existUser)
+	num, err := createNewArticle(newArticle, "user1")
 	if num == 0 || err != nil {
 		fmt.Println("TestCreateNewArticle 62 failure", num, err)
 		t.Fail()
@@ -0,0 +1,72 @@
+// models.block.go
+
+package main
+
+import (
+	"database/sql"
+)
+
+// Block a user, who can't message the blocker anymore. Their match and the
+// interests and passes between them are removed. Blocking twice is harmless
+func blockUser(blocker string, blocked string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO blocks (blocker, blocked, created_at) VALUES (?, ?, CURRENT_TIMESTAMP) ON CONFLICT (blocker, blocked) DO NOTHING", blocker, blocked); err != nil {
+		return err
+	}
+	a, b := orderedPair(blocker, blocked)
+	if _, err := tx.Exec("DELETE FROM matches WHERE user_a = ? AND user_b = ?", a, b); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM interests WHERE username = ?1 AND target = ?2 OR username = ?2 AND target = ?1", blocker, blocked); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Unblock a user, sql.ErrNoRows if the user wasn't blocked
+func unblockUser(blocker string, blocked string) error {
+	result, err := DB.Exec("DELETE FROM blocks WHERE blocker = ? AND blocked = ?", blocker, blocked)
+	if err != nil {
+		return err
+	}
+	num, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if num == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Return the users a user blocked, the most recent first
+func getBlockedUsers(blocker string) ([]string, error) {
+	rows, err := DB.Query(`SELECT blocked FROM blocks JOIN users ON users.username = blocks.blocked
+		WHERE blocker = ? AND users.deleted_at IS NULL ORDER BY created_at DESC, blocked`, blocker)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []string{}
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		list = append(list, username)
+	}
+	return list, rows.Err()
+}
+
+// Whether either user blocked the other
+func isBlockedTx(tx *sql.Tx, a string, b string) (bool, error) {
+	var blocked bool
+	err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM blocks WHERE blocker = ?1 AND blocked = ?2 OR blocker = ?2 AND blocked = ?1)", a, b).Scan(&blocked)
+	return blocked, err
+}
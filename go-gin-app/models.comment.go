@@ -3,7 +3,7 @@ package main
 import (
 	"database/sql"
 	"errors"
-	"fmt"
+	"time"
 )
 
 type comment struct {
@@ -12,13 +12,19 @@ type comment struct {
 	Content       string `json:"content"`
 	CommentId     int    `json:"commentId"`
 	CommentTime   string `json:"commentTime"`
-	Likes         string `json:"likes"`
-	Dislikes      string `json:"dislikes"`
+	Likes         int    `json:"likes"`
+	Dislikes      int    `json:"dislikes"`
+	// The comment this one replies to, nil for a top-level comment
+	ParentId *int `json:"parentId,omitempty"`
+	// When the content was last changed, nil if it never was
+	EditedAt *string `json:"editedAt,omitempty"`
 }
 
-func getAllComment(articleId string) ([]comment, error) {
-	query := "SELECT comment_id, topic_id, comment_user, comment_content, comment_time, likes, dislikes from comment where topic_id=" + articleId
-	rows, err := DB.Query(query)
+// Returned when a reply names a comment that isn't on the same article
+var errInvalidParent = errors.New("The comment to reply to does not exist on this article")
+
+func getAllComment(articleId int) ([]comment, error) {
+	rows, err := DB.Query("SELECT comment_id, topic_id, comment_user, comment_content, comment_time, likes, dislikes, parent_comment_id, edited_at from comment where topic_id = ? AND deleted_at IS NULL", articleId)
 	//fmt.Println("getAllArticles")
 	//fmt.Println(err)
 	if err != nil {
@@ -31,8 +37,10 @@ func getAllComment(articleId string) ([]comment, error) {
 
 	for rows.Next() {
 		singleComment := comment{}
-		err = rows.Scan(&singleComment.CommentId, &singleComment.ArticleId, &singleComment.CommentAuthor, &singleComment.Content, &singleComment.CommentTime, &singleComment.Likes, &singleComment.Dislikes)
-		checkErr(err)
+		err = rows.Scan(&singleComment.CommentId, &singleComment.ArticleId, &singleComment.CommentAuthor, &singleComment.Content, &singleComment.CommentTime, &singleComment.Likes, &singleComment.Dislikes, &singleComment.ParentId, &singleComment.EditedAt)
+		if err != nil {
+			return nil, err
+		}
 		//fmt.Println(err)
 		commentResult = append(commentResult, singleComment)
 	}
@@ -48,8 +56,7 @@ func getAllComment(articleId string) ([]comment, error) {
 }
 
 func getCommentsByUser(username string) ([]comment, error) {
-	query := "SELECT comment_id, topic_id, comment_user, comment_content, comment_time, likes, dislikes from comment where comment_user='" + username + "';"
-	rows, err := DB.Query(query)
+	rows, err := DB.Query("SELECT comment_id, topic_id, comment_user, comment_content, comment_time, likes, dislikes, parent_comment_id, edited_at from comment where comment_user = ? AND deleted_at IS NULL", username)
 	//fmt.Println("getAllArticles")
 	//fmt.Println(err)
 	if err != nil {
@@ -62,8 +69,10 @@ func getCommentsByUser(username string) ([]comment, error) {
 
 	for rows.Next() {
 		singleComment := comment{}
-		err = rows.Scan(&singleComment.CommentId, &singleComment.ArticleId, &singleComment.CommentAuthor, &singleComment.Content, &singleComment.CommentTime, &singleComment.Likes, &singleComment.Dislikes)
-		checkErr(err)
+		err = rows.Scan(&singleComment.CommentId, &singleComment.ArticleId, &singleComment.CommentAuthor, &singleComment.Content, &singleComment.CommentTime, &singleComment.Likes, &singleComment.Dislikes, &singleComment.ParentId, &singleComment.EditedAt)
+		if err != nil {
+			return nil, err
+		}
 		//fmt.Println(err)
 		commentResult = append(commentResult, singleComment)
 	}
@@ -77,7 +86,7 @@ func getCommentsByUser(username string) ([]comment, error) {
 	return commentResult, err
 }
 
-func createNewComment(commentData comment, tempuser mingleUser) (int64, error) {
+func createNewComment(commentData comment) (int64, error) {
 	//res_user, er := isUserValid(tempuser)
 	//res_comment, er := isCommentValid(commentData)
 	//if res_user && res_comment {
@@ -85,38 +94,135 @@ func createNewComment(commentData comment, tempuser mingleUser) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
 	//tx.Exec("PRAGMA foreign_keys = ON")
 
-	stmt, err := tx.Prepare("INSERT INTO comment (topic_id, comment_user, comment_content, comment_time) VALUES (?, ?, ?, CURRENT_TIMESTAMP)")
+	// A reply must stay on the article of the comment it answers
+	if commentData.ParentId != nil {
+		var parentArticle int
+		sqlErr := tx.QueryRow("SELECT topic_id FROM comment WHERE comment_id = ? AND deleted_at IS NULL", *commentData.ParentId).Scan(&parentArticle)
+		if sqlErr == sql.ErrNoRows || sqlErr == nil && parentArticle != commentData.ArticleId {
+			return 0, errInvalidParent
+		}
+		if sqlErr != nil {
+			return 0, sqlErr
+		}
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO comment (topic_id, comment_user, comment_content, comment_time, parent_comment_id) VALUES (?, ?, ?, CURRENT_TIMESTAMP, ?)")
 	if err != nil {
-		fmt.Println("here1")
 		return 0, err
 	}
 
 	defer stmt.Close()
 
-	result, execErr := stmt.Exec(commentData.ArticleId, commentData.CommentAuthor, commentData.Content)
+	result, execErr := stmt.Exec(commentData.ArticleId, commentData.CommentAuthor, commentData.Content, commentData.ParentId)
 	if execErr != nil {
-		fmt.Println("here2")
-		tx.Commit()
 		return 0, execErr
 	}
 	num, errR := result.RowsAffected()
 	if errR != nil {
-		fmt.Println("here3")
 		return 0, errR
 	}
-	tx.Commit()
-	fmt.Println("here4")
+	id, errI := result.LastInsertId()
+	if errI != nil {
+		return 0, errI
+	}
+	recipients, err := notifyOfCommentTx(tx, commentData, int(id))
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	// Push the comment to its recipients online
+	if c, err := getCommentByID(int(id)); err == nil {
+		for _, username := range recipients {
+			events.publish(event{Type: eventComment, To: username, Data: c})
+		}
+	}
 	return num, nil
 	/*} else {
 		return 0, er
 	}*/
 }
 
+// Tell the author of the article about a new comment, and the author of
+// the parent comment about a reply. Returns the users concerned
+func notifyOfCommentTx(tx *sql.Tx, c comment, commentId int) ([]string, error) {
+	var articleAuthor, parentAuthor string
+	if err := tx.QueryRow("SELECT COALESCE(author, '') FROM articles WHERE id = ?", c.ArticleId).Scan(&articleAuthor); err != nil {
+		return nil, err
+	}
+
+	var recipients []string
+	if c.ParentId != nil {
+		if err := tx.QueryRow("SELECT comment_user FROM comment WHERE comment_id = ?", *c.ParentId).Scan(&parentAuthor); err != nil {
+			return nil, err
+		}
+		if err := notifyTx(tx, notification{Recipient: parentAuthor, Kind: notifyReply, Actor: c.CommentAuthor, ArticleId: &c.ArticleId, CommentId: &commentId}); err != nil {
+			return nil, err
+		}
+		if parentAuthor != c.CommentAuthor {
+			recipients = append(recipients, parentAuthor)
+		}
+	}
+	// The author of the article already knows when the reply is to them
+	if articleAuthor == parentAuthor {
+		return recipients, nil
+	}
+	if err := notifyTx(tx, notification{Recipient: articleAuthor, Kind: notifyComment, Actor: c.CommentAuthor, ArticleId: &c.ArticleId, CommentId: &commentId}); err != nil {
+		return nil, err
+	}
+	if articleAuthor != "" && articleAuthor != c.CommentAuthor {
+		recipients = append(recipients, articleAuthor)
+	}
+	return recipients, nil
+}
+
+// Fetch a comment that isn't deleted, sql.ErrNoRows if there is none
+func getCommentByID(commentId int) (comment, error) {
+	var c comment
+	err := DB.QueryRow("SELECT comment_id, topic_id, comment_user, comment_content, comment_time, likes, dislikes, parent_comment_id, edited_at FROM comment WHERE comment_id = ? AND deleted_at IS NULL", commentId).
+		Scan(&c.CommentId, &c.ArticleId, &c.CommentAuthor, &c.Content, &c.CommentTime, &c.Likes, &c.Dislikes, &c.ParentId, &c.EditedAt)
+	return c, err
+}
+
+var errEditWindowClosed = errors.New("The edit window of the comment is over")
+
+// Change the content of a comment that isn't deleted. Unless postedSince is
+// zero, only a comment posted since then can be edited.
+// Returns sql.ErrNoRows if there is no such comment
+func updateComment(commentId int, content string, postedSince time.Time) (comment, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return comment{}, err
+	}
+	defer tx.Rollback()
+
+	var open bool
+	sqlErr := tx.QueryRow("SELECT ?2 OR julianday(comment_time) >= julianday(?3) FROM comment WHERE comment_id = ?1 AND deleted_at IS NULL",
+		commentId, postedSince.IsZero(), postedSince.UTC().Format("2006-01-02 15:04:05")).Scan(&open)
+	if sqlErr != nil {
+		return comment{}, sqlErr
+	}
+	if !open {
+		return comment{}, errEditWindowClosed
+	}
+
+	if _, err := tx.Exec("UPDATE comment SET comment_content = ?, edited_at = CURRENT_TIMESTAMP WHERE comment_id = ?", content, commentId); err != nil {
+		return comment{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return comment{}, err
+	}
+	return getCommentByID(commentId)
+}
+
 // Check if the comment matches the foreign key constraint
 func isCommentValid(newComment comment) (bool, error) {
-	stmt_article, err := DB.Prepare("SELECT id FROM articles WHERE id = ?")
+	stmt_article, err := DB.Prepare("SELECT id FROM articles WHERE id = ? AND deleted_at IS NULL")
 	if err != nil {
 		return false, err
 	}
@@ -128,7 +234,7 @@ func isCommentValid(newComment comment) (bool, error) {
 		flag_article = true
 	}
 
-	stmt_user, err := DB.Prepare("SELECT username FROM users WHERE username = ?")
+	stmt_user, err := DB.Prepare("SELECT username FROM users WHERE username = ? AND deleted_at IS NULL")
 	if err != nil {
 		return false, err
 	}
@@ -147,29 +253,34 @@ func isCommentValid(newComment comment) (bool, error) {
 	}
 }
 
+// Delete a comment with its reactions
 func deleteCommentByCommentId(commentId int) (int64, error) {
 	tx, err := DB.Begin()
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
 
-	stmt, err := DB.Prepare("DELETE FROM comment WHERE comment_id = ?")
+	num, err := deleteCommentTx(tx, commentId)
 	if err != nil {
 		return 0, err
 	}
-	defer stmt.Close()
+	return num, tx.Commit()
+}
 
-	result, err := stmt.Exec(commentId)
-	if err != nil {
-		tx.Commit()
-		return 0, err
+// Delete a comment and the reactions to it, so that none is left behind
+func deleteCommentTx(tx *sql.Tx, commentId int) (int64, error) {
+	for _, query := range []string{
+		"DELETE FROM reactions WHERE target_type = 'comment' AND target_id = ?",
+		"DELETE FROM notifications WHERE comment_id = ?",
+	} {
+		if _, err := tx.Exec(query, commentId); err != nil {
+			return 0, err
+		}
 	}
-
-	num, err := result.RowsAffected()
+	result, err := tx.Exec("DELETE FROM comment WHERE comment_id = ?", commentId)
 	if err != nil {
 		return 0, err
 	}
-
-	tx.Commit()
-	return num, err
+	return result.RowsAffected()
 }
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"log"
-	"strconv"
 	"testing"
 	"time"
 )
@@ -11,13 +10,13 @@ import (
 // Test the function that fetches all comments
 func TestGetAllComment(t *testing.T) {
 	// With an article id that does exist
-	_, err := getAllComment("1")
+	_, err := getAllComment(1)
 	if err != nil {
 		t.Fail()
 	}
 
 	// With an article id that does not exist
-	tmp, _ := getAllComment("10000")
+	tmp, _ := getAllComment(10000)
 	//fmt.Println(tmp)
 	//fmt.Println(err2)
 	if len(tmp) != 0 {
@@ -31,16 +30,12 @@ func TestCreateNewComment(t *testing.T) {
 	validComment := comment{ArticleId: 3, CommentAuthor: "user1", Content: "Test Comment", CommentTime: time.Now().Format("2006-01-02 15:04:05")}
 	//invalid comment
 	invalidComment := comment{ArticleId: 1000, CommentAuthor: "someone", Content: "Test Comment", CommentTime: time.Now().Format("2006-01-02 15:04:05")}
-	//valid user
-	validUser := mingleUser{Username: "user1", Password: "pass1"}
-	//invalid user
-	invalidUser := mingleUser{Username: "invalidUser", Password: "invalidPass"}
 	if _, err := DB.Exec("PRAGMA foreign_keys=ON"); err != nil {
 		//fmt.Println("?????????????????????????????")
 		log.Fatal(err)
 	}
-	//valid comment and invalid user
-	num, err := createNewComment(validComment, invalidUser)
+	//valid comment
+	num, err := createNewComment(validComment)
 	if num == 0 || err != nil {
 		fmt.Println("TestCreateNewComment 41 Failure")
 		t.Fail()
@@ -50,16 +45,16 @@ func TestCreateNewComment(t *testing.T) {
 	//fmt.Println(res)
 	//fmt.Println(err)
 
-	//invalid comment and valid user
-	num, err = createNewComment(invalidComment, validUser)
+	//invalid comment
+	num, err = createNewComment(invalidComment)
 	//fmt.Println(num)
 	//fmt.Println(err)
 	if num != 0 {
 		fmt.Println("TestCreateNewComment 54 Failure")
 		t.Fail()
 	}
-	//valid comment and valid user
-	num, err = createNewComment(validComment, validUser)
+	//valid comment again
+	num, err = createNewComment(validComment)
 	//fmt.Println(num)
 	//fmt.Println(err)
 	if num == 0 {
@@ -67,7 +62,7 @@ func TestCreateNewComment(t *testing.T) {
 		t.Fail()
 	}
 	//delete the valid comment after test
-	commentList, err := getAllComment(strconv.Itoa(validComment.ArticleId))
+	commentList, err := getAllComment(validComment.ArticleId)
 	validCommentId := commentList[len(commentList)-1].CommentId
 	num, err = deleteCommentByCommentId(validCommentId)
 	if num == 0 {
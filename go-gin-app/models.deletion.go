@@ -0,0 +1,286 @@
+// models.deletion.go
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// Returned when restoring something whose article or author is still
+// deleted
+var errParentDeleted = errors.New("Restore the article or the account it belongs to first")
+
+// Mark an article and its comments as deleted.
+// Returns sql.ErrNoRows if there is no such article that isn't deleted
+func softDeleteArticle(id int, deletedBy string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if err := execAffectingOne(tx, "UPDATE articles SET deleted_at = ?, deleted_by = ? WHERE id = ? AND deleted_at IS NULL", now, deletedBy, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE comment SET deleted_at = ?, deleted_by = ? WHERE topic_id = ? AND deleted_at IS NULL", now, deletedBy, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Bring back a deleted article with the comments deleted along with it.
+// Returns sql.ErrNoRows if there is no such deleted article
+func restoreArticle(id int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deletedAt time.Time
+	var authorDeleted bool
+	sqlErr := tx.QueryRow(`SELECT articles.deleted_at, users.deleted_at IS NOT NULL FROM articles
+		JOIN users ON users.username = articles.author
+		WHERE articles.id = ? AND articles.deleted_at IS NOT NULL`, id).Scan(&deletedAt, &authorDeleted)
+	if sqlErr != nil {
+		return sqlErr
+	}
+	if authorDeleted {
+		return errParentDeleted
+	}
+
+	if _, err := tx.Exec("UPDATE comment SET deleted_at = NULL, deleted_by = NULL WHERE topic_id = ? AND deleted_at = ?", id, deletedAt); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE articles SET deleted_at = NULL, deleted_by = NULL WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Mark a comment as deleted.
+// Returns sql.ErrNoRows if there is no such comment that isn't deleted
+func softDeleteComment(id int, deletedBy string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := execAffectingOne(tx, "UPDATE comment SET deleted_at = ?, deleted_by = ? WHERE comment_id = ? AND deleted_at IS NULL", time.Now().UTC(), deletedBy, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Bring back a deleted comment, unless its article or author is deleted.
+// Returns sql.ErrNoRows if there is no such deleted comment
+func restoreComment(id int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parentDeleted bool
+	sqlErr := tx.QueryRow(`SELECT articles.deleted_at IS NOT NULL OR users.deleted_at IS NOT NULL FROM comment
+		JOIN articles ON articles.id = comment.topic_id
+		JOIN users ON users.username = comment.comment_user
+		WHERE comment.comment_id = ? AND comment.deleted_at IS NOT NULL`, id).Scan(&parentDeleted)
+	if sqlErr != nil {
+		return sqlErr
+	}
+	if parentDeleted {
+		return errParentDeleted
+	}
+
+	if _, err := tx.Exec("UPDATE comment SET deleted_at = NULL, deleted_by = NULL WHERE comment_id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Mark an account as deleted with its articles and comments, and log it out
+// everywhere. Returns sql.ErrNoRows if there is no such account that isn't
+// deleted
+func softDeleteUser(username string, deletedBy string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if err := execAffectingOne(tx, "UPDATE users SET deleted_at = ?, deleted_by = ? WHERE username = ? AND deleted_at IS NULL", now, deletedBy, username); err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		"UPDATE comment SET deleted_at = ?1, deleted_by = ?2 WHERE deleted_at IS NULL AND (comment_user = ?3 OR topic_id IN (SELECT id FROM articles WHERE author = ?3 AND deleted_at IS NULL))",
+		"UPDATE articles SET deleted_at = ?1, deleted_by = ?2 WHERE author = ?3 AND deleted_at IS NULL",
+	} {
+		if _, err := tx.Exec(query, now, deletedBy, username); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM password_resets WHERE username = ?", username); err != nil {
+		return err
+	}
+	if err := revokeUserSessions(tx, username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Bring back a deleted account with the articles and comments deleted along
+// with it. Returns sql.ErrNoRows if there is no such deleted account
+func restoreUser(username string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deletedAt time.Time
+	if err := tx.QueryRow("SELECT deleted_at FROM users WHERE username = ? AND deleted_at IS NOT NULL", username).Scan(&deletedAt); err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		"UPDATE comment SET deleted_at = NULL, deleted_by = NULL WHERE deleted_at = ?1 AND (comment_user = ?2 OR topic_id IN (SELECT id FROM articles WHERE author = ?2))",
+		"UPDATE articles SET deleted_at = NULL, deleted_by = NULL WHERE author = ?2 AND deleted_at = ?1",
+		"UPDATE users SET deleted_at = NULL, deleted_by = NULL WHERE username = ?2",
+	} {
+		if _, err := tx.Exec(query, deletedAt, username); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Run an UPDATE that must change exactly one row, sql.ErrNoRows otherwise
+func execAffectingOne(tx *sql.Tx, query string, args ...interface{}) error {
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	affect, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affect != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Permanently remove the comments, articles and accounts deleted before the
+// given time. Returns how many of each were removed
+func purgeDeleted(before time.Time) (comments int, articles int, users int, err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer tx.Rollback()
+
+	// A comment is only removed once it has no replies left, so deleted
+	// replies go first and the comments with live replies are kept
+	for {
+		ids, err := queryInts(tx, `SELECT comment_id FROM comment WHERE deleted_at < ?
+			AND NOT EXISTS (SELECT 1 FROM comment reply WHERE reply.parent_comment_id = comment.comment_id)`, before)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		for _, id := range ids {
+			if _, err := deleteCommentTx(tx, id); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+		comments += len(ids)
+	}
+
+	articleIds, err := queryInts(tx, "SELECT id FROM articles WHERE deleted_at < ?", before)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	for _, id := range articleIds {
+		if _, err := deleteArticleTx(tx, id); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	rows, err := tx.Query("SELECT username FROM users WHERE deleted_at < ?", before)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			rows.Close()
+			return 0, 0, 0, err
+		}
+		usernames = append(usernames, username)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, 0, err
+	}
+	for _, username := range usernames {
+		if _, err := deleteUserTx(tx, username); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	return comments, len(articleIds), len(usernames), tx.Commit()
+}
+
+// Run a query returning one integer column
+func queryInts(tx *sql.Tx, query string, args ...interface{}) ([]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []int
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// Purge the deleted content older than the retention every interval, until
+// the context is canceled
+func runPurge(ctx context.Context, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		comments, articles, users, err := purgeDeleted(time.Now().UTC().Add(-retention))
+		if err != nil {
+			log.Printf("purge: %v", err)
+		} else if comments+articles+users > 0 {
+			log.Printf("purge: removed %d comments, %d articles and %d accounts", comments, articles, users)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// models.deletion_test.go
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that a deleted comment is hidden, can be restored, and is removed
+// for good only once the retention is over
+func TestSoftDeleteAndPurgeComment(t *testing.T) {
+	if _, err := createNewComment(comment{ArticleId: 1, CommentAuthor: "user2", Content: "to be purged"}); err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	DB.QueryRow("SELECT MAX(comment_id) FROM comment WHERE comment_user = 'user2'").Scan(&id)
+	defer deleteCommentByCommentId(id)
+
+	listed := func() bool {
+		comments, err := getCommentsByUser("user2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range comments {
+			if c.CommentId == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	if err := softDeleteComment(id, "user2"); err != nil {
+		t.Fatal(err)
+	}
+	if listed() {
+		t.Error("the deleted comment is listed")
+	}
+	if err := restoreComment(id); err != nil {
+		t.Fatal(err)
+	}
+	if !listed() {
+		t.Error("the restored comment is not listed")
+	}
+
+	if err := softDeleteComment(id, "user2"); err != nil {
+		t.Fatal(err)
+	}
+	if comments, _, _, err := purgeDeleted(time.Now().UTC().Add(-time.Hour)); err != nil || comments != 0 {
+		t.Errorf("purged %d comments within the retention: %v", comments, err)
+	}
+	if comments, _, _, err := purgeDeleted(time.Now().UTC().Add(time.Second)); err != nil || comments != 1 {
+		t.Errorf("purged %d comments after the retention: %v", comments, err)
+	}
+	if err := restoreComment(id); err == nil {
+		t.Error("a purged comment was restored")
+	}
+}
+
+// Test that purging a deleted account removes everything it wrote
+func TestPurgeUser(t *testing.T) {
+	u := user{Gatorlink: "purged@ufl.edu", Username: "purgedUser", Password: "p", Gender: "unknown"}
+	registerActiveUser(t, u)
+	defer deleteUser(u.Username)
+
+	if _, err := createNewArticle(article{Title: "purged", Content: "purged"}, u.Username); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createNewComment(comment{ArticleId: 1, CommentAuthor: u.Username, Content: "purged"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := softDeleteUser(u.Username, "user_rl"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, users, err := purgeDeleted(time.Now().UTC().Add(time.Second)); err != nil || users != 1 {
+		t.Fatalf("purged %d accounts: %v", users, err)
+	}
+
+	var left int
+	DB.QueryRow("SELECT (SELECT COUNT(*) FROM users WHERE username = ?1) + (SELECT COUNT(*) FROM articles WHERE author = ?1) + (SELECT COUNT(*) FROM comment WHERE comment_user = ?1)",
+		u.Username).Scan(&left)
+	if left != 0 {
+		t.Errorf("%d rows of the purged account are left", left)
+	}
+}
@@ -0,0 +1,236 @@
+// models.discover.go
+
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+)
+
+// The page sizes of the discover stack
+const (
+	defaultDiscoverLimit = 20
+	maxDiscoverLimit     = 50
+)
+
+// The ages a user can ask to see
+const (
+	minDiscoverAge = 18
+	maxDiscoverAge = 99
+)
+
+// Who a user wants to see in the discover stack. Major and GradYear are
+// left out to see every major and year
+type discoverPreferences struct {
+	// male, female or everyone
+	InterestedIn string  `json:"interestedIn"`
+	MinAge       int     `json:"minAge"`
+	MaxAge       int     `json:"maxAge"`
+	Major        *string `json:"major"`
+	GradYear     *int    `json:"gradYear"`
+}
+
+// The preferences of a user who never set them
+var defaultDiscoverPreferences = discoverPreferences{InterestedIn: "everyone", MinAge: minDiscoverAge, MaxAge: maxDiscoverAge}
+
+// A profile of the discover stack. The fields hidden from the viewer and
+// the ones the user left empty are omitted
+type candidate struct {
+	Username string  `json:"username"`
+	Gender   *string `json:"gender,omitempty"`
+	Age      *int    `json:"age,omitempty"`
+	Major    *string `json:"major,omitempty"`
+	GradYear *int    `json:"gradYear,omitempty"`
+}
+
+// A page of the discover stack, nextCursor is empty on the last page
+type candidatePage struct {
+	Candidates []candidate `json:"candidates"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// The position of a page in the discover stack: the day the stack was
+// shuffled for and the user the page starts after
+type discoverCursor struct {
+	Day   string `json:"d"`
+	After string `json:"a"`
+}
+
+// Encode a cursor as an opaque URL-safe string
+func (cur discoverCursor) encode() string {
+	raw, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Decode a cursor given by a client
+func decodeDiscoverCursor(s string) (discoverCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return discoverCursor{}, errInvalidCursor
+	}
+	var cur discoverCursor
+	if err := json.Unmarshal(raw, &cur); err != nil {
+		return discoverCursor{}, errInvalidCursor
+	}
+	if _, err := time.Parse("2006-01-02", cur.Day); err != nil || cur.After == "" {
+		return discoverCursor{}, errInvalidCursor
+	}
+	return cur, nil
+}
+
+// Check the preferences, returning the reason for each invalid field
+func (prefs discoverPreferences) validate() map[string]string {
+	problems := map[string]string{}
+	if prefs.InterestedIn != "male" && prefs.InterestedIn != "female" && prefs.InterestedIn != "everyone" {
+		problems["interestedIn"] = "must be male, female or everyone"
+	}
+	if prefs.MinAge < minDiscoverAge || prefs.MinAge > maxDiscoverAge {
+		problems["minAge"] = fmt.Sprintf("must be from %d to %d", minDiscoverAge, maxDiscoverAge)
+	}
+	if prefs.MaxAge < minDiscoverAge || prefs.MaxAge > maxDiscoverAge {
+		problems["maxAge"] = fmt.Sprintf("must be from %d to %d", minDiscoverAge, maxDiscoverAge)
+	} else if prefs.MaxAge < prefs.MinAge {
+		problems["maxAge"] = "must not be below minAge"
+	}
+	if prefs.Major != nil && len(*prefs.Major) > maxMajorLength {
+		problems["major"] = fmt.Sprintf("must be at most %d characters", maxMajorLength)
+	}
+	if prefs.GradYear != nil && (*prefs.GradYear < minGradYear || *prefs.GradYear > maxGradYear) {
+		problems["gradYear"] = fmt.Sprintf("must be a year from %d to %d, or null", minGradYear, maxGradYear)
+	}
+	return problems
+}
+
+// Return the discover preferences of a user, the defaults if they never
+// set them
+func getDiscoverPreferences(username string) (discoverPreferences, error) {
+	prefs := defaultDiscoverPreferences
+	err := DB.QueryRow("SELECT interested_in, min_age, max_age, major, grad_year FROM discover_preferences WHERE username = ?", username).
+		Scan(&prefs.InterestedIn, &prefs.MinAge, &prefs.MaxAge, &prefs.Major, &prefs.GradYear)
+	if err == sql.ErrNoRows {
+		return defaultDiscoverPreferences, nil
+	}
+	return prefs, err
+}
+
+// Replace the discover preferences of a user. An empty major counts as no
+// major
+func setDiscoverPreferences(username string, prefs discoverPreferences) error {
+	var major *string
+	if prefs.Major != nil && strings.TrimSpace(*prefs.Major) != "" {
+		trimmed := strings.TrimSpace(*prefs.Major)
+		major = &trimmed
+	}
+	_, err := DB.Exec(`INSERT INTO discover_preferences (username, interested_in, min_age, max_age, major, grad_year) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (username) DO UPDATE SET interested_in = excluded.interested_in, min_age = excluded.min_age, max_age = excluded.max_age,
+			major = excluded.major, grad_year = excluded.grad_year`,
+		username, prefs.InterestedIn, prefs.MinAge, prefs.MaxAge, major, prefs.GradYear)
+	return err
+}
+
+// The position of a user in the stack of the viewer on a day. The order
+// looks random but stays the same for the whole day. Queries call it as
+// discover_key(viewer, day, username)
+func discoverKey(viewer string, day string, username string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(viewer + "\x00" + day + "\x00" + username))
+	return int64(h.Sum64())
+}
+
+// Return a page of at most limit profiles that match the preferences of
+// the viewer, shuffled for the day of the cursor, from the start of the
+// stack of today when cur is nil. Users the viewer already showed interest
+// in or passed on, blocked users and inactive accounts are left out. The
+// fields of each profile are shown as getPublicProfile would, and a user
+// who hid a field the preferences filter on is left out too, so that the
+// stack doesn't tell the hidden value. The page is ordered and cut in SQL,
+// which still has to compute the key of every matching user to find it
+func getDiscoverStack(viewer string, cur *discoverCursor, limit int) (candidatePage, error) {
+	start := discoverCursor{Day: time.Now().UTC().Format("2006-01-02")}
+	if cur != nil {
+		start = *cur
+	}
+
+	prefs, err := getDiscoverPreferences(viewer)
+	if err != nil {
+		return candidatePage{}, err
+	}
+
+	// The user of the cursor may have been rated since, so the page starts
+	// at the position the user had rather than at the user
+	var after *string
+	var afterKey int64
+	if start.After != "" {
+		after = &start.After
+		afterKey = discoverKey(viewer, start.Day, start.After)
+	}
+
+	// The age in whole years on the day of the stack, and how the viewer is
+	// related to each user as in getProfileAudience. Every stack keeps to
+	// the ages a user can ask for, the age preferences only apply to the
+	// users who show their age
+	rows, err := DB.Query(`SELECT username,
+				CASE WHEN `+visibleInStack("gender")+` THEN gender END,
+				CASE WHEN `+visibleInStack("major")+` THEN major END,
+				CASE WHEN `+visibleInStack("gradYear")+` THEN grad_year END,
+				CASE WHEN `+visibleInStack("age")+` THEN age END
+			FROM (
+			SELECT username, gender, major, grad_year,
+				CAST(strftime('%Y', :day) AS INTEGER) - CAST(strftime('%Y', birthday) AS INTEGER) - (strftime('%m-%d', :day) < strftime('%m-%d', birthday)) AS age,
+				EXISTS (SELECT 1 FROM subscribe WHERE star = users.username AND follower = :viewer)
+					AND EXISTS (SELECT 1 FROM subscribe WHERE star = :viewer AND follower = users.username) AS mutual_follower,
+				EXISTS (SELECT 1 FROM matches WHERE user_a = :viewer AND user_b = users.username OR user_a = users.username AND user_b = :viewer) AS matched,
+				discover_key(:viewer, :day, username) AS shuffle_key
+			FROM users
+			WHERE username != :viewer AND status = 'active' AND deleted_at IS NULL AND birthday IS NOT NULL
+				AND NOT EXISTS (SELECT 1 FROM interests WHERE interests.username = :viewer AND interests.target = users.username)
+				AND NOT EXISTS (SELECT 1 FROM blocks WHERE (blocker = :viewer AND blocked = users.username) OR (blocker = users.username AND blocked = :viewer))
+		) AS c
+		WHERE age BETWEEN :min_discover_age AND :max_discover_age
+			AND (:interested_in = 'everyone' OR gender = :interested_in AND `+visibleInStack("gender")+`)
+			AND (:min_age = :min_discover_age AND :max_age = :max_discover_age OR age BETWEEN :min_age AND :max_age AND `+visibleInStack("age")+`)
+			AND (:major IS NULL OR lower(major) = lower(:major) AND `+visibleInStack("major")+`)
+			AND (:grad_year IS NULL OR grad_year = :grad_year AND `+visibleInStack("gradYear")+`)
+			AND (:after IS NULL OR shuffle_key > :after_key OR shuffle_key = :after_key AND username > :after)
+		ORDER BY shuffle_key, username
+		LIMIT :limit`,
+		sql.Named("day", start.Day), sql.Named("viewer", viewer), sql.Named("interested_in", prefs.InterestedIn),
+		sql.Named("major", prefs.Major), sql.Named("grad_year", prefs.GradYear),
+		sql.Named("min_age", prefs.MinAge), sql.Named("max_age", prefs.MaxAge),
+		sql.Named("min_discover_age", minDiscoverAge), sql.Named("max_discover_age", maxDiscoverAge),
+		sql.Named("after", after), sql.Named("after_key", afterKey), sql.Named("limit", limit+1))
+	if err != nil {
+		return candidatePage{}, err
+	}
+	defer rows.Close()
+
+	// One more profile than asked for tells whether there is a next page
+	page := candidatePage{Candidates: []candidate{}}
+	for rows.Next() {
+		if len(page.Candidates) == limit {
+			page.NextCursor = discoverCursor{Day: start.Day, After: page.Candidates[limit-1].Username}.encode()
+			break
+		}
+		var c candidate
+		if err := rows.Scan(&c.Username, &c.Gender, &c.Major, &c.GradYear, &c.Age); err != nil {
+			return candidatePage{}, err
+		}
+		page.Candidates = append(page.Candidates, c)
+	}
+	if err := rows.Err(); err != nil {
+		return candidatePage{}, err
+	}
+	return page, nil
+}
+
+// The condition of the discover stack query that a field of the profile of
+// c.username is visible to the viewer, as profileAudience.canSee decides
+func visibleInStack(field string) string {
+	return `NOT EXISTS (SELECT 1 FROM profile_visibility WHERE profile_visibility.username = c.username AND profile_visibility.field = '` + field + `'
+				AND NOT (c.matched OR profile_visibility.visibility = 'followers' AND c.mutual_follower))`
+}
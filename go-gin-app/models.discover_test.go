@@ -0,0 +1,200 @@
+// models.discover_test.go
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Register the users of the discover tests, all of them majoring in
+// "Discovery Studies" so that the fixtures stay out of the stack. Returns
+// a function removing them
+func registerDiscoverUsers(t *testing.T) func() {
+	users := []user{
+		{Gatorlink: "discoViewer@ufl.edu", Username: "discoViewer", Password: "p", Gender: "male", Birthday: "2000-01-01"},
+		{Gatorlink: "discoA@ufl.edu", Username: "discoA", Password: "p", Gender: "female", Birthday: "2002-06-15"},
+		{Gatorlink: "discoB@ufl.edu", Username: "discoB", Password: "p", Gender: "male", Birthday: "2001-03-02"},
+		{Gatorlink: "discoC@ufl.edu", Username: "discoC", Password: "p", Gender: "female", Birthday: "1970-11-20"},
+	}
+	for _, u := range users {
+		registerActiveUser(t, u)
+	}
+	DB.Exec("UPDATE users SET major = 'Discovery Studies', grad_year = 2026 WHERE username LIKE 'disco%'")
+	return func() {
+		for _, u := range users {
+			deleteUser(u.Username)
+		}
+	}
+}
+
+// Return the usernames of a page, separated by commas
+func describeCandidates(page candidatePage) string {
+	names := []string{}
+	for _, c := range page.Candidates {
+		names = append(names, c.Username)
+	}
+	return strings.Join(names, ",")
+}
+
+// Test that the discover stack follows the preferences, leaves out rated and
+// blocked users, and keeps its order for the day
+func TestDiscoverStack(t *testing.T) {
+	defer registerDiscoverUsers(t)()
+
+	if prefs, err := getDiscoverPreferences("discoViewer"); err != nil || prefs != defaultDiscoverPreferences {
+		t.Errorf("got %+v, %v", prefs, err)
+	}
+
+	major := "discovery studies"
+	prefs := discoverPreferences{InterestedIn: "everyone", MinAge: 18, MaxAge: 99, Major: &major}
+	if err := setDiscoverPreferences("discoViewer", prefs); err != nil {
+		t.Fatal(err)
+	}
+	page, err := getDiscoverStack("discoViewer", nil, 10)
+	if err != nil || len(page.Candidates) != 3 || page.NextCursor != "" {
+		t.Fatalf("got %+v, %v", page, err)
+	}
+	for _, c := range page.Candidates {
+		if c.Major == nil || *c.Major != "Discovery Studies" || c.GradYear == nil || *c.GradYear != 2026 || c.Age == nil || *c.Age < 18 || c.Gender == nil {
+			t.Errorf("got %+v", c)
+		}
+	}
+	// The order is the one of the keys of the day
+	day := time.Now().UTC().Format("2006-01-02")
+	for i := 1; i < len(page.Candidates); i++ {
+		if discoverKey("discoViewer", day, page.Candidates[i-1].Username) > discoverKey("discoViewer", day, page.Candidates[i].Username) {
+			t.Errorf("%s is out of order", describeCandidates(page))
+		}
+	}
+	// The order stays the same
+	if again, _ := getDiscoverStack("discoViewer", nil, 10); describeCandidates(again) != describeCandidates(page) {
+		t.Errorf("got %s, then %s", describeCandidates(page), describeCandidates(again))
+	}
+
+	// One profile at a time, even when the last one was rated in between
+	first, err := getDiscoverStack("discoViewer", nil, 1)
+	if err != nil || len(first.Candidates) != 1 || first.Candidates[0].Username != page.Candidates[0].Username || first.NextCursor == "" {
+		t.Fatalf("got %+v, %v", first, err)
+	}
+	if _, err := setInterest("discoViewer", first.Candidates[0].Username, false); err != nil {
+		t.Fatal(err)
+	}
+	cur, err := decodeDiscoverCursor(first.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rest, _ := getDiscoverStack("discoViewer", &cur, 10); describeCandidates(rest) != describeCandidates(candidatePage{Candidates: page.Candidates[1:]}) {
+		t.Errorf("got %s after %s", describeCandidates(rest), describeCandidates(page))
+	}
+	if again, _ := getDiscoverStack("discoViewer", nil, 10); len(again.Candidates) != 2 {
+		t.Errorf("a skipped profile came back: %s", describeCandidates(again))
+	}
+	DB.Exec("DELETE FROM interests WHERE username = 'discoViewer'")
+
+	prefs.InterestedIn, prefs.MaxAge = "female", 30
+	setDiscoverPreferences("discoViewer", prefs)
+	if page, _ := getDiscoverStack("discoViewer", nil, 10); describeCandidates(page) != "discoA" {
+		t.Errorf("got %s", describeCandidates(page))
+	}
+
+	blockUser("discoA", "discoViewer")
+	if page, _ := getDiscoverStack("discoViewer", nil, 10); len(page.Candidates) != 0 {
+		t.Errorf("a user who blocked the viewer was shown: %s", describeCandidates(page))
+	}
+
+	// The preferences go away with the account
+	deleteUser("discoViewer")
+	var left int
+	DB.QueryRow("SELECT COUNT(*) FROM discover_preferences WHERE username = 'discoViewer'").Scan(&left)
+	if left != 0 {
+		t.Error("the preferences were kept")
+	}
+}
+
+// Test that the stack shows the fields as the profiles do, and that a
+// preference on a hidden field leaves the user out whether it matches or not
+func TestDiscoverHiddenFields(t *testing.T) {
+	defer registerDiscoverUsers(t)()
+	defer DB.Exec("DELETE FROM subscribe WHERE star LIKE 'disco%'")
+
+	// Only the users of the test graduate in 2026
+	year := 2026
+	prefs := discoverPreferences{InterestedIn: "everyone", MinAge: 18, MaxAge: 99, GradYear: &year}
+	stack := func(prefs discoverPreferences) (candidatePage, string) {
+		t.Helper()
+		if err := setDiscoverPreferences("discoViewer", prefs); err != nil {
+			t.Fatal(err)
+		}
+		page, err := getDiscoverStack("discoViewer", nil, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := strings.Split(describeCandidates(page), ",")
+		sort.Strings(names)
+		return page, strings.Join(names, ",")
+	}
+
+	// discoA is 24 and majors in Discovery Studies like the others
+	setProfileVisibility("discoA", map[string]string{"age": visibilityMatches, "major": visibilityFollowers})
+	page, names := stack(prefs)
+	if names != "discoA,discoB,discoC" {
+		t.Fatalf("got %s", names)
+	}
+	for _, c := range page.Candidates {
+		hidden := c.Age == nil && c.Major == nil
+		if hidden != (c.Username == "discoA") || c.Gender == nil || c.GradYear == nil {
+			t.Errorf("got %+v", c)
+		}
+	}
+
+	major, other := "Discovery Studies", "Other Studies"
+	for _, test := range []struct {
+		minAge, maxAge int
+		major          *string
+		want           string
+	}{
+		{20, 30, nil, "discoB"},
+		{40, 99, nil, "discoC"},
+		{18, 99, &major, "discoB,discoC"},
+		{18, 99, &other, ""},
+	} {
+		prefs.MinAge, prefs.MaxAge, prefs.Major = test.minAge, test.maxAge, test.major
+		if _, names := stack(prefs); names != test.want {
+			t.Errorf("ages %d to %d, major %v: got %s, want %s", test.minAge, test.maxAge, test.major, names, test.want)
+		}
+	}
+
+	// Following each other shows the major, not the age for matches only
+	performSubscribe("discoA", "discoViewer")
+	performSubscribe("discoViewer", "discoA")
+	prefs.Major = &major
+	if _, names := stack(prefs); names != "discoA,discoB,discoC" {
+		t.Errorf("got %s for a follower followed back", names)
+	}
+	prefs.MinAge, prefs.MaxAge = 20, 30
+	if _, names := stack(prefs); names != "discoB" {
+		t.Errorf("got %s", names)
+	}
+}
+
+// Test the validation of the discover preferences
+func TestDiscoverPreferencesValidate(t *testing.T) {
+	if problems := defaultDiscoverPreferences.validate(); len(problems) != 0 {
+		t.Errorf("got %v", problems)
+	}
+	year := 1900
+	prefs := discoverPreferences{InterestedIn: "robots", MinAge: 17, MaxAge: 100, GradYear: &year}
+	problems := prefs.validate()
+	for _, field := range []string{"interestedIn", "minAge", "maxAge", "gradYear"} {
+		if problems[field] == "" {
+			t.Errorf("%s should have been rejected", field)
+		}
+	}
+	prefs = discoverPreferences{InterestedIn: "male", MinAge: 30, MaxAge: 20}
+	if problems := prefs.validate(); problems["maxAge"] == "" {
+		t.Errorf("got %v", problems)
+	}
+}
@@ -0,0 +1,159 @@
+// models.feed.go
+
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// The page sizes of the article feed
+const (
+	defaultFeedLimit = 20
+	maxFeedLimit     = 100
+)
+
+var errInvalidCursor = errors.New("The cursor is invalid")
+
+// How each sort mode ranks the articles, the highest first. The hot score is
+// the net likes plus the comments, divided by the square of the age in hours
+// plus two, so that new articles rise and old ones sink. The age is counted
+// from :as_of so that the scores don't move while a feed is being scrolled
+var feedSortKeys = map[string]string{
+	"newest":    "julianday(post_time)",
+	"liked":     "likes",
+	"discussed": "comments",
+	"hot": "(likes - dislikes + comments) / " +
+		"((MAX(julianday(:as_of) - julianday(post_time), 0) * 24 + 2) * (MAX(julianday(:as_of) - julianday(post_time), 0) * 24 + 2))",
+}
+
+// An article of the feed with its number of comments
+type feedArticle struct {
+	article
+	Comments int `json:"comments"`
+}
+
+// A page of the feed. The cursors are empty when there is no page on
+// that side
+type articlePage struct {
+	Articles   []feedArticle `json:"articles"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+	PrevCursor string        `json:"prevCursor,omitempty"`
+}
+
+// The position of a page in the feed: the sort key and ID of the article
+// the page starts after, or ends before
+type feedCursor struct {
+	Sort   string  `json:"s"`
+	Key    float64 `json:"k"`
+	ID     int     `json:"i"`
+	Before bool    `json:"b,omitempty"`
+	// Unix time the hot scores are computed at
+	AsOf int64 `json:"t"`
+}
+
+// Encode a cursor as an opaque URL-safe string
+func (cur feedCursor) encode() string {
+	raw, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Decode a cursor given by a client
+func decodeFeedCursor(s string) (feedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return feedCursor{}, errInvalidCursor
+	}
+	var cur feedCursor
+	if err := json.Unmarshal(raw, &cur); err != nil {
+		return feedCursor{}, errInvalidCursor
+	}
+	if _, ok := feedSortKeys[cur.Sort]; !ok || cur.ID <= 0 {
+		return feedCursor{}, errInvalidCursor
+	}
+	return cur, nil
+}
+
+// Return a page of at most limit articles in the order of the sort mode,
+// from the start of the feed when cur is nil
+func getArticleFeed(sort string, cur *feedCursor, limit int) (articlePage, error) {
+	start := feedCursor{Sort: sort, AsOf: time.Now().Unix()}
+	if cur != nil {
+		start = *cur
+	}
+
+	query := `WITH feed AS (
+			SELECT id, author, title, post_time, content, likes, dislikes,
+				(SELECT COUNT(*) FROM comment WHERE comment.topic_id = articles.id AND comment.deleted_at IS NULL) AS comments
+			FROM articles WHERE deleted_at IS NULL
+		), keyed AS (
+			SELECT *, COALESCE(CAST(` + feedSortKeys[sort] + ` AS REAL), 0) AS sort_key FROM feed
+		)
+		SELECT id, author, title, post_time, content, likes, dislikes, comments, sort_key FROM keyed`
+	switch {
+	case cur == nil:
+		query += " ORDER BY sort_key DESC, id DESC"
+	case cur.Before:
+		query += " WHERE sort_key > :key OR (sort_key = :key AND id > :id) ORDER BY sort_key ASC, id ASC"
+	default:
+		query += " WHERE sort_key < :key OR (sort_key = :key AND id < :id) ORDER BY sort_key DESC, id DESC"
+	}
+	query += " LIMIT :limit"
+
+	rows, err := DB.Query(query,
+		sql.Named("as_of", time.Unix(start.AsOf, 0).UTC().Format("2006-01-02 15:04:05")),
+		sql.Named("key", start.Key),
+		sql.Named("id", start.ID),
+		sql.Named("limit", limit+1))
+	if err != nil {
+		return articlePage{}, err
+	}
+	defer rows.Close()
+
+	articles := make([]feedArticle, 0, limit+1)
+	keys := make([]float64, 0, limit+1)
+	for rows.Next() {
+		var a feedArticle
+		var key float64
+		if err := rows.Scan(&a.ID, &a.Author, &a.Title, &a.PostTime, &a.Content, &a.Likes, &a.Dislikes, &a.Comments, &key); err != nil {
+			return articlePage{}, err
+		}
+		articles = append(articles, a)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return articlePage{}, err
+	}
+
+	hasMore := len(articles) > limit
+	if hasMore {
+		articles, keys = articles[:limit], keys[:limit]
+	}
+	// A previous page was read backwards
+	backwards := cur != nil && cur.Before
+	if backwards {
+		for i, j := 0, len(articles)-1; i < j; i, j = i+1, j-1 {
+			articles[i], articles[j] = articles[j], articles[i]
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+
+	page := articlePage{Articles: articles}
+	if len(articles) == 0 {
+		return page, nil
+	}
+	first, last := 0, len(articles)-1
+	// There is a next page when more articles were found going forwards, or
+	// when coming back from it. Likewise for the previous page, which the
+	// first page doesn't have
+	if hasMore || backwards {
+		page.NextCursor = feedCursor{Sort: sort, Key: keys[last], ID: articles[last].ID, AsOf: start.AsOf}.encode()
+	}
+	if backwards && hasMore || !backwards && cur != nil {
+		page.PrevCursor = feedCursor{Sort: sort, Key: keys[first], ID: articles[first].ID, Before: true, AsOf: start.AsOf}.encode()
+	}
+	return page, nil
+}
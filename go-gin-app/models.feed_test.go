@@ -0,0 +1,122 @@
+// models.feed_test.go
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Test that walking the feed page by page, forwards then backwards, finds
+// every article once in the order of each sort mode
+func TestArticleFeedPages(t *testing.T) {
+	for i := 0; i < 5; i++ {
+		if _, err := createNewArticle(article{Title: "Feed test", Content: fmt.Sprint(i)}, "user_mj"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer deleteArticleByTitle("Feed test")
+	// Give some of them the same post time, likes and comments as others
+	DB.Exec("UPDATE articles SET post_time = '2022-04-13 14:14:38', likes = 3 WHERE title = 'Feed test' AND content IN ('1', '3')")
+
+	for sort := range feedSortKeys {
+		all, err := getArticleFeed(sort, nil, maxFeedLimit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all.Articles) < 7 || all.NextCursor != "" || all.PrevCursor != "" {
+			t.Fatalf("%s: got %d articles, cursors %q %q", sort, len(all.Articles), all.NextCursor, all.PrevCursor)
+		}
+
+		var pages []articlePage
+		var walked []int
+		for page, cur := (articlePage{}), (*feedCursor)(nil); ; {
+			if page, err = getArticleFeed(sort, cur, 2); err != nil {
+				t.Fatal(err)
+			}
+			pages = append(pages, page)
+			for _, a := range page.Articles {
+				walked = append(walked, a.ID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			next, err := decodeFeedCursor(page.NextCursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cur = &next
+		}
+		if fmt.Sprint(walked) != fmt.Sprint(feedIds(all)) {
+			t.Errorf("%s: walked %v, want %v", sort, walked, feedIds(all))
+		}
+		if pages[0].PrevCursor != "" {
+			t.Errorf("%s: the first page has a previous page", sort)
+		}
+
+		// Going back from the last page finds the same pages
+		for i := len(pages) - 1; i > 0; i-- {
+			prev, err := decodeFeedCursor(pages[i].PrevCursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			page, err := getArticleFeed(sort, &prev, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(feedIds(page)) != fmt.Sprint(feedIds(pages[i-1])) || (i == 1) != (page.PrevCursor == "") {
+				t.Errorf("%s: page %d back is %v, want %v", sort, i-1, feedIds(page), feedIds(pages[i-1]))
+			}
+		}
+	}
+}
+
+func feedIds(page articlePage) []int {
+	ids := make([]int, 0, len(page.Articles))
+	for _, a := range page.Articles {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
+
+// Test that each sort mode puts the right article first
+func TestArticleFeedOrder(t *testing.T) {
+	for _, title := range []string{"Feed old", "Feed liked", "Feed discussed", "Feed new"} {
+		if _, err := createNewArticle(article{Title: title, Content: title}, "user_mj"); err != nil {
+			t.Fatal(err)
+		}
+		defer deleteArticleByTitle(title)
+	}
+	DB.Exec("UPDATE articles SET post_time = datetime('now', '-2 days'), likes = 1000 WHERE title = 'Feed old'")
+	DB.Exec("UPDATE articles SET post_time = datetime('now', '-1 hours'), likes = 999 WHERE title = 'Feed liked'")
+	DB.Exec("UPDATE articles SET post_time = datetime('now', '-3 hours') WHERE title = 'Feed discussed'")
+	DB.Exec("UPDATE articles SET post_time = datetime('now', '+1 minutes') WHERE title = 'Feed new'")
+	var discussed int
+	DB.QueryRow("SELECT id FROM articles WHERE title = 'Feed discussed'").Scan(&discussed)
+	for i := 0; i < 50; i++ {
+		createNewComment(comment{ArticleId: discussed, CommentAuthor: "user2", Content: "busy"})
+	}
+
+	for sort, want := range map[string]string{"newest": "Feed new", "liked": "Feed old", "discussed": "Feed discussed", "hot": "Feed liked"} {
+		page, err := getArticleFeed(sort, nil, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Articles) != 1 || page.Articles[0].Title != want {
+			t.Errorf("%s: got %+v first, want %s", sort, page.Articles, want)
+		}
+	}
+}
+
+// Test that cursors that were not issued by the feed are refused
+func TestDecodeFeedCursor(t *testing.T) {
+	valid := feedCursor{Sort: "hot", Key: 0.25, ID: 3, AsOf: 1650000000}
+	if cur, err := decodeFeedCursor(valid.encode()); err != nil || cur != valid {
+		t.Errorf("got %+v, %v", cur, err)
+	}
+	for _, raw := range []string{"", "not base64!", "e30", feedCursor{Sort: "oldest", ID: 1}.encode(), feedCursor{Sort: "hot"}.encode()} {
+		if _, err := decodeFeedCursor(raw); err != errInvalidCursor {
+			t.Errorf("%q was accepted", raw)
+		}
+	}
+}
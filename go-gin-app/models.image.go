@@ -0,0 +1,158 @@
+// models.image.go
+
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Return the owner of an uploaded image, or "" for a file uploaded before
+// owners were recorded
+func getImageOwner(filename string) (string, error) {
+	stmt, err := DB.Prepare("SELECT owner FROM images WHERE filename = ?")
+	if err != nil {
+		return "", err
+	}
+	defer stmt.Close()
+
+	var owner string
+	sqlErr := stmt.QueryRow(filename).Scan(&owner)
+	if sqlErr == sql.ErrNoRows {
+		return "", nil
+	}
+	return owner, sqlErr
+}
+
+// Record the owner of an uploaded image, keeping the original upload time
+// when the owner replaces the file
+func setImageOwner(filename string, owner string) error {
+	stmt, err := DB.Prepare("INSERT INTO images (filename, owner, uploaded_at) VALUES (?, ?, ?) ON CONFLICT (filename) DO NOTHING")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(filename, owner, time.Now().UTC())
+	return err
+}
+
+// Forget the owner of a deleted image and take it out of the galleries
+func deleteImageOwner(filename string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM profile_photos WHERE filename = ?", filename); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM images WHERE filename = ?", filename); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// The content types of the images users can upload, by extension
+var imageTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+var errUnsupportedImage = errors.New("must be a JPEG, PNG, GIF or WebP image")
+
+// Check that an upload is an image: its extension must be one of
+// imageTypes and its first bytes of the same type. Returns
+// errUnsupportedImage otherwise
+func checkImageUpload(file *multipart.FileHeader) error {
+	want, ok := imageTypes[strings.ToLower(filepath.Ext(file.Filename))]
+	if !ok {
+		return errUnsupportedImage
+	}
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return errUnsupportedImage
+	}
+	if http.DetectContentType(head[:n]) != want {
+		return errUnsupportedImage
+	}
+	return nil
+}
+
+// Generate the name an upload is stored under: 16 random bytes in hex and
+// the extension of the original name, so that the names of the files can't
+// be guessed. The extension is only kept for the types of imageTypes
+func generateImageFilename(original string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(b)
+	if ext := strings.ToLower(filepath.Ext(original)); imageTypes[ext] != "" {
+		name += ext
+	}
+	return name, nil
+}
+
+// Return whether a user may download an image: the owner, the members of the
+// conversations it was sent in, anyone when an article or comment shows it,
+// and the users who may see the gallery it is in. Moderators are checked by
+// the caller
+func canViewImage(viewer string, filename string) (bool, error) {
+	link := "/image/download/" + url.PathEscape(filename)
+	var allowed bool
+	err := DB.QueryRow(`SELECT
+			EXISTS (SELECT 1 FROM images WHERE filename = ?1 AND owner = ?2)
+			OR EXISTS (SELECT 1 FROM messages JOIN conversation_members USING (conversation_id)
+				WHERE messages.image = ?1 AND conversation_members.username = ?2)
+			OR EXISTS (SELECT 1 FROM articles WHERE deleted_at IS NULL AND instr(content, ?3) > 0)
+			OR EXISTS (SELECT 1 FROM comment WHERE deleted_at IS NULL AND instr(comment_content, ?3) > 0)`,
+		filename, viewer, link).Scan(&allowed)
+	if err != nil || allowed {
+		return allowed, err
+	}
+	return canViewGalleryImage(viewer, filename)
+}
+
+// Return whether the image is in the gallery of an active account whose
+// photos the viewer may see
+func canViewGalleryImage(viewer string, filename string) (bool, error) {
+	var owner string
+	err := DB.QueryRow(`SELECT profile_photos.username FROM profile_photos JOIN users USING (username)
+		WHERE filename = ? AND status = 'active' AND deleted_at IS NULL`, filename).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	audience, err := getProfileAudience(viewer, owner)
+	if err != nil || audience.blocked {
+		return false, err
+	}
+	visibility, err := getProfileVisibility(owner)
+	if err != nil {
+		return false, err
+	}
+	return audience.canSee(visibility["photos"]), nil
+}
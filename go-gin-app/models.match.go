@@ -0,0 +1,126 @@
+// models.match.go
+
+package main
+
+// A user the current user matched with
+type match struct {
+	Username  string `json:"username"`
+	MatchedAt string `json:"matchedAt"`
+}
+
+// Order the usernames of a pair the way the matches and conversations
+// tables store them
+func orderedPair(a string, b string) (string, string) {
+	if b < a {
+		return b, a
+	}
+	return a, b
+}
+
+// Record the interest in (true) or pass on (false) the profile of target.
+// Interest on both sides makes a match, and both users are notified; the
+// interest of one side alone is never shown to the other. Passing on a
+// match undoes it. Returns whether the users are matched now, or errBlocked
+// if either of them blocked the other
+func setInterest(username string, target string, interested bool) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	blocked, err := isBlockedTx(tx, username, target)
+	if err != nil {
+		return false, err
+	}
+	if blocked {
+		return false, errBlocked
+	}
+
+	kind := "pass"
+	if interested {
+		kind = "interest"
+	}
+	if _, err := tx.Exec(`INSERT INTO interests (username, target, kind, created_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (username, target) DO UPDATE SET kind = excluded.kind, created_at = excluded.created_at`, username, target, kind); err != nil {
+		return false, err
+	}
+
+	a, b := orderedPair(username, target)
+	if !interested {
+		if _, err := tx.Exec("DELETE FROM matches WHERE user_a = ? AND user_b = ?", a, b); err != nil {
+			return false, err
+		}
+		return false, tx.Commit()
+	}
+
+	var mutual bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM interests WHERE username = ? AND target = ? AND kind = 'interest')", target, username).Scan(&mutual); err != nil {
+		return false, err
+	}
+	if !mutual {
+		return false, tx.Commit()
+	}
+
+	result, err := tx.Exec("INSERT INTO matches (user_a, user_b, matched_at) VALUES (?, ?, CURRENT_TIMESTAMP) ON CONFLICT (user_a, user_b) DO NOTHING", a, b)
+	if err != nil {
+		return false, err
+	}
+	num, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if num == 1 {
+		for _, n := range []notification{
+			{Recipient: username, Kind: notifyMatch, Actor: target},
+			{Recipient: target, Kind: notifyMatch, Actor: username},
+		} {
+			if err := notifyTx(tx, n); err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, tx.Commit()
+}
+
+// Return the matches of a user whose other side still has an account, the
+// newest first
+func getMatches(username string) ([]match, error) {
+	rows, err := DB.Query(`SELECT CASE WHEN user_a = ?1 THEN user_b ELSE user_a END AS other, matched_at FROM matches
+		JOIN users ON users.username = CASE WHEN user_a = ?1 THEN user_b ELSE user_a END AND users.deleted_at IS NULL
+		WHERE user_a = ?1 OR user_b = ?1
+		ORDER BY matched_at DESC, other`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []match{}
+	for rows.Next() {
+		var m match
+		if err := rows.Scan(&m.Username, &m.MatchedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// Undo a match, turning the interest of the user into a pass so that the
+// match isn't made again. Returns sql.ErrNoRows if they aren't matched
+func unmatch(username string, other string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	a, b := orderedPair(username, other)
+	if err := execAffectingOne(tx, "DELETE FROM matches WHERE user_a = ? AND user_b = ?", a, b); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE interests SET kind = 'pass', created_at = CURRENT_TIMESTAMP WHERE username = ? AND target = ?", username, other); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,82 @@
+// models.match_test.go
+
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// Remove the interests, match and match notifications of two users
+func deleteTestMatch(a string, b string) {
+	DB.Exec("DELETE FROM interests WHERE username IN (?1, ?2) AND target IN (?1, ?2)", a, b)
+	DB.Exec("DELETE FROM matches WHERE user_a IN (?1, ?2) AND user_b IN (?1, ?2)", a, b)
+	DB.Exec("DELETE FROM notifications WHERE kind = 'match' AND recipient IN (?1, ?2)", a, b)
+}
+
+// Test that only mutual interest makes a match, that unmatching keeps the
+// match from coming back, and that blocking ends it
+func TestMatching(t *testing.T) {
+	defer deleteTestMatch("user2", "user3")
+
+	matched, err := setInterest("user2", "user3", true)
+	if err != nil || matched {
+		t.Fatalf("got %v, %v", matched, err)
+	}
+	// The one-sided interest is invisible to user3
+	if got := describeNotifications(t, "user3"); got != "[]" {
+		t.Errorf("user3 was told %s", got)
+	}
+
+	if matched, err := setInterest("user3", "user2", true); err != nil || !matched {
+		t.Fatalf("got %v, %v", matched, err)
+	}
+	for _, pair := range [][2]string{{"user2", "user3"}, {"user3", "user2"}} {
+		if got := describeNotifications(t, pair[0]); got != "[match:"+pair[1]+"]" {
+			t.Errorf("%s got %s", pair[0], got)
+		}
+		if list, err := getMatches(pair[0]); err != nil || len(list) != 1 || list[0].Username != pair[1] {
+			t.Errorf("%s got %+v, %v", pair[0], list, err)
+		}
+	}
+
+	// Unmatching is a pass, liking again doesn't match
+	if err := unmatch("user3", "user2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := unmatch("user3", "user2"); err != sql.ErrNoRows {
+		t.Errorf("unmatched twice: %v", err)
+	}
+	if matched, _ := setInterest("user2", "user3", true); matched {
+		t.Error("matched again after the unmatch")
+	}
+	if matched, _ := setInterest("user3", "user2", true); !matched {
+		t.Error("not matched after liking again")
+	}
+	if matched, _ := setInterest("user2", "user3", false); matched {
+		t.Error("still matched after passing")
+	}
+	if list, _ := getMatches("user3"); len(list) != 0 {
+		t.Errorf("got %+v", list)
+	}
+
+	// Blocking removes the match and the interests
+	if matched, _ := setInterest("user2", "user3", true); !matched {
+		t.Fatal("not matched before the block")
+	}
+	blockUser("user2", "user3")
+	defer unblockUser("user2", "user3")
+	if _, err := setInterest("user3", "user2", true); err != errBlocked {
+		t.Errorf("a blocked user showed interest: %v", err)
+	}
+	for _, username := range []string{"user2", "user3"} {
+		if list, _ := getMatches(username); len(list) != 0 {
+			t.Errorf("%s is still matched: %+v", username, list)
+		}
+	}
+	var left int
+	DB.QueryRow("SELECT COUNT(*) FROM interests WHERE username IN ('user2', 'user3') AND target IN ('user2', 'user3')").Scan(&left)
+	if left != 0 {
+		t.Errorf("%d interests are left after the block", left)
+	}
+}
@@ -0,0 +1,252 @@
+// models.message.go
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// The page sizes of the message history, and the longest message
+const (
+	defaultMessageLimit = 50
+	maxMessageLimit     = 100
+	maxMessageLength    = 5000
+)
+
+var (
+	errBlocked          = errors.New("One of you blocked the other")
+	errSelfConversation = errors.New("You can't start a conversation with yourself")
+)
+
+// A private message. Image is the name of a file uploaded to /image/upload
+type message struct {
+	ID             int    `json:"id"`
+	ConversationId int    `json:"conversationId"`
+	Sender         string `json:"sender"`
+	Content        string `json:"content"`
+	Image          string `json:"image,omitempty"`
+	ImageURL       string `json:"imageUrl,omitempty"`
+	SentAt         string `json:"sentAt"`
+}
+
+// A conversation as one of its members sees it: the other member, the last
+// message if any, and how many messages of the other member are unread
+type conversation struct {
+	ID          int      `json:"id"`
+	With        string   `json:"with"`
+	CreatedAt   string   `json:"createdAt"`
+	LastMessage *message `json:"lastMessage"`
+	Unread      int      `json:"unread"`
+}
+
+// A page of the history of a conversation, the newest message first.
+// NextBefore is the before parameter of the next page, 0 on the last page
+type messagePage struct {
+	Messages   []message `json:"messages"`
+	NextBefore int       `json:"nextBefore,omitempty"`
+}
+
+// The conversations of :username whose other member still has an account,
+// the most recently active first
+const conversationQuery = `SELECT c.conversation_id, o.username, c.created_at,
+		(SELECT COUNT(*) FROM messages WHERE conversation_id = c.conversation_id AND message_id > m.last_read_id AND sender != m.username),
+		lm.message_id, lm.sender, lm.content, lm.image, lm.sent_at
+	FROM conversation_members m
+	JOIN conversations c ON c.conversation_id = m.conversation_id
+	JOIN conversation_members o ON o.conversation_id = m.conversation_id AND o.username != m.username
+	JOIN users u ON u.username = o.username AND u.deleted_at IS NULL
+	LEFT JOIN messages lm ON lm.message_id = (SELECT MAX(message_id) FROM messages WHERE conversation_id = c.conversation_id)
+	WHERE m.username = :username`
+
+// Return the conversations of a user, the most recently active first
+func getConversations(username string) ([]conversation, error) {
+	return queryConversations(conversationQuery+" ORDER BY COALESCE(lm.sent_at, c.created_at) DESC, c.conversation_id DESC", sql.Named("username", username))
+}
+
+// Return a conversation of a user, sql.ErrNoRows if the user isn't a member
+// or the other member was deleted
+func getConversation(id int, username string) (conversation, error) {
+	list, err := queryConversations(conversationQuery+" AND c.conversation_id = :id", sql.Named("username", username), sql.Named("id", id))
+	if err != nil {
+		return conversation{}, err
+	}
+	if len(list) == 0 {
+		return conversation{}, sql.ErrNoRows
+	}
+	return list[0], nil
+}
+
+func queryConversations(query string, args ...interface{}) ([]conversation, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []conversation{}
+	for rows.Next() {
+		var c conversation
+		var lastId *int
+		var sender, content, image, sentAt *string
+		if err := rows.Scan(&c.ID, &c.With, &c.CreatedAt, &c.Unread, &lastId, &sender, &content, &image, &sentAt); err != nil {
+			return nil, err
+		}
+		if lastId != nil {
+			c.LastMessage = &message{ID: *lastId, ConversationId: c.ID, Sender: *sender, Content: *content, SentAt: *sentAt}
+			if image != nil {
+				c.LastMessage.setImage(*image)
+			}
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+func (m *message) setImage(filename string) {
+	m.Image = filename
+	m.ImageURL = imageURL(filename)
+}
+
+// Return the conversation of two users, starting it if there is none yet.
+// Returns errBlocked if either of them blocked the other
+func startConversation(from string, to string) (conversation, error) {
+	if from == to {
+		return conversation{}, errSelfConversation
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return conversation{}, err
+	}
+	defer tx.Rollback()
+
+	blocked, err := isBlockedTx(tx, from, to)
+	if err != nil {
+		return conversation{}, err
+	}
+	if blocked {
+		return conversation{}, errBlocked
+	}
+
+	a, b := orderedPair(from, to)
+	if _, err := tx.Exec("INSERT INTO conversations (user_a, user_b, created_at) VALUES (?, ?, CURRENT_TIMESTAMP) ON CONFLICT (user_a, user_b) DO NOTHING", a, b); err != nil {
+		return conversation{}, err
+	}
+	var id int
+	if err := tx.QueryRow("SELECT conversation_id FROM conversations WHERE user_a = ? AND user_b = ?", a, b).Scan(&id); err != nil {
+		return conversation{}, err
+	}
+	if _, err := tx.Exec("INSERT OR IGNORE INTO conversation_members (conversation_id, username) VALUES (?1, ?2), (?1, ?3)", id, a, b); err != nil {
+		return conversation{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return conversation{}, err
+	}
+	return getConversation(id, from)
+}
+
+// Send a message to the other member of a conversation, image being "" or
+// the name of an uploaded file. Sending reads the conversation.
+// Returns sql.ErrNoRows if the sender isn't a member, errBlocked if either
+// member blocked the other
+func sendMessage(conversationId int, sender string, content string, image string) (message, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return message{}, err
+	}
+	defer tx.Rollback()
+
+	var other string
+	sqlErr := tx.QueryRow(`SELECT o.username FROM conversation_members m
+		JOIN conversation_members o ON o.conversation_id = m.conversation_id AND o.username != m.username
+		WHERE m.conversation_id = ? AND m.username = ?`, conversationId, sender).Scan(&other)
+	if sqlErr != nil {
+		return message{}, sqlErr
+	}
+	blocked, err := isBlockedTx(tx, sender, other)
+	if err != nil {
+		return message{}, err
+	}
+	if blocked {
+		return message{}, errBlocked
+	}
+
+	var imageArg interface{}
+	if image != "" {
+		imageArg = image
+	}
+	result, err := tx.Exec("INSERT INTO messages (conversation_id, sender, content, image, sent_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)",
+		conversationId, sender, content, imageArg)
+	if err != nil {
+		return message{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return message{}, err
+	}
+	if _, err := tx.Exec("UPDATE conversation_members SET last_read_id = ? WHERE conversation_id = ? AND username = ?", id, conversationId, sender); err != nil {
+		return message{}, err
+	}
+
+	m := message{ID: int(id), ConversationId: conversationId, Sender: sender, Content: content}
+	if err := tx.QueryRow("SELECT sent_at FROM messages WHERE message_id = ?", id).Scan(&m.SentAt); err != nil {
+		return message{}, err
+	}
+	if image != "" {
+		m.setImage(image)
+	}
+	if err := tx.Commit(); err != nil {
+		return message{}, err
+	}
+
+	// Push the message to the other member online
+	events.publish(event{Type: eventMessage, To: other, Data: m})
+	return m, nil
+}
+
+// Return the messages of a conversation older than the message before, or
+// the newest ones when before is 0
+func getMessages(conversationId int, before int, limit int) (messagePage, error) {
+	query := "SELECT message_id, sender, content, COALESCE(image, ''), sent_at FROM messages WHERE conversation_id = :id"
+	if before > 0 {
+		query += " AND message_id < :before"
+	}
+	query += " ORDER BY message_id DESC LIMIT :limit"
+
+	rows, err := DB.Query(query, sql.Named("id", conversationId), sql.Named("before", before), sql.Named("limit", limit+1))
+	if err != nil {
+		return messagePage{}, err
+	}
+	defer rows.Close()
+
+	list := make([]message, 0, limit+1)
+	for rows.Next() {
+		m := message{ConversationId: conversationId}
+		var image string
+		if err := rows.Scan(&m.ID, &m.Sender, &m.Content, &image, &m.SentAt); err != nil {
+			return messagePage{}, err
+		}
+		if image != "" {
+			m.setImage(image)
+		}
+		list = append(list, m)
+	}
+	if err := rows.Err(); err != nil {
+		return messagePage{}, err
+	}
+
+	page := messagePage{Messages: list}
+	if len(list) > limit {
+		page.Messages = list[:limit]
+		page.NextBefore = list[limit-1].ID
+	}
+	return page, nil
+}
+
+// Mark every message of a conversation as read by a member
+func markConversationRead(conversationId int, username string) error {
+	_, err := DB.Exec(`UPDATE conversation_members SET last_read_id = (SELECT COALESCE(MAX(message_id), 0) FROM messages WHERE conversation_id = ?1)
+		WHERE conversation_id = ?1 AND username = ?2`, conversationId, username)
+	return err
+}
@@ -0,0 +1,138 @@
+// models.message_test.go
+
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// Remove the conversations of two users
+func deleteTestConversation(a string, b string) {
+	if b < a {
+		a, b = b, a
+	}
+	for _, query := range []string{
+		"DELETE FROM messages WHERE conversation_id IN (SELECT conversation_id FROM conversations WHERE user_a = ?1 AND user_b = ?2)",
+		"DELETE FROM conversation_members WHERE conversation_id IN (SELECT conversation_id FROM conversations WHERE user_a = ?1 AND user_b = ?2)",
+		"DELETE FROM conversations WHERE user_a = ?1 AND user_b = ?2",
+	} {
+		DB.Exec(query, a, b)
+	}
+}
+
+// Test a conversation from its start: unread counts, history pages and
+// blocks
+func TestConversation(t *testing.T) {
+	defer deleteTestConversation("user2", "user3")
+	defer DB.Exec("DELETE FROM blocks WHERE blocker IN ('user2', 'user3')")
+
+	conv, err := startConversation("user2", "user3")
+	if err != nil || conv.With != "user3" || conv.LastMessage != nil {
+		t.Fatalf("got %+v, %v", conv, err)
+	}
+	// Starting again returns the same conversation, from either side
+	if again, err := startConversation("user3", "user2"); err != nil || again.ID != conv.ID || again.With != "user2" {
+		t.Errorf("got %+v, %v", again, err)
+	}
+	if _, err := startConversation("user2", "user2"); err != errSelfConversation {
+		t.Errorf("talked to themselves: %v", err)
+	}
+
+	for _, text := range []string{"hi", "how are you", "?"} {
+		if _, err := sendMessage(conv.ID, "user2", text, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := sendMessage(conv.ID, "user1", "intruder", ""); err != sql.ErrNoRows {
+		t.Errorf("a user outside the conversation sent a message: %v", err)
+	}
+
+	list, err := getConversations("user3")
+	if err != nil || len(list) == 0 || list[0].ID != conv.ID {
+		t.Fatalf("got %+v, %v", list, err)
+	}
+	if list[0].Unread != 3 || list[0].LastMessage == nil || list[0].LastMessage.Content != "?" {
+		t.Errorf("got %+v", list[0])
+	}
+	// Answering reads the conversation
+	if _, err := sendMessage(conv.ID, "user3", "fine", ""); err != nil {
+		t.Fatal(err)
+	}
+	if theirs, _ := getConversation(conv.ID, "user3"); theirs.Unread != 0 {
+		t.Errorf("got %+v", theirs)
+	}
+	if mine, _ := getConversation(conv.ID, "user2"); mine.Unread != 1 || mine.LastMessage == nil || mine.LastMessage.Content != "fine" {
+		t.Errorf("got %+v", mine)
+	}
+	if _, err := getConversation(conv.ID, "user1"); err != sql.ErrNoRows {
+		t.Errorf("a user outside the conversation read it: %v", err)
+	}
+
+	page, err := getMessages(conv.ID, 0, 3)
+	if err != nil || len(page.Messages) != 3 || page.Messages[0].Content != "fine" || page.NextBefore != page.Messages[2].ID {
+		t.Fatalf("got %+v, %v", page, err)
+	}
+	if page, _ = getMessages(conv.ID, page.NextBefore, 3); len(page.Messages) != 1 || page.Messages[0].Content != "hi" || page.NextBefore != 0 {
+		t.Errorf("got %+v", page)
+	}
+
+	if err := markConversationRead(conv.ID, "user2"); err != nil {
+		t.Fatal(err)
+	}
+	if read, _ := getConversation(conv.ID, "user2"); read.Unread != 0 {
+		t.Errorf("got %+v", read)
+	}
+
+	// A block stops the messages both ways, until it is lifted
+	if err := blockUser("user3", "user2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sendMessage(conv.ID, "user2", "hello?", ""); err != errBlocked {
+		t.Errorf("a blocked user sent a message: %v", err)
+	}
+	if _, err := sendMessage(conv.ID, "user3", "bye", ""); err != errBlocked {
+		t.Errorf("the blocker sent a message: %v", err)
+	}
+	if _, err := startConversation("user2", "user3"); err != errBlocked {
+		t.Errorf("a blocked user started a conversation: %v", err)
+	}
+	if blocked, _ := getBlockedUsers("user3"); len(blocked) != 1 || blocked[0] != "user2" {
+		t.Errorf("got %v", blocked)
+	}
+	if err := unblockUser("user3", "user2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := unblockUser("user3", "user2"); err != sql.ErrNoRows {
+		t.Errorf("unblocked twice: %v", err)
+	}
+	if _, err := sendMessage(conv.ID, "user2", "hello again", ""); err != nil {
+		t.Errorf("got %v after the unblock", err)
+	}
+}
+
+// Test that deleting an account removes its conversations and blocks
+func TestDeleteUserWithMessages(t *testing.T) {
+	u := user{Gatorlink: "chatty@ufl.edu", Username: "chattyUser", Password: "p", Gender: "unknown"}
+	registerActiveUser(t, u)
+	defer deleteUser(u.Username)
+
+	conv, err := startConversation(u.Username, "user2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendMessage(conv.ID, u.Username, "hi", "")
+	sendMessage(conv.ID, "user2", "hello", "")
+	blockUser("user2", u.Username)
+
+	if _, err := deleteUser(u.Username); err != nil {
+		t.Fatal(err)
+	}
+	var left int
+	DB.QueryRow(`SELECT (SELECT COUNT(*) FROM messages WHERE conversation_id = ?1)
+		+ (SELECT COUNT(*) FROM conversations WHERE conversation_id = ?1)
+		+ (SELECT COUNT(*) FROM blocks WHERE blocked = ?2)`, conv.ID, u.Username).Scan(&left)
+	if left != 0 {
+		t.Errorf("%d rows of the user are left", left)
+	}
+}
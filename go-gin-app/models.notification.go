@@ -0,0 +1,199 @@
+// models.notification.go
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// The kinds of notifications
+const (
+	notifyComment = "comment" // a comment on an article of the user
+	notifyReply   = "reply"   // a reply to a comment of the user
+	notifyLike    = "like"    // a like on an article of the user
+	notifyFollow  = "follow"  // a new subscriber
+	notifyMatch   = "match"   // a mutual interest
+)
+
+var notificationKinds = []string{notifyComment, notifyReply, notifyLike, notifyFollow, notifyMatch}
+
+// The page sizes of the notification list
+const (
+	defaultNotificationLimit = 20
+	maxNotificationLimit     = 100
+)
+
+// The most notifications marked as read at once by their IDs
+const maxNotificationIDs = 100
+
+var errInvalidNotificationKind = errors.New("unknown kind of notification")
+
+// Something that happened to the content or the account of a user, caused
+// by the actor. The article and comment it is about, if any
+type notification struct {
+	ID        int    `json:"id"`
+	Recipient string `json:"-"`
+	Kind      string `json:"type"`
+	Actor     string `json:"actor"`
+	ArticleId *int   `json:"articleId,omitempty"`
+	CommentId *int   `json:"commentId,omitempty"`
+	CreatedAt string `json:"createdAt"`
+	Read      bool   `json:"read"`
+}
+
+// A page of notifications, the newest first. NextBefore is the before
+// parameter of the next page, 0 on the last page
+type notificationPage struct {
+	Notifications []notification `json:"notifications"`
+	NextBefore    int            `json:"nextBefore,omitempty"`
+	Unread        int            `json:"unread"`
+}
+
+// The notifications shown to their recipient: the ones whose actor still
+// has an account
+const visibleNotifications = `notifications n JOIN users actor ON actor.username = n.actor AND actor.deleted_at IS NULL
+	WHERE n.recipient = :recipient`
+
+// Record a notification, unless the actor is the recipient, the recipient
+// muted its kind or was already told the same thing
+func notifyTx(tx *sql.Tx, n notification) error {
+	if n.Recipient == "" || n.Recipient == n.Actor {
+		return nil
+	}
+	_, err := tx.Exec(`INSERT INTO notifications (recipient, kind, actor, article_id, comment_id, created_at)
+		SELECT ?1, ?2, ?3, ?4, ?5, CURRENT_TIMESTAMP
+		WHERE NOT EXISTS (SELECT 1 FROM notification_mutes WHERE username = ?1 AND kind = ?2)
+		AND NOT EXISTS (SELECT 1 FROM notifications WHERE recipient = ?1 AND kind = ?2 AND actor = ?3 AND article_id IS ?4 AND comment_id IS ?5)`,
+		n.Recipient, n.Kind, n.Actor, n.ArticleId, n.CommentId)
+	return err
+}
+
+// Return the notifications of a user older than the notification before,
+// or the newest ones when before is 0
+func getNotifications(username string, unreadOnly bool, before int, limit int) (notificationPage, error) {
+	query := "SELECT n.notification_id, n.kind, n.actor, n.article_id, n.comment_id, n.created_at, n.read_at IS NOT NULL FROM " + visibleNotifications
+	if unreadOnly {
+		query += " AND n.read_at IS NULL"
+	}
+	if before > 0 {
+		query += " AND n.notification_id < :before"
+	}
+	query += " ORDER BY n.notification_id DESC LIMIT :limit"
+
+	rows, err := DB.Query(query, sql.Named("recipient", username), sql.Named("before", before), sql.Named("limit", limit+1))
+	if err != nil {
+		return notificationPage{}, err
+	}
+	defer rows.Close()
+
+	list := make([]notification, 0, limit+1)
+	for rows.Next() {
+		n := notification{Recipient: username}
+		if err := rows.Scan(&n.ID, &n.Kind, &n.Actor, &n.ArticleId, &n.CommentId, &n.CreatedAt, &n.Read); err != nil {
+			return notificationPage{}, err
+		}
+		list = append(list, n)
+	}
+	if err := rows.Err(); err != nil {
+		return notificationPage{}, err
+	}
+
+	page := notificationPage{Notifications: list}
+	if len(list) > limit {
+		page.Notifications = list[:limit]
+		page.NextBefore = list[limit-1].ID
+	}
+	page.Unread, err = countUnreadNotifications(username)
+	return page, err
+}
+
+// Count the notifications of a user that aren't read
+func countUnreadNotifications(username string) (int, error) {
+	var count int
+	err := DB.QueryRow("SELECT COUNT(*) FROM "+visibleNotifications+" AND n.read_at IS NULL", sql.Named("recipient", username)).Scan(&count)
+	return count, err
+}
+
+// Mark notifications of a user as read, every one of them when ids is nil.
+// The IDs of notifications of other users are ignored. Returns how many
+// notifications were marked
+func markNotificationsRead(username string, ids []int) (int64, error) {
+	query := "UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE recipient = ? AND read_at IS NULL"
+	args := []interface{}{username}
+	if ids != nil {
+		if len(ids) == 0 {
+			return 0, nil
+		}
+		query += " AND notification_id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	result, err := DB.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Return whether each kind of notification is recorded for a user
+func getNotificationPreferences(username string) (map[string]bool, error) {
+	rows, err := DB.Query("SELECT kind FROM notification_mutes WHERE username = ?", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs := map[string]bool{}
+	for _, kind := range notificationKinds {
+		prefs[kind] = true
+	}
+	for rows.Next() {
+		var kind string
+		if err := rows.Scan(&kind); err != nil {
+			return nil, err
+		}
+		prefs[kind] = false
+	}
+	return prefs, rows.Err()
+}
+
+// Mute (false) or unmute (true) kinds of notifications for a user, leaving
+// the other kinds unchanged. Returns errInvalidNotificationKind for a kind
+// that doesn't exist
+func setNotificationPreferences(username string, changes map[string]bool) error {
+	for kind := range changes {
+		if !isNotificationKind(kind) {
+			return errInvalidNotificationKind
+		}
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for kind, enabled := range changes {
+		query := "INSERT OR IGNORE INTO notification_mutes (username, kind) VALUES (?, ?)"
+		if enabled {
+			query = "DELETE FROM notification_mutes WHERE username = ? AND kind = ?"
+		}
+		if _, err := tx.Exec(query, username, kind); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func isNotificationKind(kind string) bool {
+	for _, k := range notificationKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+// models.notification_test.go
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// The kinds and actors of the notifications of a user, the newest first
+func describeNotifications(t *testing.T, username string) string {
+	t.Helper()
+	page, err := getNotifications(username, false, 0, maxNotificationLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, n := range page.Notifications {
+		out = append(out, n.Kind+":"+n.Actor)
+	}
+	return fmt.Sprint(out)
+}
+
+// Test that comments, replies, likes and new followers notify the right
+// users once, unless they muted the kind
+func TestNotifications(t *testing.T) {
+	defer DB.Exec("DELETE FROM notifications WHERE recipient IN ('user_mj', 'user3')")
+	defer DB.Exec("DELETE FROM notification_mutes WHERE username = 'user_mj'")
+
+	if _, err := createNewArticle(article{Title: "Notify test", Content: "Notify test"}, "user_mj"); err != nil {
+		t.Fatal(err)
+	}
+	defer deleteArticleByTitle("Notify test")
+	var articleId int
+	DB.QueryRow("SELECT id FROM articles WHERE title = 'Notify test'").Scan(&articleId)
+
+	// No notification for their own comment
+	own := addTestComment(t, articleId, "user_mj", "mine", nil)
+	top := addTestComment(t, articleId, "user3", "top", nil)
+	addTestComment(t, articleId, "user2", "reply", &top)
+	addTestComment(t, articleId, "user_mj", "author reply", &top)
+	addTestComment(t, articleId, "user3", "reply to the author", &own)
+
+	if got := describeNotifications(t, "user_mj"); got != "[reply:user3 comment:user2 comment:user3]" {
+		t.Errorf("author: got %s", got)
+	}
+	if got := describeNotifications(t, "user3"); got != "[reply:user_mj reply:user2]" {
+		t.Errorf("commenter: got %s", got)
+	}
+
+	// Liking again doesn't notify twice
+	for _, status := range []int{reactionLike, reactionNone, reactionLike} {
+		if _, _, err := changeArticleStatus("user2", articleId, status); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changeArticleStatus("user3", articleId, reactionDislike)
+	if got := describeNotifications(t, "user_mj"); got != "[like:user2 reply:user3 comment:user2 comment:user3]" {
+		t.Errorf("after likes: got %s", got)
+	}
+
+	if err := setNotificationPreferences("user_mj", map[string]bool{notifyFollow: false}); err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Exec("DELETE FROM subscribe WHERE star = 'user_mj'")
+	if err := performSubscribe("user_mj", "user3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setNotificationPreferences("user_mj", map[string]bool{notifyFollow: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := performSubscribe("user_mj", "user2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := describeNotifications(t, "user_mj"); got != "[follow:user2 like:user2 reply:user3 comment:user2 comment:user3]" {
+		t.Errorf("after follows: got %s", got)
+	}
+	if err := setNotificationPreferences("user_mj", map[string]bool{"poke": false}); err != errInvalidNotificationKind {
+		t.Errorf("muted an unknown kind: %v", err)
+	}
+
+	// Marking read
+	page, _ := getNotifications("user_mj", false, 0, 2)
+	if page.Unread != 5 || len(page.Notifications) != 2 || page.NextBefore != page.Notifications[1].ID {
+		t.Fatalf("got %+v", page)
+	}
+	if n, err := markNotificationsRead("user3", []int{page.Notifications[0].ID}); n != 0 || err != nil {
+		t.Errorf("marked the notification of another user: %d, %v", n, err)
+	}
+	if n, err := markNotificationsRead("user_mj", []int{page.Notifications[0].ID}); n != 1 || err != nil {
+		t.Errorf("got %d, %v", n, err)
+	}
+	page, _ = getNotifications("user_mj", true, page.Notifications[1].ID, maxNotificationLimit)
+	if page.Unread != 4 || len(page.Notifications) != 3 || page.NextBefore != 0 {
+		t.Errorf("got %+v", page)
+	}
+	if n, err := markNotificationsRead("user_mj", nil); n != 4 || err != nil {
+		t.Errorf("got %d, %v", n, err)
+	}
+	if count, _ := countUnreadNotifications("user_mj"); count != 0 {
+		t.Errorf("%d notifications left unread", count)
+	}
+}
@@ -0,0 +1,115 @@
+// models.password_reset.go
+
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// How long an emailed reset token can be used
+const passwordResetLifetime = time.Hour
+
+var (
+	errInvalidResetToken = errors.New("The reset token is invalid, expired or was already used")
+	// Returned when there is no active account to reset, which must not be
+	// revealed to the requester
+	errNothingToReset = errors.New("no active account with this username")
+)
+
+// Only the hash of a reset token is stored, so that a leaked database can't
+// be used to reset passwords
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Issue a reset token for an active user, replacing the unused ones.
+// Returns the token and the GatorLink address to send it to
+func createPasswordReset(username string) (string, string, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback()
+
+	var gatorId string
+	sqlErr := tx.QueryRow("SELECT gatorId FROM users WHERE username = ? AND status = 'active' AND deleted_at IS NULL", username).Scan(&gatorId)
+	if sqlErr == sql.ErrNoRows {
+		return "", "", errNothingToReset
+	}
+	if sqlErr != nil {
+		return "", "", sqlErr
+	}
+
+	// The token is as strong as a session ID
+	token, err := generateSessionToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec("DELETE FROM password_resets WHERE username = ? AND used_at IS NULL", username); err != nil {
+		return "", "", err
+	}
+	if _, err := tx.Exec("INSERT INTO password_resets (token_hash, username, created_at, expires_at) VALUES (?, ?, ?, ?)",
+		hashResetToken(token), username, now, now.Add(passwordResetLifetime)); err != nil {
+		return "", "", err
+	}
+
+	return token, gatorId, tx.Commit()
+}
+
+// Email the reset token to the GatorLink address
+func sendPasswordResetEmail(username string, gatorId string, token string) error {
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"Someone asked to reset the password of your UFMingle account. Enter this reset token with your new password within %d minutes:\n\n"+
+		"%s\n\n"+
+		"If you did not ask for it, you can ignore this email and your password stays the same.\n",
+		username, int(passwordResetLifetime.Minutes()), token)
+	return appMailer.Send(gatorId, "Reset your UFMingle password", body)
+}
+
+// Set a new password with a reset token. The token, and any other unused
+// token of the user, can't be used again and every session of the user is
+// revoked
+func resetPasswordWithToken(token string, newPassword string) error {
+	passwordHash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var username string
+	sqlErr := tx.QueryRow(`SELECT password_resets.username FROM password_resets
+		JOIN users ON users.username = password_resets.username
+		WHERE password_resets.token_hash = ? AND password_resets.used_at IS NULL
+		AND password_resets.expires_at > ? AND users.status = 'active' AND users.deleted_at IS NULL`, hashResetToken(token), now).Scan(&username)
+	if sqlErr == sql.ErrNoRows {
+		return errInvalidResetToken
+	}
+	if sqlErr != nil {
+		return sqlErr
+	}
+
+	if _, err := tx.Exec("UPDATE users SET password = ? WHERE username = ?", passwordHash, username); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE password_resets SET used_at = ? WHERE username = ? AND used_at IS NULL", now, username); err != nil {
+		return err
+	}
+	if err := revokeUserSessions(tx, username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,81 @@
+// models.password_reset_test.go
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that a reset token changes the password once and logs out every
+// session
+func TestResetPasswordWithToken(t *testing.T) {
+	u := user{Gatorlink: "resetuser@ufl.edu", Username: "resetUser", Password: "oldPass", Gender: "unknown"}
+	registerActiveUser(t, u)
+	defer deleteUser(u.Username)
+
+	s, err := createSession(u.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, gatorId, err := createPasswordReset(u.Username)
+	if err != nil || gatorId != "resetuser@ufl.edu" {
+		t.Fatal(gatorId, err)
+	}
+	// A new token replaces the unused one
+	token, _, err := createPasswordReset(u.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resetPasswordWithToken(first, "newPass"); err != errInvalidResetToken {
+		t.Errorf("a replaced token was accepted: %v", err)
+	}
+
+	if err := resetPasswordWithToken(token, " "); err != errEmptyPassword {
+		t.Errorf("an empty password was accepted: %v", err)
+	}
+	if err := resetPasswordWithToken(token, "newPass"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := getActiveSession(s.ID); err != errInvalidSession {
+		t.Error("the session survived the reset")
+	}
+	if valid, _ := isUserValid(mingleUser{Username: u.Username, Password: "newPass"}); !valid {
+		t.Error("the new password doesn't work")
+	}
+
+	// The token can only be used once
+	if err := resetPasswordWithToken(token, "otherPass"); err != errInvalidResetToken {
+		t.Errorf("a used token was accepted: %v", err)
+	}
+
+	// An expired token is refused
+	token, _, err = createPasswordReset(u.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB.Exec("UPDATE password_resets SET expires_at = ? WHERE token_hash = ?", time.Now().UTC().Add(-time.Minute), hashResetToken(token)); err != nil {
+		t.Fatal(err)
+	}
+	if err := resetPasswordWithToken(token, "otherPass"); err != errInvalidResetToken {
+		t.Errorf("an expired token was accepted: %v", err)
+	}
+}
+
+// Test that only active accounts can be reset
+func TestCreatePasswordResetUnknownUser(t *testing.T) {
+	if _, _, err := createPasswordReset("nobody"); err != errNothingToReset {
+		t.Fail()
+	}
+
+	pending := user{Gatorlink: "pendingreset@ufl.edu", Username: "pendingReset", Password: "p", Gender: "unknown"}
+	if _, err := registerNewUser(pending); err != nil {
+		t.Fatal(err)
+	}
+	defer deleteUser(pending.Username)
+	if _, _, err := createPasswordReset(pending.Username); err != errNothingToReset {
+		t.Fail()
+	}
+}
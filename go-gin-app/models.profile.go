@@ -0,0 +1,321 @@
+// models.profile.go
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Who may see a field of a profile. Following needs no approval, so
+// followers only means the followers the owner follows back, and matches.
+// Matches only shows the field to nobody else. The owner always sees every
+// field
+const (
+	visibilityPublic    = "public"
+	visibilityFollowers = "followers"
+	visibilityMatches   = "matches"
+)
+
+// The fields of a profile that can be hidden. The username is always shown
+var profileFields = []string{"age", "gender", "pronouns", "bio", "major", "gradYear", "tags", "photos"}
+
+// The limits of the fields of a profile
+const (
+	maxBioLength      = 500
+	maxPronounsLength = 30
+	maxTags           = 10
+	maxTagLength      = 30
+	maxPhotos         = 6
+)
+
+var errInvalidVisibility = errors.New("Invalid profile visibility")
+
+// An image of the gallery of a profile
+type profilePhoto struct {
+	Filename string `json:"filename"`
+	URL      string `json:"url"`
+}
+
+// The profile of a user as another user sees it. The fields hidden from the
+// viewer and the ones the user left empty are omitted
+type profile struct {
+	Username string         `json:"username"`
+	Age      *int           `json:"age,omitempty"`
+	Gender   *string        `json:"gender,omitempty"`
+	Pronouns *string        `json:"pronouns,omitempty"`
+	Bio      *string        `json:"bio,omitempty"`
+	Major    *string        `json:"major,omitempty"`
+	GradYear *int           `json:"gradYear,omitempty"`
+	Tags     []string       `json:"tags,omitempty"`
+	Photos   []profilePhoto `json:"photos,omitempty"`
+}
+
+// The profile of the current user with the private fields and the
+// visibility of each field
+type ownProfile struct {
+	profile
+	Gatorlink  string            `json:"gatorId"`
+	Birthday   string            `json:"birthday"`
+	Role       string            `json:"role"`
+	Visibility map[string]string `json:"visibility"`
+}
+
+// Return whether a field of a profile can be hidden
+func isProfileField(field string) bool {
+	for _, f := range profileFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the age in whole years on a day of someone born on birthday, or
+// nil if the birthday can't be read
+func ageOn(birthday string, day time.Time) *int {
+	if len(birthday) > len("2006-01-02") {
+		birthday = birthday[:len("2006-01-02")]
+	}
+	born, err := time.Parse("2006-01-02", birthday)
+	if err != nil {
+		return nil
+	}
+	age := day.Year() - born.Year()
+	if day.Format("01-02") < born.Format("01-02") {
+		age--
+	}
+	return &age
+}
+
+// Return the full profile of an active account with its birthday, gatorId
+// and role, or sql.ErrNoRows if there is no such account
+func loadProfile(username string) (ownProfile, error) {
+	p := ownProfile{profile: profile{Username: username}}
+	var birthday sql.NullString
+	var gender string
+	err := DB.QueryRow(`SELECT gatorId, date(birthday), gender, role, pronouns, bio, major, grad_year FROM users
+		WHERE username = ? AND status = 'active' AND deleted_at IS NULL`, username).
+		Scan(&p.Gatorlink, &birthday, &gender, &p.Role, &p.Pronouns, &p.Bio, &p.Major, &p.GradYear)
+	if err != nil {
+		return ownProfile{}, err
+	}
+	p.Birthday = birthday.String
+	p.Age = ageOn(birthday.String, time.Now().UTC())
+	p.Gender = &gender
+
+	if p.Tags, err = getProfileTags(username); err != nil {
+		return ownProfile{}, err
+	}
+	if p.Photos, err = getProfilePhotos(username); err != nil {
+		return ownProfile{}, err
+	}
+	return p, nil
+}
+
+// Return the tags of a profile in the order the user gave them
+func getProfileTags(username string) ([]string, error) {
+	rows, err := DB.Query("SELECT tag FROM profile_tags WHERE username = ? ORDER BY position", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// Return the gallery of a profile in the order the user gave it
+func getProfilePhotos(username string) ([]profilePhoto, error) {
+	rows, err := DB.Query("SELECT filename FROM profile_photos WHERE username = ? ORDER BY position", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var photos []profilePhoto
+	for rows.Next() {
+		var photo profilePhoto
+		if err := rows.Scan(&photo.Filename); err != nil {
+			return nil, err
+		}
+		photo.URL = imageURL(photo.Filename)
+		photos = append(photos, photo)
+	}
+	return photos, rows.Err()
+}
+
+// Return the profile of the current user
+func getOwnProfile(username string) (ownProfile, error) {
+	p, err := loadProfile(username)
+	if err != nil {
+		return ownProfile{}, err
+	}
+	p.Visibility, err = getProfileVisibility(username)
+	return p, err
+}
+
+// Return the profile of a user as the viewer may see it. Returns
+// sql.ErrNoRows if the account doesn't exist or either user blocked the
+// other
+func getPublicProfile(viewer string, username string) (profile, error) {
+	full, err := loadProfile(username)
+	if err != nil {
+		return profile{}, err
+	}
+	if viewer == username {
+		return full.profile, nil
+	}
+
+	audience, err := getProfileAudience(viewer, username)
+	if err != nil {
+		return profile{}, err
+	}
+	if audience.blocked {
+		return profile{}, sql.ErrNoRows
+	}
+
+	visibility, err := getProfileVisibility(username)
+	if err != nil {
+		return profile{}, err
+	}
+	hidden := func(field string) bool {
+		return !audience.canSee(visibility[field])
+	}
+
+	p := full.profile
+	if hidden("age") {
+		p.Age = nil
+	}
+	if hidden("gender") {
+		p.Gender = nil
+	}
+	if hidden("pronouns") {
+		p.Pronouns = nil
+	}
+	if hidden("bio") {
+		p.Bio = nil
+	}
+	if hidden("major") {
+		p.Major = nil
+	}
+	if hidden("gradYear") {
+		p.GradYear = nil
+	}
+	if hidden("tags") {
+		p.Tags = nil
+	}
+	if hidden("photos") {
+		p.Photos = nil
+	}
+	return p, nil
+}
+
+// How a viewer is related to the owner of a profile
+type profileAudience struct {
+	blocked bool
+	// The viewer follows the owner, who follows them back
+	mutualFollower bool
+	matched        bool
+}
+
+// Return how the viewer is related to the owner of a profile
+func getProfileAudience(viewer string, owner string) (profileAudience, error) {
+	if viewer == owner {
+		return profileAudience{mutualFollower: true, matched: true}, nil
+	}
+	var a profileAudience
+	first, second := orderedPair(viewer, owner)
+	err := DB.QueryRow(`SELECT
+			EXISTS (SELECT 1 FROM blocks WHERE blocker = ?1 AND blocked = ?2 OR blocker = ?2 AND blocked = ?1),
+			EXISTS (SELECT 1 FROM subscribe WHERE star = ?2 AND follower = ?1)
+				AND EXISTS (SELECT 1 FROM subscribe WHERE star = ?1 AND follower = ?2),
+			EXISTS (SELECT 1 FROM matches WHERE user_a = ?3 AND user_b = ?4)`, viewer, owner, first, second).
+		Scan(&a.blocked, &a.mutualFollower, &a.matched)
+	return a, err
+}
+
+// Return whether the viewer may see a field with this visibility
+func (a profileAudience) canSee(visibility string) bool {
+	switch visibility {
+	case visibilityFollowers:
+		return a.mutualFollower || a.matched
+	case visibilityMatches:
+		return a.matched
+	}
+	return true
+}
+
+// Return who may see each field of a profile
+func getProfileVisibility(username string) (map[string]string, error) {
+	rows, err := DB.Query("SELECT field, visibility FROM profile_visibility WHERE username = ?", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	visibility := map[string]string{}
+	for _, field := range profileFields {
+		visibility[field] = visibilityPublic
+	}
+	for rows.Next() {
+		var field, v string
+		if err := rows.Scan(&field, &v); err != nil {
+			return nil, err
+		}
+		visibility[field] = v
+	}
+	return visibility, rows.Err()
+}
+
+// Change who may see some fields of a profile, leaving the other fields
+// unchanged. Returns errInvalidVisibility for an unknown field or
+// visibility
+func setProfileVisibility(username string, changes map[string]string) error {
+	for field, v := range changes {
+		if !isProfileField(field) || v != visibilityPublic && v != visibilityFollowers && v != visibilityMatches {
+			return errInvalidVisibility
+		}
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for field, v := range changes {
+		var err error
+		if v == visibilityPublic {
+			_, err = tx.Exec("DELETE FROM profile_visibility WHERE username = ? AND field = ?", username, field)
+		} else {
+			_, err = tx.Exec(`INSERT INTO profile_visibility (username, field, visibility) VALUES (?, ?, ?)
+				ON CONFLICT (username, field) DO UPDATE SET visibility = excluded.visibility`, username, field, v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Replace the tags or the gallery of a profile within a profile update
+func replaceProfileListTx(tx *sql.Tx, table string, column string, username string, values []string) error {
+	if _, err := tx.Exec("DELETE FROM "+table+" WHERE username = ?", username); err != nil {
+		return err
+	}
+	for i, value := range values {
+		if _, err := tx.Exec("INSERT INTO "+table+" (username, "+column+", position) VALUES (?, ?, ?)", username, value, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
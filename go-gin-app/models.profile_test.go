@@ -0,0 +1,115 @@
+// models.profile_test.go
+
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// Test the age computed from a birthday
+func TestAgeOn(t *testing.T) {
+	day := time.Date(2026, 6, 15, 0, 0, 0, 0, time.UTC)
+	for birthday, want := range map[string]int{
+		"2000-06-15":           26,
+		"2000-06-16":           25,
+		"2000-01-01T00:00:00Z": 26,
+	} {
+		if age := ageOn(birthday, day); age == nil || *age != want {
+			t.Errorf("%s: got %v, want %d", birthday, age, want)
+		}
+	}
+	if age := ageOn("someday", day); age != nil {
+		t.Errorf("got %d for an invalid birthday", *age)
+	}
+}
+
+// Test that each field of a profile is shown to the viewers its owner
+// chose, and never to blocked users
+func TestProfileVisibility(t *testing.T) {
+	owner := user{Gatorlink: "profOwner@ufl.edu", Username: "profOwner", Password: "p", Gender: "female", Birthday: "2001-02-03"}
+	registerActiveUser(t, owner)
+	defer deleteUser(owner.Username)
+	defer deleteTestMatch(owner.Username, "user3")
+	defer DB.Exec("DELETE FROM blocks WHERE blocker = ?", owner.Username)
+
+	bio, pronouns := "Hello", "she/her"
+	tags, photos := []string{"hiking", "chess"}, []string{"profOwner.jpg"}
+	setImageOwner("profOwner.jpg", owner.Username)
+	if err := updateUserProfile(owner.Username, profileUpdate{Bio: &bio, Pronouns: &pronouns, Tags: &tags, Photos: &photos}); err != nil {
+		t.Fatal(err)
+	}
+	if err := setProfileVisibility(owner.Username, map[string]string{"bio": visibilityFollowers, "tags": visibilityMatches, "age": visibilityMatches}); err != nil {
+		t.Fatal(err)
+	}
+	if err := setProfileVisibility(owner.Username, map[string]string{"bio": "friends"}); err != errInvalidVisibility {
+		t.Errorf("got %v for an invalid visibility", err)
+	}
+
+	mine, err := getOwnProfile(owner.Username)
+	if err != nil || mine.Bio == nil || len(mine.Tags) != 2 || mine.Tags[0] != "hiking" || len(mine.Photos) != 1 || mine.Birthday != "2001-02-03" ||
+		mine.Visibility["bio"] != visibilityFollowers || mine.Visibility["gender"] != visibilityPublic {
+		t.Fatalf("got %+v, %v", mine, err)
+	}
+
+	stranger, err := getPublicProfile("user2", owner.Username)
+	if err != nil || stranger.Pronouns == nil || stranger.Gender == nil || stranger.Bio != nil || stranger.Tags != nil || stranger.Age != nil || len(stranger.Photos) != 1 {
+		t.Errorf("a stranger got %+v, %v", stranger, err)
+	}
+
+	// Following is one-sided, so only a follower the owner follows back
+	// sees the fields for followers
+	performSubscribe(owner.Username, "user2")
+	defer DB.Exec("DELETE FROM subscribe WHERE star = ? OR follower = ?", owner.Username, owner.Username)
+	if follower, _ := getPublicProfile("user2", owner.Username); follower.Bio != nil {
+		t.Errorf("a follower got %+v", follower)
+	}
+	performSubscribe("user2", owner.Username)
+	if follower, _ := getPublicProfile("user2", owner.Username); follower.Bio == nil || follower.Tags != nil {
+		t.Errorf("a follower followed back got %+v", follower)
+	}
+
+	setInterest(owner.Username, "user3", true)
+	setInterest("user3", owner.Username, true)
+	if matched, _ := getPublicProfile("user3", owner.Username); matched.Bio == nil || len(matched.Tags) != 2 || matched.Age == nil {
+		t.Errorf("a match got %+v", matched)
+	}
+
+	blockUser(owner.Username, "user2")
+	if _, err := getPublicProfile("user2", owner.Username); err != sql.ErrNoRows {
+		t.Errorf("a blocked user got the profile: %v", err)
+	}
+	if err := performSubscribe(owner.Username, "user1"); err != nil {
+		t.Fatal(err)
+	}
+	DB.Exec("DELETE FROM subscribe WHERE star = ?", owner.Username)
+	blockUser("user1", owner.Username)
+	defer unblockUser("user1", owner.Username)
+	for _, pair := range [][2]string{{owner.Username, "user1"}, {"user1", owner.Username}} {
+		if err := performSubscribe(pair[0], pair[1]); err != errBlocked {
+			t.Errorf("%s could follow %s across a block: %v", pair[1], pair[0], err)
+		}
+	}
+	if _, err := getPublicProfile("user2", "nobodyAtAll"); err != sql.ErrNoRows {
+		t.Errorf("got %v for a missing user", err)
+	}
+
+	// A deleted image leaves the gallery
+	if err := deleteImageOwner("profOwner.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if photos, err := getProfilePhotos(owner.Username); err != nil || len(photos) != 0 {
+		t.Errorf("got %v, %v", photos, err)
+	}
+
+	if _, err := deleteUser(owner.Username); err != nil {
+		t.Fatal(err)
+	}
+	var left int
+	DB.QueryRow(`SELECT (SELECT COUNT(*) FROM profile_tags WHERE username = ?1)
+		+ (SELECT COUNT(*) FROM profile_visibility WHERE username = ?1)`, owner.Username).Scan(&left)
+	if left != 0 {
+		t.Errorf("%d rows of the profile are left", left)
+	}
+}
@@ -0,0 +1,123 @@
+// models.reaction.go
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// The reaction of a user to an article or a comment, in the numbering the
+// frontend already uses
+const (
+	reactionNone    = 0
+	reactionLike    = 1
+	reactionDislike = 2
+)
+
+// The kind column of the reactions table for each reaction
+var reactionKinds = map[int]string{
+	reactionLike:    "like",
+	reactionDislike: "dislike",
+}
+
+var errInvalidReaction = errors.New("invalid reaction")
+
+// Recount the likes and dislikes of one target from the reactions table
+var reactionCountQueries = map[string]string{
+	"article": `UPDATE articles SET
+		likes = (SELECT COUNT(*) FROM reactions WHERE target_type = 'article' AND target_id = articles.id AND kind = 'like'),
+		dislikes = (SELECT COUNT(*) FROM reactions WHERE target_type = 'article' AND target_id = articles.id AND kind = 'dislike')
+		WHERE id = ?`,
+	"comment": `UPDATE comment SET
+		likes = (SELECT COUNT(*) FROM reactions WHERE target_type = 'comment' AND target_id = comment.comment_id AND kind = 'like'),
+		dislikes = (SELECT COUNT(*) FROM reactions WHERE target_type = 'comment' AND target_id = comment.comment_id AND kind = 'dislike')
+		WHERE comment_id = ? AND deleted_at IS NULL`,
+}
+
+// Read the reaction of a user to a target, reactionNone if there is none
+func getReaction(username string, targetType string, targetId int) (int, error) {
+	stmt, err := DB.Prepare("SELECT kind FROM reactions WHERE username = ? AND target_type = ? AND target_id = ?")
+	if err != nil {
+		return reactionNone, err
+	}
+	defer stmt.Close()
+
+	var kind string
+	sqlErr := stmt.QueryRow(username, targetType, targetId).Scan(&kind)
+	if sqlErr == sql.ErrNoRows {
+		return reactionNone, nil
+	}
+	if sqlErr != nil {
+		return reactionNone, sqlErr
+	}
+
+	for reaction, k := range reactionKinds {
+		if k == kind {
+			return reaction, nil
+		}
+	}
+	return reactionNone, errInvalidReaction
+}
+
+// Set, replace or clear (reactionNone) the reaction of a user to a target.
+// The reaction and the recount of the target happen in one transaction, so
+// concurrent reactions can't make the counters drift.
+// Returns the new counts, or sql.ErrNoRows if the target does not exist
+func setReaction(username string, targetType string, targetId int, reaction int) (int, int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	likes, dislikes, err := setReactionTx(tx, username, targetType, targetId, reaction)
+	if err != nil {
+		return 0, 0, err
+	}
+	return likes, dislikes, tx.Commit()
+}
+
+// Like setReaction, within a transaction of the caller
+func setReactionTx(tx *sql.Tx, username string, targetType string, targetId int, reaction int) (int, int, error) {
+	countQuery, ok := reactionCountQueries[targetType]
+	if !ok {
+		return 0, 0, errInvalidReaction
+	}
+
+	var err error
+	if reaction == reactionNone {
+		_, err = tx.Exec("DELETE FROM reactions WHERE username = ? AND target_type = ? AND target_id = ?", username, targetType, targetId)
+	} else if kind, ok := reactionKinds[reaction]; ok {
+		_, err = tx.Exec(`INSERT INTO reactions (username, target_type, target_id, kind) VALUES (?, ?, ?, ?)
+			ON CONFLICT (username, target_type, target_id) DO UPDATE SET kind = excluded.kind, created_at = CURRENT_TIMESTAMP`,
+			username, targetType, targetId, kind)
+	} else {
+		return 0, 0, errInvalidReaction
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	res, err := tx.Exec(countQuery, targetId)
+	if err != nil {
+		return 0, 0, err
+	}
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+	if affect != 1 {
+		return 0, 0, sql.ErrNoRows
+	}
+
+	var likes, dislikes int
+	sqlErr := tx.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM reactions WHERE target_type = ? AND target_id = ? AND kind = 'like'),
+		(SELECT COUNT(*) FROM reactions WHERE target_type = ? AND target_id = ? AND kind = 'dislike')`,
+		targetType, targetId, targetType, targetId).Scan(&likes, &dislikes)
+	if sqlErr != nil {
+		return 0, 0, sqlErr
+	}
+	return likes, dislikes, nil
+}
@@ -0,0 +1,178 @@
+// models.reaction_test.go
+
+package main
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+)
+
+// Test liking, disliking and clearing the reaction to an article
+func TestSetReaction(t *testing.T) {
+	username := "user_mj"
+	articleId := 2
+
+	// Start without a reaction
+	if _, _, err := changeArticleStatus(username, articleId, reactionNone); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := getArticleByID(articleId)
+
+	likes, dislikes, err := changeArticleStatus(username, articleId, reactionLike)
+	if err != nil || likes != original.Likes+1 || dislikes != original.Dislikes {
+		t.Fail()
+	}
+	if status, err := checkArticleStatus(username, articleId); status != reactionLike || err != nil {
+		t.Fail()
+	}
+
+	// Switching to a dislike moves the count instead of adding one
+	likes, dislikes, err = changeArticleStatus(username, articleId, reactionDislike)
+	if err != nil || likes != original.Likes || dislikes != original.Dislikes+1 {
+		t.Fail()
+	}
+	if status, err := checkArticleStatus(username, articleId); status != reactionDislike || err != nil {
+		t.Fail()
+	}
+
+	// Un-react
+	likes, dislikes, err = changeArticleStatus(username, articleId, reactionNone)
+	if err != nil || likes != original.Likes || dislikes != original.Dislikes {
+		t.Fail()
+	}
+	if status, err := checkArticleStatus(username, articleId); status != reactionNone || err != nil {
+		t.Fail()
+	}
+
+	// The counters of the article match the returned counts
+	updated, _ := getArticleByID(articleId)
+	if updated.Likes != likes || updated.Dislikes != dislikes {
+		t.Fail()
+	}
+}
+
+// Test that reacting to a missing article changes nothing
+func TestSetReactionMissingArticle(t *testing.T) {
+	if _, _, err := changeArticleStatus("user_mj", 100000, reactionLike); err != sql.ErrNoRows {
+		t.Fail()
+	}
+	if status, _ := checkArticleStatus("user_mj", 100000); status != reactionNone {
+		t.Fail()
+	}
+	if _, _, err := changeArticleStatus("user_mj", 2, 7); err != errInvalidReaction {
+		t.Fail()
+	}
+}
+
+// Test that concurrent reactions to the same article keep the counters
+// in line with the reactions table
+func TestConcurrentReactions(t *testing.T) {
+	users := []string{"user1", "user2", "user3", "user_rl", "user_mj"}
+	articleId := 3
+
+	react := func(status int) {
+		var wg sync.WaitGroup
+		for _, u := range users {
+			wg.Add(1)
+			go func(u string) {
+				defer wg.Done()
+				if _, _, err := changeArticleStatus(u, articleId, status); err != nil {
+					t.Error(err)
+				}
+			}(u)
+		}
+		wg.Wait()
+	}
+
+	react(reactionNone)
+	original, _ := getArticleByID(articleId)
+
+	react(reactionLike)
+	liked, _ := getArticleByID(articleId)
+	if liked.Likes != original.Likes+len(users) || liked.Dislikes != original.Dislikes {
+		t.Fail()
+	}
+
+	react(reactionNone)
+	cleared, _ := getArticleByID(articleId)
+	if cleared.Likes != original.Likes || cleared.Dislikes != original.Dislikes {
+		t.Fail()
+	}
+}
+
+// Test the conversion of the old like_list/dislike_list columns
+func TestMigrateReactionLists(t *testing.T) {
+	if _, err := DB.Exec("UPDATE users SET like_list = ?, dislike_list = ? WHERE username = ?", "1,2,100000", "3", "user3"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Run the conversion of the reactions migration again
+	if _, err := DB.Exec(getMigration(t, 3).SQL); err != nil {
+		t.Fatal(err)
+	}
+
+	for articleId, want := range map[int]int{1: reactionLike, 2: reactionLike, 3: reactionDislike, 100000: reactionNone} {
+		if status, err := checkArticleStatus("user3", articleId); status != want || err != nil {
+			t.Error(articleId, status, err)
+		}
+	}
+
+	var likeList, dislikeList string
+	DB.QueryRow("SELECT like_list, dislike_list FROM users WHERE username = ?", "user3").Scan(&likeList, &dislikeList)
+	if likeList != "" || dislikeList != "" {
+		t.Fail()
+	}
+
+	// The counters were recounted from the reactions
+	var likes int
+	DB.QueryRow("SELECT COUNT(*) FROM reactions WHERE target_type = 'article' AND target_id = 1 AND kind = 'like'").Scan(&likes)
+	if a, _ := getArticleByID(1); a.Likes != likes {
+		t.Fail()
+	}
+
+	for _, articleId := range []int{1, 2, 3} {
+		changeArticleStatus("user3", articleId, reactionNone)
+	}
+}
+
+// Test that each user has one reaction per comment, that deleted comments
+// can't be reacted to, and that the reactions go away with the comment
+func TestSetCommentReaction(t *testing.T) {
+	commentId := addTestComment(t, 2, "user3", "React to me", nil)
+	defer deleteCommentByCommentId(commentId)
+
+	for _, username := range []string{"user1", "user2"} {
+		setReaction(username, "comment", commentId, reactionLike)
+	}
+	likes, dislikes, err := setReaction("user2", "comment", commentId, reactionDislike)
+	if err != nil || likes != 1 || dislikes != 1 {
+		t.Errorf("got %d likes, %d dislikes, %v", likes, dislikes, err)
+	}
+	if c, _ := getCommentByID(commentId); c.Likes != 1 || c.Dislikes != 1 {
+		t.Errorf("the comment counts %d likes, %d dislikes", c.Likes, c.Dislikes)
+	}
+
+	page, err := getCommentThread(2, threadOptions{Viewer: "user2", MaxDepth: 1, Limit: maxThreadLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range page.Comments {
+		if node.CommentId == commentId && node.MyReaction != reactionDislike {
+			t.Errorf("got my reaction %d", node.MyReaction)
+		}
+	}
+
+	softDeleteComment(commentId, "user3")
+	if _, _, err := setReaction("user1", "comment", commentId, reactionNone); err != sql.ErrNoRows {
+		t.Errorf("reacted to a deleted comment: %v", err)
+	}
+	restoreComment(commentId)
+
+	deleteCommentByCommentId(commentId)
+	var left int
+	DB.QueryRow("SELECT COUNT(*) FROM reactions WHERE target_type = 'comment' AND target_id = ?", commentId).Scan(&left)
+	if left != 0 {
+		t.Errorf("%d reactions of the deleted comment are left", left)
+	}
+}
@@ -0,0 +1,169 @@
+// models.search.go
+
+package main
+
+import (
+	"database/sql"
+	"html"
+	"strings"
+	"time"
+)
+
+// The page sizes of search results
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+)
+
+// What a search looks for. The dates are inclusive, in the form 2006-01-02
+type searchQuery struct {
+	Text   string
+	Author string
+	From   string
+	To     string
+	// "article", "comment" or "" for both
+	Kind   string
+	Limit  int
+	Offset int
+}
+
+// An article or a comment matching a search. In the title and the snippet,
+// the text is HTML-escaped and the matched terms are wrapped in <mark>
+type searchResult struct {
+	Kind      string  `json:"type"`
+	ID        int     `json:"id"`
+	ArticleID int     `json:"articleId"`
+	Author    string  `json:"author"`
+	Title     string  `json:"title"`
+	Snippet   string  `json:"snippet"`
+	PostTime  string  `json:"postTime"`
+	Score     float64 `json:"score"`
+}
+
+// A page of search results, nextOffset is 0 on the last page
+type searchPage struct {
+	Results    []searchResult `json:"results"`
+	NextOffset int            `json:"nextOffset,omitempty"`
+}
+
+// Turn the text typed by a user into an FTS5 query: the text in double
+// quotes is a phrase and every other word a term, all of them required.
+// Every part is quoted so that no FTS5 operator can be injected. Returns ""
+// when there is nothing to search
+func buildMatchQuery(text string) string {
+	var parts []string
+	addPart := func(s string) {
+		if s = strings.TrimSpace(s); s != "" {
+			parts = append(parts, `"`+strings.ReplaceAll(s, `"`, `""`)+`"`)
+		}
+	}
+
+	for i, segment := range strings.Split(text, `"`) {
+		// The odd segments are between quotes
+		if i%2 == 1 {
+			addPart(segment)
+			continue
+		}
+		for _, word := range strings.Fields(segment) {
+			addPart(word)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Markers around the matched terms, replaced by <mark> once the rest of the
+// text is escaped
+const (
+	matchStart = "\x02"
+	matchEnd   = "\x03"
+)
+
+func markMatches(s string) string {
+	s = html.EscapeString(s)
+	return strings.NewReplacer(matchStart, "<mark>", matchEnd, "</mark>").Replace(s)
+}
+
+// Search the articles and comments that aren't deleted, the best matches
+// first. Titles weigh more than bodies
+func searchContent(q searchQuery) (searchPage, error) {
+	if !searchEnabled {
+		return searchPage{}, errSearchUnavailable
+	}
+
+	query := `SELECT s.kind, s.rowid, s.article_id, s.author, s.posted_at,
+			highlight(search_index, 0, :start, :end), snippet(search_index, 1, :start, :end, '…', 16),
+			COALESCE(a.title, ''), bm25(search_index, 10.0, 1.0)
+		FROM search_index s LEFT JOIN articles a ON a.id = s.article_id
+		WHERE search_index MATCH :match`
+	if q.Author != "" {
+		query += " AND s.author = :author"
+	}
+	if q.Kind != "" {
+		query += " AND s.kind = :kind"
+	}
+	if q.From != "" {
+		query += " AND s.posted_at >= :from"
+	}
+	if q.To != "" {
+		query += " AND s.posted_at < date(:to, '+1 day')"
+	}
+	query += " ORDER BY bm25(search_index, 10.0, 1.0), s.rowid DESC LIMIT :limit OFFSET :offset"
+
+	rows, err := DB.Query(query,
+		sql.Named("start", matchStart), sql.Named("end", matchEnd),
+		sql.Named("match", buildMatchQuery(q.Text)),
+		sql.Named("author", q.Author), sql.Named("kind", q.Kind),
+		sql.Named("from", q.From), sql.Named("to", q.To),
+		sql.Named("limit", q.Limit+1), sql.Named("offset", q.Offset))
+	if err != nil {
+		return searchPage{}, err
+	}
+	defer rows.Close()
+
+	results := make([]searchResult, 0, q.Limit+1)
+	for rows.Next() {
+		var r searchResult
+		var rowid int
+		var postedAt interface{}
+		var title, snippet, articleTitle string
+		var rank float64
+		if err := rows.Scan(&r.Kind, &rowid, &r.ArticleID, &r.Author, &postedAt, &title, &snippet, &articleTitle, &rank); err != nil {
+			return searchPage{}, err
+		}
+
+		r.ID = rowid / 2
+		r.Snippet = markMatches(snippet)
+		r.PostTime = formatPostedAt(postedAt)
+		// bm25 is lower for better matches
+		r.Score = -rank
+		if r.Kind == "article" {
+			r.Title = markMatches(title)
+		} else {
+			r.Title = html.EscapeString(articleTitle)
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return searchPage{}, err
+	}
+
+	page := searchPage{Results: results}
+	if len(results) > q.Limit {
+		page.Results = results[:q.Limit]
+		page.NextOffset = q.Offset + q.Limit
+	}
+	return page, nil
+}
+
+// The post time of an indexed row, which keeps the type it was inserted with
+func formatPostedAt(v interface{}) string {
+	switch t := v.(type) {
+	case time.Time:
+		return t.Format(time.RFC3339)
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	}
+	return ""
+}
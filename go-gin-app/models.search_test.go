@@ -0,0 +1,106 @@
+// models.search_test.go
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test that typed text becomes a quoted FTS5 query
+func TestBuildMatchQuery(t *testing.T) {
+	for text, want := range map[string]string{
+		"":                     "",
+		`  "" `:                "",
+		"cats dogs":            `"cats" "dogs"`,
+		`"two cats" and a dog`: `"two cats" "and" "a" "dog"`,
+		`NEAR(a b) OR c*`:      `"NEAR(a" "b)" "OR" "c*"`,
+		`an "open quote`:       `"an" "open quote"`,
+	} {
+		if got := buildMatchQuery(text); got != want {
+			t.Errorf("buildMatchQuery(%q) = %s, want %s", text, got, want)
+		}
+	}
+}
+
+// Test that the index follows the articles and comments, and that the
+// filters and the ranking apply
+func TestSearchContent(t *testing.T) {
+	if !searchEnabled {
+		t.Skip("FTS5 is not compiled in, run with -tags sqlite_fts5")
+	}
+
+	createNewArticle(article{Title: "Zebra crossing", Content: "Where do <b>zebras</b> cross?"}, "user_mj")
+	createNewArticle(article{Title: "Savanna", Content: "A striped zebra was seen near the lake"}, "user_rl")
+	defer deleteArticleByTitle("Zebra crossing")
+	defer deleteArticleByTitle("Savanna")
+	var crossing int
+	DB.QueryRow("SELECT id FROM articles WHERE title = 'Zebra crossing'").Scan(&crossing)
+	createNewComment(comment{ArticleId: crossing, CommentAuthor: "user2", Content: "Only at the zebra crossing"})
+
+	search := func(q searchQuery) []searchResult {
+		t.Helper()
+		if q.Limit == 0 {
+			q.Limit = maxSearchLimit
+		}
+		page, err := searchContent(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return page.Results
+	}
+
+	results := search(searchQuery{Text: "zebra"})
+	if len(results) != 3 {
+		t.Fatalf("got %+v", results)
+	}
+	// The match in the title ranks first, and the text is escaped
+	if results[0].Kind != "article" || results[0].ID != crossing || results[0].Title != "<mark>Zebra</mark> crossing" ||
+		!strings.Contains(results[0].Snippet, "&lt;b&gt;<mark>zebras</mark>&lt;/b&gt;") {
+		t.Errorf("got %+v first", results[0])
+	}
+
+	if results := search(searchQuery{Text: `"zebra crossing"`}); len(results) != 2 {
+		t.Errorf("the phrase matched %+v", results)
+	}
+	if results := search(searchQuery{Text: "zebra", Kind: "comment"}); len(results) != 1 || results[0].Author != "user2" || results[0].ArticleID != crossing || results[0].Title != "Zebra crossing" {
+		t.Errorf("got comments %+v", results)
+	}
+	if results := search(searchQuery{Text: "zebra", Author: "user_rl"}); len(results) != 1 || results[0].Title != "Savanna" {
+		t.Errorf("got %+v for user_rl", results)
+	}
+	if results := search(searchQuery{Text: "zebra", To: "2022-04-30"}); len(results) != 0 {
+		t.Errorf("got %+v before the articles were posted", results)
+	}
+	if results := search(searchQuery{Text: "zebra", From: "2022-04-30"}); len(results) != 3 {
+		t.Errorf("got %+v after 2022-04-30", results)
+	}
+	if page, _ := searchContent(searchQuery{Text: "zebra", Limit: 2}); len(page.Results) != 2 || page.NextOffset != 2 {
+		t.Errorf("got page %+v", page)
+	}
+
+	// Edits and deletions are followed
+	title := "Okapi crossing"
+	if _, err := updateArticle(crossing, articleUpdate{Title: &title}, "user_mj"); err != nil {
+		t.Fatal(err)
+	}
+	if results := search(searchQuery{Text: "okapi"}); len(results) != 1 {
+		t.Errorf("the edited title is not found: %+v", results)
+	}
+	softDeleteArticle(crossing, "user_mj")
+	if results := search(searchQuery{Text: "crossing"}); len(results) != 0 {
+		t.Errorf("the deleted article is found: %+v", results)
+	}
+	restoreArticle(crossing)
+	if results := search(searchQuery{Text: "crossing"}); len(results) != 2 {
+		t.Errorf("the restored article is not found: %+v", results)
+	}
+
+	// A rebuild finds the same
+	if _, err := rebuildSearchIndex(DB); err != nil {
+		t.Fatal(err)
+	}
+	if results := search(searchQuery{Text: "zebra"}); len(results) != 3 {
+		t.Errorf("got %+v after the rebuild", results)
+	}
+}
@@ -0,0 +1,98 @@
+// models.session.go
+
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// How long a session stays valid after login
+const sessionLifetime = 10 * time.Hour
+
+// Returned when a session ID is unknown, expired or revoked
+var errInvalidSession = errors.New("invalid session")
+
+type session struct {
+	ID        string
+	Username  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+}
+
+// Generate an opaque session ID from 32 bytes of crypto/rand
+func generateSessionToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Start a new session for the user and store it in the sessions table
+func createSession(username string) (session, error) {
+	id, err := generateSessionToken()
+	if err != nil {
+		return session{}, err
+	}
+
+	now := time.Now().UTC()
+	s := session{ID: id, Username: username, CreatedAt: now, ExpiresAt: now.Add(sessionLifetime)}
+
+	stmt, err := DB.Prepare("INSERT INTO sessions (session_id, username, created_at, expires_at) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return session{}, err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(s.ID, s.Username, s.CreatedAt, s.ExpiresAt); err != nil {
+		return session{}, err
+	}
+	return s, nil
+}
+
+// Look up a session by ID, returning errInvalidSession if it is unknown,
+// expired or revoked
+func getActiveSession(id string) (session, error) {
+	stmt, err := DB.Prepare("SELECT session_id, username, created_at, expires_at, revoked_at FROM sessions WHERE session_id = ?")
+	if err != nil {
+		return session{}, err
+	}
+	defer stmt.Close()
+
+	var s session
+	sqlErr := stmt.QueryRow(id).Scan(&s.ID, &s.Username, &s.CreatedAt, &s.ExpiresAt, &s.RevokedAt)
+	if sqlErr != nil {
+		if sqlErr == sql.ErrNoRows {
+			return session{}, errInvalidSession
+		}
+		return session{}, sqlErr
+	}
+
+	if s.RevokedAt.Valid || !time.Now().UTC().Before(s.ExpiresAt) {
+		return session{}, errInvalidSession
+	}
+	return s, nil
+}
+
+// Revoke a single session, e.g. on logout
+func revokeSession(id string) error {
+	stmt, err := DB.Prepare("UPDATE sessions SET revoked_at = ? WHERE session_id = ? AND revoked_at IS NULL")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(time.Now().UTC(), id)
+	return err
+}
+
+// Revoke every session of a user, e.g. when the password is reset
+func revokeUserSessions(tx *sql.Tx, username string) error {
+	_, err := tx.Exec("UPDATE sessions SET revoked_at = ? WHERE username = ? AND revoked_at IS NULL", time.Now().UTC(), username)
+	return err
+}
@@ -0,0 +1,45 @@
+// models.session_test.go
+
+package main
+
+import (
+	"testing"
+)
+
+// Test that a session can be looked up until it is revoked
+func TestCreateAndRevokeSession(t *testing.T) {
+	s, err := createSession("user1")
+	if err != nil || s.ID == "" || s.Username != "user1" {
+		t.Fatal(err)
+	}
+
+	active, err := getActiveSession(s.ID)
+	if err != nil || active.Username != "user1" {
+		t.Fail()
+	}
+
+	if err := revokeSession(s.ID); err != nil {
+		t.Fail()
+	}
+
+	if _, err := getActiveSession(s.ID); err != errInvalidSession {
+		t.Fail()
+	}
+
+	// An unknown ID is not a session
+	if _, err := getActiveSession("not-a-session"); err != errInvalidSession {
+		t.Fail()
+	}
+}
+
+// Test that two sessions never share an ID
+func TestGenerateSessionToken(t *testing.T) {
+	first, err := generateSessionToken()
+	if err != nil || len(first) != 64 {
+		t.Fail()
+	}
+	second, err := generateSessionToken()
+	if err != nil || first == second {
+		t.Fail()
+	}
+}
@@ -0,0 +1,183 @@
+// models.thread.go
+
+package main
+
+import (
+	"sort"
+)
+
+// The limits of a comment thread response
+const (
+	defaultThreadDepth = 5
+	maxThreadDepth     = 10
+	defaultThreadLimit = 50
+	maxThreadLimit     = 100
+)
+
+// Which part of the comments of an article to return
+type threadOptions struct {
+	// The user reading the thread, whose reactions are returned
+	Viewer string
+	// List the replies of this comment instead of the top-level comments
+	ParentId *int
+	// "time", the oldest first, or "score", the most liked first
+	Order string
+	// How many levels of replies to include, 1 for the listed comments only
+	MaxDepth int
+	// How many comments to list, and how many replies to include under
+	// each of them
+	Limit  int
+	Offset int
+}
+
+// A comment with its replies. Depth is 0 for top-level comments, and
+// ReplyCount counts every direct reply, including the ones left out of
+// Replies because of the depth or the limit. MyReaction is the reaction of
+// the viewer: 0 none, 1 like, 2 dislike. A deleted comment that still has
+// replies stays in its place with Deleted set and "[deleted]" as content
+type commentNode struct {
+	comment
+	Deleted    bool          `json:"deleted,omitempty"`
+	MyReaction int           `json:"myReaction"`
+	Depth      int           `json:"depth"`
+	ReplyCount int           `json:"replyCount"`
+	Replies    []commentNode `json:"replies"`
+}
+
+// The content shown in place of a deleted comment
+const deletedCommentPlaceholder = "[deleted]"
+
+// A page of a thread, nextOffset is 0 on the last page
+type commentThreadPage struct {
+	Comments   []commentNode `json:"comments"`
+	NextOffset int           `json:"nextOffset,omitempty"`
+}
+
+// A comment while the thread is being built
+type threadComment struct {
+	comment
+	deleted  bool
+	score    int
+	reaction int
+}
+
+// Return the comments of an article as a tree. Deleted comments are left
+// out, unless replies that aren't deleted hang under them.
+// Returns errInvalidParent if opts.ParentId isn't a comment of the article
+func getCommentThread(articleId int, opts threadOptions) (commentThreadPage, error) {
+	rows, err := DB.Query(`SELECT comment_id, topic_id, comment_user, comment_content, comment_time, likes, dislikes, parent_comment_id, edited_at, likes - dislikes,
+			CASE reactions.kind WHEN 'like' THEN ?1 WHEN 'dislike' THEN ?2 ELSE ?3 END, deleted_at IS NOT NULL
+		FROM comment LEFT JOIN reactions ON reactions.target_type = 'comment' AND reactions.target_id = comment.comment_id AND reactions.username = ?4
+		WHERE topic_id = ?5`, reactionLike, reactionDislike, reactionNone, opts.Viewer, articleId)
+	if err != nil {
+		return commentThreadPage{}, err
+	}
+	defer rows.Close()
+
+	all := map[int]*threadComment{}
+	for rows.Next() {
+		c := &threadComment{}
+		if err := rows.Scan(&c.CommentId, &c.ArticleId, &c.CommentAuthor, &c.Content, &c.CommentTime, &c.Likes, &c.Dislikes, &c.ParentId, &c.EditedAt, &c.score, &c.reaction, &c.deleted); err != nil {
+			return commentThreadPage{}, err
+		}
+		all[c.CommentId] = c
+	}
+	if err := rows.Err(); err != nil {
+		return commentThreadPage{}, err
+	}
+
+	// Keep the comments that aren't deleted and every comment above them
+	byId := map[int]*threadComment{}
+	for _, c := range all {
+		if c.deleted {
+			continue
+		}
+		for p := c; p != nil && byId[p.CommentId] == nil; {
+			byId[p.CommentId] = p
+			if p.ParentId == nil {
+				break
+			}
+			p = all[*p.ParentId]
+		}
+	}
+
+	// The replies of each comment, the top-level comments under 0
+	children := map[int][]*threadComment{}
+	for _, c := range byId {
+		if c.deleted {
+			c.comment = comment{CommentId: c.CommentId, ArticleId: c.ArticleId, Content: deletedCommentPlaceholder, CommentTime: c.CommentTime, ParentId: c.ParentId}
+			c.score, c.reaction = 0, reactionNone
+		}
+		parent := 0
+		if c.ParentId != nil {
+			parent = *c.ParentId
+		}
+		children[parent] = append(children[parent], c)
+	}
+
+	for _, list := range children {
+		sortThread(list, opts.Order)
+	}
+
+	start, depth := 0, 0
+	if opts.ParentId != nil {
+		parent, ok := byId[*opts.ParentId]
+		if !ok {
+			return commentThreadPage{}, errInvalidParent
+		}
+		start = parent.CommentId
+		// The depth of the replies, following the parents up to the top
+		for c := parent; c != nil; {
+			depth++
+			if c.ParentId == nil {
+				break
+			}
+			c = byId[*c.ParentId]
+		}
+	}
+
+	var build func(list []*threadComment, depth int, levels int) []commentNode
+	build = func(list []*threadComment, depth int, levels int) []commentNode {
+		nodes := make([]commentNode, 0, len(list))
+		for _, c := range list {
+			replies := children[c.CommentId]
+			node := commentNode{comment: c.comment, Deleted: c.deleted, MyReaction: c.reaction, Depth: depth, ReplyCount: len(replies), Replies: []commentNode{}}
+			if levels > 1 {
+				if len(replies) > opts.Limit {
+					replies = replies[:opts.Limit]
+				}
+				node.Replies = build(replies, depth+1, levels-1)
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+
+	list := children[start]
+	page := commentThreadPage{}
+	if opts.Offset < len(list) {
+		list = list[opts.Offset:]
+	} else {
+		list = nil
+	}
+	if len(list) > opts.Limit {
+		list = list[:opts.Limit]
+		page.NextOffset = opts.Offset + opts.Limit
+	}
+	page.Comments = build(list, depth, opts.MaxDepth)
+	return page, nil
+}
+
+// Order the comments of one level of a thread
+func sortThread(list []*threadComment, order string) {
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if order == "score" && a.score != b.score {
+			return a.score > b.score
+		}
+		if a.CommentTime != b.CommentTime {
+			return a.CommentTime < b.CommentTime
+		}
+		return a.CommentId < b.CommentId
+	})
+}
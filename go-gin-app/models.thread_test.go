@@ -0,0 +1,171 @@
+// models.thread_test.go
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Add a comment to an article and return its ID
+func addTestComment(t *testing.T, articleId int, author string, content string, parentId *int) int {
+	t.Helper()
+	if _, err := createNewComment(comment{ArticleId: articleId, CommentAuthor: author, Content: content, ParentId: parentId}); err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	DB.QueryRow("SELECT MAX(comment_id) FROM comment WHERE comment_user = ?", author).Scan(&id)
+	return id
+}
+
+// Flatten a thread into "content@depth" in the order of the response
+func describeThread(nodes []commentNode) []string {
+	var out []string
+	for _, n := range nodes {
+		out = append(out, fmt.Sprintf("%s@%d", n.Content, n.Depth))
+		out = append(out, describeThread(n.Replies)...)
+	}
+	return out
+}
+
+// Test that replies are nested under their parent, up to the depth and
+// limit asked for
+func TestGetCommentThread(t *testing.T) {
+	if _, err := createNewArticle(article{Title: "Thread test", Content: "Thread test"}, "user_mj"); err != nil {
+		t.Fatal(err)
+	}
+	defer deleteArticleByTitle("Thread test")
+	var articleId int
+	DB.QueryRow("SELECT id FROM articles WHERE title = 'Thread test'").Scan(&articleId)
+
+	first := addTestComment(t, articleId, "user2", "first", nil)
+	second := addTestComment(t, articleId, "user3", "second", nil)
+	reply := addTestComment(t, articleId, "user3", "reply", &first)
+	addTestComment(t, articleId, "user2", "reply to reply", &reply)
+	addTestComment(t, articleId, "user_rl", "other reply", &first)
+	DB.Exec("UPDATE comment SET likes = 5 WHERE comment_id = ?", second)
+
+	thread := func(opts threadOptions) commentThreadPage {
+		t.Helper()
+		if opts.MaxDepth == 0 {
+			opts.MaxDepth = defaultThreadDepth
+		}
+		if opts.Limit == 0 {
+			opts.Limit = defaultThreadLimit
+		}
+		page, err := getCommentThread(articleId, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return page
+	}
+
+	page := thread(threadOptions{Order: "time"})
+	if got := fmt.Sprint(describeThread(page.Comments)); got != "[first@0 reply@1 reply to reply@2 other reply@1 second@0]" {
+		t.Errorf("got %s", got)
+	}
+	if page.Comments[0].ReplyCount != 2 || page.NextOffset != 0 {
+		t.Errorf("got %+v", page.Comments[0])
+	}
+
+	if got := fmt.Sprint(describeThread(thread(threadOptions{Order: "score", MaxDepth: 1}).Comments)); got != "[second@0 first@0]" {
+		t.Errorf("by score: got %s", got)
+	}
+
+	// One reply per comment, one comment per page
+	page = thread(threadOptions{Order: "time", Limit: 1})
+	if got := fmt.Sprint(describeThread(page.Comments)); got != "[first@0 reply@1 reply to reply@2]" || page.NextOffset != 1 {
+		t.Errorf("got %s, next %d", got, page.NextOffset)
+	}
+	page = thread(threadOptions{Order: "time", Limit: 1, Offset: 1})
+	if got := fmt.Sprint(describeThread(page.Comments)); got != "[second@0]" || page.NextOffset != 0 {
+		t.Errorf("got %s, next %d", got, page.NextOffset)
+	}
+
+	// The rest of a thread, below a comment
+	page = thread(threadOptions{Order: "time", ParentId: &reply})
+	if got := fmt.Sprint(describeThread(page.Comments)); got != "[reply to reply@2]" {
+		t.Errorf("below the reply: got %s", got)
+	}
+
+	missing := second + 1000
+	for _, parentId := range []int{missing, 1} {
+		if _, err := getCommentThread(articleId, threadOptions{ParentId: &parentId, MaxDepth: 1, Limit: 1}); err != errInvalidParent {
+			t.Errorf("listed the replies of comment %d: %v", parentId, err)
+		}
+	}
+	// A reply can't move to another article
+	if _, err := createNewComment(comment{ArticleId: 1, CommentAuthor: "user2", Content: "lost", ParentId: &first}); err != errInvalidParent {
+		t.Errorf("replied across articles: %v", err)
+	}
+}
+
+// Test that purging an account keeps the replies of others to it
+func TestPurgeUserKeepsReplies(t *testing.T) {
+	u := user{Gatorlink: "replied@ufl.edu", Username: "repliedUser", Password: "p", Gender: "unknown"}
+	registerActiveUser(t, u)
+	defer deleteUser(u.Username)
+
+	top := addTestComment(t, 1, u.Username, "top", nil)
+	middle := addTestComment(t, 1, u.Username, "middle", &top)
+	answer := addTestComment(t, 1, "user2", "answer", &middle)
+	defer deleteCommentByCommentId(answer)
+
+	if _, err := deleteUser(u.Username); err != nil {
+		t.Fatal(err)
+	}
+	var parent *int
+	if err := DB.QueryRow("SELECT parent_comment_id FROM comment WHERE comment_id = ?", answer).Scan(&parent); err != nil || parent != nil {
+		t.Errorf("the answer was not moved to the top: %v, %v", parent, err)
+	}
+}
+
+// Test that a deleted comment stays as a placeholder while replies hang
+// under it, and disappears with its last reply
+func TestCommentThreadPlaceholders(t *testing.T) {
+	if _, err := createNewArticle(article{Title: "Placeholder test", Content: "Placeholder test"}, "user_mj"); err != nil {
+		t.Fatal(err)
+	}
+	defer deleteArticleByTitle("Placeholder test")
+	var articleId int
+	DB.QueryRow("SELECT id FROM articles WHERE title = 'Placeholder test'").Scan(&articleId)
+
+	top := addTestComment(t, articleId, "user2", "top", nil)
+	middle := addTestComment(t, articleId, "user3", "middle", &top)
+	reply := addTestComment(t, articleId, "user2", "reply", &middle)
+	alone := addTestComment(t, articleId, "user3", "alone", nil)
+	for _, id := range []int{top, middle, alone} {
+		if err := softDeleteComment(id, "user_mj"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	thread := func() []commentNode {
+		t.Helper()
+		page, err := getCommentThread(articleId, threadOptions{Order: "time", MaxDepth: defaultThreadDepth, Limit: defaultThreadLimit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return page.Comments
+	}
+
+	nodes := thread()
+	if got := fmt.Sprint(describeThread(nodes)); got != "[[deleted]@0 [deleted]@1 reply@2]" {
+		t.Errorf("got %s", got)
+	}
+	if len(nodes) == 1 && (!nodes[0].Deleted || nodes[0].CommentAuthor != "" || nodes[0].ReplyCount != 1) {
+		t.Errorf("got %+v", nodes[0])
+	}
+
+	// The replies of a placeholder can still be listed
+	if _, err := getCommentThread(articleId, threadOptions{ParentId: &middle, MaxDepth: 1, Limit: 1}); err != nil {
+		t.Errorf("listing the replies of a placeholder: %v", err)
+	}
+
+	if err := softDeleteComment(reply, "user2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := thread(); len(got) != 0 {
+		t.Errorf("got %s", describeThread(got))
+	}
+}
@@ -4,19 +4,25 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
+	"log"
+	"regexp"
 	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
 )
 
 type user struct {
-	Gatorlink string `json:"gatorlink"`
-	GatorPW   string `json:"gatorPW"`
-	Username  string `json:"username"`
-	Password  string `json:"password"`
-	Birthday  string `json:"birthday"`
-	Gender    string `json:"gender"`
+	Gatorlink string  `json:"gatorlink"`
+	Username  string  `json:"username"`
+	Password  string  `json:"password"`
+	Birthday  string  `json:"birthday"`
+	Gender    string  `json:"gender"`
+	Major     *string `json:"major,omitempty"`
+	GradYear  *int    `json:"gradYear,omitempty"`
 }
 
 type mingleUser struct {
@@ -71,7 +77,7 @@ func isUserExist(u string) (bool, error) {
 	//	}
 	//}
 	//return false
-	stmt, err := DB.Prepare("SELECT username, password FROM users WHERE username = ?")
+	stmt, err := DB.Prepare("SELECT username, password FROM users WHERE username = ? AND status = 'active' AND deleted_at IS NULL")
 
 	if err != nil {
 		return false, err
@@ -92,7 +98,10 @@ func isUserExist(u string) (bool, error) {
 	return true, nil
 }
 
-// Check if the username and password combination is valid
+// Check if the username and password combination is valid.
+// A legacy plaintext password is replaced by its hash once it has been
+// verified. Fails with errAccountNotVerified for the right password of an
+// account that is still pending
 func isUserValid(u mingleUser) (bool, error) {
 	//for _, u := range userList {
 	//	if u.Username == username && u.Password == password {
@@ -100,7 +109,7 @@ func isUserValid(u mingleUser) (bool, error) {
 	//	}
 	//}
 	//return false
-	stmt, err := DB.Prepare("SELECT username, password FROM users WHERE username = ? AND password = ?")
+	stmt, err := DB.Prepare("SELECT password, status FROM users WHERE username = ? AND deleted_at IS NULL")
 
 	if err != nil {
 		return false, err
@@ -108,8 +117,8 @@ func isUserValid(u mingleUser) (bool, error) {
 	//fmt.Println(u.Username, u.Password)
 	defer stmt.Close()
 
-	var temp mingleUser
-	sqlErr := stmt.QueryRow(u.Username, u.Password).Scan(&temp.Username, &temp.Password)
+	var stored, status string
+	sqlErr := stmt.QueryRow(u.Username).Scan(&stored, &status)
 
 	if sqlErr != nil {
 		if sqlErr == sql.ErrNoRows {
@@ -118,77 +127,125 @@ func isUserValid(u mingleUser) (bool, error) {
 		}
 		return false, sqlErr
 	}
+
+	match, needsRehash, err := verifyPassword(stored, u.Password)
+	if err != nil || !match {
+		return false, err
+	}
+	if status != "active" {
+		return false, errAccountNotVerified
+	}
+
+	if needsRehash {
+		if err := rehashPassword(u.Username, stored, u.Password); err != nil {
+			// The credentials are still valid, try again on the next login
+			log.Println(err)
+		}
+	}
 	return true, nil
 }
 
-// Register a new user with the given username and password
-// NOTE: For this demo, we
-func registerNewUser(newUser user) (int64, error) {
-	if strings.TrimSpace(newUser.Password) == "" {
-		return 0, errors.New("The password can't be empty")
+// Replace the stored password with a fresh hash, unless it was changed
+// in the meantime
+func rehashPassword(username string, stored string, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
 	}
 
-	flag, err := isGatorIdAvailable(newUser.Gatorlink, newUser.GatorPW)
-	if flag == false && err == nil {
-		return 0, errors.New("The username is not available")
+	stmt, err := DB.Prepare("UPDATE users SET password = ? WHERE username = ? AND password = ?")
+	if err != nil {
+		return err
 	}
+	defer stmt.Close()
 
-	tx, err := DB.Begin()
-	if err != nil {
-		return 0, err
+	_, err = stmt.Exec(hash, username, stored)
+	return err
+}
+
+// Usernames end up in URLs and avatar file names, so keep them simple
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// The reasons a registration is refused, meant to be shown to the user
+var (
+	errInvalidUsername = errors.New("The username must be 1 to 32 letters, digits, '_' or '-'")
+	errUsernameTaken   = errors.New("The username is already taken")
+)
+
+// Register a new user with the given username and password, a gender and
+// an optional birthday. The account stays pending until the code sent to its GatorLink is
+// verified, see startVerification and verifyUser
+func registerNewUser(newUser user) (int64, error) {
+	if !usernamePattern.MatchString(newUser.Username) {
+		return 0, errInvalidUsername
 	}
 
-	stmt, err := tx.Prepare("INSERT INTO users (username, password, gatorID, gender, birthday) VALUES (?, ?, ?, ?, ?)")
+	if strings.TrimSpace(newUser.Password) == "" {
+		return 0, errEmptyPassword
+	}
 
+	gatorId, err := normalizeGatorlink(newUser.Gatorlink)
 	if err != nil {
 		return 0, err
 	}
 
-	defer stmt.Close()
+	// Checked again when the account is activated
+	if inUse, err := isGatorlinkInUse(gatorId); err != nil {
+		return 0, err
+	} else if inUse {
+		return 0, errGatorlinkInUse
+	}
 
-	result, err := stmt.Exec(newUser.Username, newUser.Password, newUser.Gatorlink, newUser.Gender, newUser.Birthday)
+	if !allowedGenders[newUser.Gender] {
+		return 0, errInvalidGender
+	}
+	// The birthday can be given later through the profile
+	var birthday *string
+	if newUser.Birthday != "" {
+		if err := validateBirthday(newUser.Birthday); err != nil {
+			return 0, err
+		}
+		birthday = &newUser.Birthday
+	}
 
+	passwordHash, err := hashPassword(newUser.Password)
 	if err != nil {
-		tx.Commit()
 		return 0, err
 	}
 
-	num, err := result.RowsAffected()
+	tx, err := DB.Begin()
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
 
-	tx.Commit()
-
-	return num, nil
-}
-
-// Check if the supplied username is available
-func isGatorIdAvailable(gatorid string, gatorpw string) (bool, error) {
-	//for _, u := range userList {
-	//	if u.Username == username {
-	//		return false
-	//	}
-	//}
-	//return true
-	stmt, err := DB.Prepare("SELECT password FROM gatorlink WHERE gatorId = ?")
-	if err != nil {
-		return false, err
+	// A username whose verification was abandoned can be registered again
+	if err := purgeExpiredPendingUser(tx, newUser.Username); err != nil {
+		return 0, err
 	}
 
-	defer stmt.Close()
+	// users.gatorId references gatorlink, which no longer stores a password:
+	// owning the address is proven by the verification email
+	if _, err := tx.Exec("INSERT OR IGNORE INTO gatorlink (gatorId, password) VALUES (?, '')", gatorId); err != nil {
+		return 0, err
+	}
 
-	var tempPW string
-	sqlErr := stmt.QueryRow(gatorid).Scan(&tempPW)
+	result, err := tx.Exec("INSERT INTO users (username, password, gatorID, gender, birthday, status) VALUES (?, ?, ?, ?, ?, 'pending')",
+		newUser.Username, passwordHash, gatorId, newUser.Gender, birthday)
 
-	if sqlErr != nil || tempPW != gatorpw {
-		if sqlErr == sql.ErrNoRows {
-			return true, nil
+	if err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+			return 0, errUsernameTaken
 		}
-		return false, sqlErr
+		return 0, err
 	}
 
-	return true, nil
+	num, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return num, tx.Commit()
 }
 
 // Check if the supplied username is available
@@ -211,453 +268,466 @@ func isUsernameAvailable(username string) (bool, error) {
 
 }
 
+// Permanently delete an account with everything it wrote
 func deleteUser(username string) (int64, error) {
 	tx, err := DB.Begin()
-
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
 
-	stmt, err := DB.Prepare("DELETE from users where username = ?")
-
+	num, err := deleteUserTx(tx, username)
 	if err != nil {
 		return 0, err
 	}
+	return num, tx.Commit()
+}
 
-	defer stmt.Close()
+// Delete an account and the rows that reference it, so that foreign keys
+// don't block the deletion
+func deleteUserTx(tx *sql.Tx, username string) (int64, error) {
+	for _, query := range []string{
+		"DELETE FROM sessions WHERE username = ?",
+		"DELETE FROM email_verifications WHERE username = ?",
+		"DELETE FROM password_resets WHERE username = ?",
+		"DELETE FROM reactions WHERE username = ?",
+		"DELETE FROM subscribe WHERE star = ?1 OR follower = ?1",
+		"DELETE FROM images WHERE owner = ?",
+		"DELETE FROM article_revisions WHERE edited_by = ?",
+		"DELETE FROM notifications WHERE recipient = ?1 OR actor = ?1",
+		"DELETE FROM notification_mutes WHERE username = ?",
+		"DELETE FROM blocks WHERE blocker = ?1 OR blocked = ?1",
+		"DELETE FROM messages WHERE conversation_id IN (SELECT conversation_id FROM conversations WHERE user_a = ?1 OR user_b = ?1)",
+		"DELETE FROM conversation_members WHERE conversation_id IN (SELECT conversation_id FROM conversations WHERE user_a = ?1 OR user_b = ?1)",
+		"DELETE FROM conversations WHERE user_a = ?1 OR user_b = ?1",
+		"DELETE FROM interests WHERE username = ?1 OR target = ?1",
+		"DELETE FROM matches WHERE user_a = ?1 OR user_b = ?1",
+		"DELETE FROM discover_preferences WHERE username = ?",
+		"DELETE FROM profile_tags WHERE username = ?",
+		"DELETE FROM profile_photos WHERE username = ?",
+		"DELETE FROM profile_visibility WHERE username = ?",
+	} {
+		if _, err := tx.Exec(query, username); err != nil {
+			return 0, err
+		}
+	}
 
-	result, err := stmt.Exec(username)
+	// The replies of others to the comments of the user move up to the
+	// closest comment left, until none of them answers the user
+	for {
+		result, err := tx.Exec(`UPDATE comment SET parent_comment_id = (SELECT parent.parent_comment_id FROM comment parent WHERE parent.comment_id = comment.parent_comment_id)
+			WHERE comment_user != ?1 AND parent_comment_id IN (SELECT comment_id FROM comment WHERE comment_user = ?1)`, username)
+		if err != nil {
+			return 0, err
+		}
+		moved, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if moved == 0 {
+			break
+		}
+	}
+	for _, query := range []string{
+		"DELETE FROM reactions WHERE target_type = 'comment' AND target_id IN (SELECT comment_id FROM comment WHERE comment_user = ?)",
+		"DELETE FROM notifications WHERE comment_id IN (SELECT comment_id FROM comment WHERE comment_user = ?)",
+		"DELETE FROM comment WHERE comment_user = ?",
+	} {
+		if _, err := tx.Exec(query, username); err != nil {
+			return 0, err
+		}
+	}
 
+	ids, err := queryInts(tx, "SELECT id FROM articles WHERE author = ?", username)
 	if err != nil {
-		tx.Commit()
 		return 0, err
 	}
+	for _, id := range ids {
+		if _, err := deleteArticleTx(tx, id); err != nil {
+			return 0, err
+		}
+	}
 
-	num, err := result.RowsAffected()
+	result, err := tx.Exec("DELETE from users where username = ?", username)
 	if err != nil {
 		return 0, err
 	}
+	return result.RowsAffected()
+}
 
-	tx.Commit()
+// The fields a user may change through PATCH /u/info.
+// A nil field is left unchanged
+type profileUpdate struct {
+	Birthday *string
+	Gender   *string
+	// "" and 0 clear the major and the graduation year
+	Major    *string
+	GradYear *int
+	// "" clears the bio and the pronouns
+	Bio      *string
+	Pronouns *string
+	// Replace the tags, and the gallery with images the user uploaded
+	Tags   *[]string
+	Photos *[]string
+}
 
-	return num, nil
+type passwordChange struct {
+	OldPassword string `json:"old_password" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
 }
 
-//item:
-// -password
-// -birthday
-// -gender
-//func updateUserItem(username string, column string, content string) (int64, error) {
-//	switch column {
-//	case "password":
-//		stmt, err := DB.Prepare("UPDATE users SET password=? WHERE username=?")
-//		if err != nil {
-//			return 0, err
-//		}
-//		res, errStmt := stmt.Exec(content, username)
-//		if errStmt != nil {
-//			return 0, errStmt
-//		}
-//		affect, errRes := res.RowsAffected()
-//		if errRes != nil {
-//			return 0, errRes
-//		}
-//		return affect, nil
-//	case "birthday":
-//		stmt, err := DB.Prepare("UPDATE users SET birthday=? WHERE username=?")
-//		if err != nil {
-//			return 0, err
-//		}
-//		res, errStmt := stmt.Exec(content, username)
-//		if errStmt != nil {
-//			return 0, errStmt
-//		}
-//		affect, errRes := res.RowsAffected()
-//		if errRes != nil {
-//			return 0, errRes
-//		}
-//		return affect, nil
-//	case "gender":
-//		stmt, err := DB.Prepare("UPDATE users SET gender=? WHERE username=?")
-//		if err != nil {
-//			return 0, err
-//		}
-//		res, errStmt := stmt.Exec(content, username)
-//		if errStmt != nil {
-//			return 0, errStmt
-//		}
-//		affect, errRes := res.RowsAffected()
-//		if errRes != nil {
-//			return 0, errRes
-//		}
-//		return affect, nil
-//	default:
-//		return 0, errors.New("invalid parameters")
-//	}
-//}
+// Returned by changeUserPassword when the old password does not match
+var errWrongPassword = errors.New("the old password is incorrect")
 
-//Returned value should be equal to the length of the map
-func updateUserItem(username string, content map[string]string) (int64, error) {
-	var affect int64
-	for k, v := range content {
-		value := "'" + v + "'"
-		tempUsername := "'" + username + "'"
-		update := fmt.Sprintf("UPDATE users SET %s=%s WHERE username=%s", k, value, tempUsername)
-		//fmt.Println("in updateUserItem", update)
-		res, err := DB.Exec(update)
-		if err != nil {
-			return 0, err
-		}
-		eachAffect, errRes := res.RowsAffected()
-		if errRes != nil {
-			return 0, errRes
-		}
-		affect += eachAffect
-	}
-	return affect, nil
-}
+var allowedGenders = map[string]bool{"male": true, "female": true, "unknown": true}
 
-func getUserByUsername(username string) (user, error) {
-	stmt, err := DB.Prepare("SELECT password, gatorId, birthday, gender FROM users WHERE username=?")
+// The reasons a gender or a birthday is refused, as field errors
+var (
+	errInvalidGender   = errors.New("must be one of male, female or unknown")
+	errInvalidBirthday = errors.New("must be a date in the form 2006-01-02")
+	errFutureBirthday  = errors.New("can't be in the future")
+)
+
+// Check that a birthday is a date in the form 2006-01-02 that has passed
+func validateBirthday(birthday string) error {
+	day, err := time.Parse("2006-01-02", birthday)
 	if err != nil {
-		return user{}, err
+		return errInvalidBirthday
 	}
+	if day.After(time.Now()) {
+		return errFutureBirthday
+	}
+	return nil
+}
 
-	defer stmt.Close()
+// The limits of the major and the graduation year of a profile
+const (
+	maxMajorLength = 100
+	minGradYear    = 1950
+	maxGradYear    = 2100
+)
 
-	userResult := user{}
+// Validate a raw PATCH /u/info body against the whitelist of editable fields.
+// The second return value maps every rejected field to the reason
+func parseProfileUpdate(raw map[string]json.RawMessage) (profileUpdate, map[string]string) {
+	var update profileUpdate
+	fieldErrs := make(map[string]string)
+
+	for field, value := range raw {
+		var str string
+		if field == "birthday" || field == "gender" || field == "major" || field == "bio" || field == "pronouns" {
+			if err := json.Unmarshal(value, &str); err != nil {
+				fieldErrs[field] = "must be a string"
+				continue
+			}
+		}
 
-	sqlErr := stmt.QueryRow(username).Scan(&userResult.Password, &userResult.Gatorlink, &userResult.Birthday, &userResult.Gender)
+		switch field {
+		case "birthday":
+			if err := validateBirthday(str); err != nil {
+				fieldErrs[field] = err.Error()
+			} else {
+				update.Birthday = &str
+			}
+		case "gender":
+			if !allowedGenders[str] {
+				fieldErrs[field] = errInvalidGender.Error()
+			} else {
+				update.Gender = &str
+			}
+		case "major":
+			if str = strings.TrimSpace(str); len(str) > maxMajorLength {
+				fieldErrs[field] = fmt.Sprintf("must be at most %d characters", maxMajorLength)
+			} else {
+				update.Major = &str
+			}
+		case "grad_year":
+			var year *int
+			if err := json.Unmarshal(value, &year); err != nil || year != nil && (*year < minGradYear || *year > maxGradYear) {
+				fieldErrs[field] = fmt.Sprintf("must be a year from %d to %d, or null", minGradYear, maxGradYear)
+			} else if year == nil {
+				update.GradYear = new(int)
+			} else {
+				update.GradYear = year
+			}
+		case "bio":
+			if str = strings.TrimSpace(str); len(str) > maxBioLength {
+				fieldErrs[field] = fmt.Sprintf("must be at most %d characters", maxBioLength)
+			} else {
+				update.Bio = &str
+			}
+		case "pronouns":
+			if str = strings.TrimSpace(str); len(str) > maxPronounsLength {
+				fieldErrs[field] = fmt.Sprintf("must be at most %d characters", maxPronounsLength)
+			} else {
+				update.Pronouns = &str
+			}
+		case "tags":
+			tags, reason := parseProfileTags(value)
+			if reason != "" {
+				fieldErrs[field] = reason
+			} else {
+				update.Tags = &tags
+			}
+		case "photos":
+			var photos []string
+			if err := json.Unmarshal(value, &photos); err != nil {
+				fieldErrs[field] = "must be a list of file names"
+			} else if len(photos) > maxPhotos {
+				fieldErrs[field] = fmt.Sprintf("must have at most %d photos", maxPhotos)
+			} else if hasDuplicates(photos) {
+				fieldErrs[field] = "must not list a photo twice"
+			} else {
+				update.Photos = &photos
+			}
+		case "password":
+			fieldErrs[field] = "use PATCH /u/password to change the password"
+		default:
+			fieldErrs[field] = "is not editable"
+		}
+	}
 
-	if sqlErr != nil {
-		return user{}, sqlErr
+	if len(raw) == 0 {
+		fieldErrs["body"] = "no fields to update"
 	}
-	return userResult, nil
+	return update, fieldErrs
 }
 
-//一个用户可能对一篇文章点过赞，点过踩，或者没做过操作
-//第一个返回int 状态 未操作:0；赞过:1；踩过:2，出错:-1
-//第二个返回int 下标 状态为0/-1时，返回-1
-func checkArticleStatus(username string, articleId int) (int, int, error) {
-	stmt, err := DB.Prepare("SELECT like_list, dislike_list FROM users WHERE username=?")
-	if err != nil {
-		return -1, -1, err
+// Parse the tags of a profile, lowercased and without the duplicates.
+// Returns the reason if they are invalid
+func parseProfileTags(value json.RawMessage) ([]string, string) {
+	var raw []string
+	if err := json.Unmarshal(value, &raw); err != nil {
+		return nil, "must be a list of strings"
+	}
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, tag := range raw {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || len(tag) > maxTagLength {
+			return nil, fmt.Sprintf("each tag must have 1 to %d characters", maxTagLength)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
 	}
-	defer stmt.Close()
-
-	var queryLike string
-	var queryDislike string
-	sqlErr := stmt.QueryRow(username).Scan(&queryLike, &queryDislike)
-	if sqlErr != nil {
-		return -1, -1, sqlErr
+	if len(tags) > maxTags {
+		return nil, fmt.Sprintf("must have at most %d tags", maxTags)
 	}
+	return tags, ""
+}
 
-	res := 0
-	index := -1
+// Return whether a value appears more than once in a list
+func hasDuplicates(values []string) bool {
+	seen := map[string]bool{}
+	for _, v := range values {
+		if seen[v] {
+			return true
+		}
+		seen[v] = true
+	}
+	return false
+}
 
-	//如果queryLike/queryDislike为空
-	if queryLike == "" && queryDislike == "" {
-		return 0, -1, nil
+// Apply a validated profile update in a single transaction
+func updateUserProfile(username string, update profileUpdate) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	if queryLike == "" && queryDislike != "" {
-		indexDislike, ifDisliked, err := checkIfStrContainsEle(queryDislike, articleId)
-		if err != nil {
-			return -1, -1, err
+	if update.Birthday != nil {
+		if err := execUserUpdate(tx, "UPDATE users SET birthday = ? WHERE username = ?", *update.Birthday, username); err != nil {
+			return err
 		}
-		if ifDisliked {
-			res = 2
-			index = indexDislike
+	}
+	if update.Gender != nil {
+		if err := execUserUpdate(tx, "UPDATE users SET gender = ? WHERE username = ?", *update.Gender, username); err != nil {
+			return err
 		}
 	}
-
-	if queryLike != "" && queryDislike == "" {
-		indexLike, ifLiked, err := checkIfStrContainsEle(queryLike, articleId)
-		if err != nil {
-			return -1, -1, err
+	if update.Major != nil {
+		if err := execUserUpdate(tx, "UPDATE users SET major = NULLIF(?, '') WHERE username = ?", *update.Major, username); err != nil {
+			return err
 		}
-		if ifLiked {
-			res = 1
-			index = indexLike
+	}
+	if update.GradYear != nil {
+		if err := execUserUpdate(tx, "UPDATE users SET grad_year = NULLIF(?, 0) WHERE username = ?", *update.GradYear, username); err != nil {
+			return err
 		}
 	}
-
-	if queryLike != "" && queryDislike != "" {
-		indexLike, ifLiked, errLike := checkIfStrContainsEle(queryLike, articleId)
-		if errLike != nil {
-			return -1, -1, errLike
+	if update.Bio != nil {
+		if err := execUserUpdate(tx, "UPDATE users SET bio = NULLIF(?, '') WHERE username = ?", *update.Bio, username); err != nil {
+			return err
+		}
+	}
+	if update.Pronouns != nil {
+		if err := execUserUpdate(tx, "UPDATE users SET pronouns = NULLIF(?, '') WHERE username = ?", *update.Pronouns, username); err != nil {
+			return err
 		}
-		indexDislike, ifDisliked, errDislike := checkIfStrContainsEle(queryDislike, articleId)
-		if errDislike != nil {
-			return -1, -1, errDislike
+	}
+	if update.Tags != nil {
+		if err := replaceProfileListTx(tx, "profile_tags", "tag", username, *update.Tags); err != nil {
+			return err
 		}
-		if ifLiked {
-			res = 1
-			index = indexLike
-		} else if ifDisliked {
-			res = 2
-			index = indexDislike
+	}
+	if update.Photos != nil {
+		if err := replaceProfileListTx(tx, "profile_photos", "filename", username, *update.Photos); err != nil {
+			return err
 		}
 	}
 
-	return res, index, nil
+	return tx.Commit()
 }
 
-//三个参数：username, articleId, status
-//status = true  点赞
-//status = false 点踩
-//返回affectUsers, affectArticles, error
-func changeArticleStatus(username string, articleId int, thumbsUp bool) (int64, int64, error) {
-	//先查看之前是否点过赞或踩，一个用户只能对一篇文章赞或踩一次，这个判断由前端做
-	//未操作:0；赞过:1；踩过:2，出错:-1
-	status, index, err := checkArticleStatus(username, articleId)
+// Run an update that must change exactly the row of one user
+func execUserUpdate(tx *sql.Tx, query string, args ...interface{}) error {
+	res, err := tx.Exec(query, args...)
 	if err != nil {
-		return 0, 0, err
+		return err
+	}
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return err
 	}
+	if affect != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
 
-	stmtQuery, errQuery := DB.Prepare("SELECT like_list, dislike_list FROM users WHERE username=?")
-	if errQuery != nil {
-		return 0, 0, errQuery
+// Replace the password of a user after checking the old one
+func changeUserPassword(username string, change passwordChange) error {
+	valid, err := isUserValid(mingleUser{Username: username, Password: change.OldPassword})
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return errWrongPassword
 	}
-	defer stmtQuery.Close()
 
-	var likeStr, dislikeStr string
-	sqlErr := stmtQuery.QueryRow(username).Scan(&likeStr, &dislikeStr)
-	if sqlErr != nil {
-		return 0, 0, sqlErr
+	hash, err := hashPassword(change.NewPassword)
+	if err != nil {
+		return err
 	}
 
-	stmtUpdateUserLike, err := DB.Prepare("UPDATE users SET like_list=? WHERE username=?")
+	tx, err := DB.Begin()
 	if err != nil {
-		return 0, 0, err
+		return err
 	}
+	defer tx.Rollback()
 
-	stmtUpdateUserDislike, err := DB.Prepare("UPDATE users SET dislike_list=? WHERE username=?")
+	if err := execUserUpdate(tx, "UPDATE users SET password = ? WHERE username = ?", hash, username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func getUserByUsername(username string) (user, error) {
+	stmt, err := DB.Prepare("SELECT password, gatorId, birthday, gender, major, grad_year FROM users WHERE username=?")
 	if err != nil {
-		return 0, 0, err
+		return user{}, err
 	}
 
-	stmtUpdate, errUpdate := DB.Prepare("UPDATE users SET like_list=?, dislike_list=? WHERE username=?")
-	if errUpdate != nil {
-		return 0, 0, err
+	defer stmt.Close()
+
+	userResult := user{}
+	// The birthday is optional at registration
+	var birthday sql.NullString
+
+	sqlErr := stmt.QueryRow(username).Scan(&userResult.Password, &userResult.Gatorlink, &birthday, &userResult.Gender, &userResult.Major, &userResult.GradYear)
+
+	if sqlErr != nil {
+		return user{}, sqlErr
 	}
-	defer stmtUpdate.Close()
+	userResult.Birthday = birthday.String
+	return userResult, nil
+}
 
-	if likeStr == "" && dislikeStr == "" {
-		if thumbsUp == true {
-			//点赞
-			res, err := stmtUpdateUserLike.Exec(strconv.Itoa(articleId), username)
-			if err != nil {
-				return 0, 0, err
-			}
-			affectUser, err := res.RowsAffected()
-			if err != nil {
-				return 0, 0, err
-			}
-			affectArticle, err := reactionToAnArticle(articleId, 1, 0)
-			if err != nil {
-				return 0, 0, err
-			}
-			return affectUser, affectArticle, nil
-		} else {
-			//点踩
-			res, err := stmtUpdateUserDislike.Exec(strconv.Itoa(articleId), username)
-			if err != nil {
-				return 0, 0, err
-			}
-			affectUser, err := res.RowsAffected()
-			if err != nil {
-				return 0, 0, err
-			}
-			affectArticle, err := reactionToAnArticle(articleId, 0, 1)
-			if err != nil {
-				return 0, 0, err
-			}
-			return affectUser, affectArticle, nil
-		}
+// Return the role of the user, roleUser for a user that doesn't exist
+func getUserRole(username string) (string, error) {
+	stmt, err := DB.Prepare("SELECT role FROM users WHERE username = ?")
+	if err != nil {
+		return "", err
 	}
+	defer stmt.Close()
 
-	if likeStr != "" && dislikeStr == "" {
-		if thumbsUp == true {
-			//点赞
-			res, err := stmtUpdateUserLike.Exec(strconv.Itoa(articleId), username)
-			if err != nil {
-				return 0, 0, err
-			}
-			affectUser, err := res.RowsAffected()
-			if err != nil {
-				return 0, 0, err
-			}
-			affectArticle, err := reactionToAnArticle(articleId, 1, 0)
-			if err != nil {
-				return 0, 0, err
-			}
-			return affectUser, affectArticle, nil
-		} else {
-			//点踩
-			indexLike, ifLiked, err := checkIfStrContainsEle(likeStr, articleId)
-			if err != nil {
-				return 0, 0, err
-			}
-			if ifLiked {
-				likeList, err := convStrToIntList(likeStr)
-				if err != nil {
-					return 0, 0, err
-				}
-				likeList = append(likeList[:indexLike], likeList[indexLike+1:]...)
-				newLikeStr := convIntListToStr(likeList)
-				res, err := stmtUpdate.Exec(newLikeStr, strconv.Itoa(articleId), username)
-				if err != nil {
-					return 0, 0, err
-				}
-				affectUser, err := res.RowsAffected()
-				if err != nil {
-					return 0, 0, err
-				}
-				affectArticle, err := reactionToAnArticle(articleId, -1, 1)
-				if err != nil {
-					return 0, 0, err
-				}
-				return affectUser, affectArticle, nil
-			} else {
-				res, err := stmtUpdateUserDislike.Exec(strconv.Itoa(articleId), username)
-				if err != nil {
-					return 0, 0, err
-				}
-				affectUser, err := res.RowsAffected()
-				if err != nil {
-					return 0, 0, err
-				}
-				affectArticle, err := reactionToAnArticle(articleId, 0, 1)
-				if err != nil {
-					return 0, 0, err
-				}
-				return affectUser, affectArticle, nil
-			}
-		}
+	var role string
+	sqlErr := stmt.QueryRow(username).Scan(&role)
+	if sqlErr == sql.ErrNoRows {
+		return roleUser, nil
 	}
+	return role, sqlErr
+}
 
-	if likeStr == "" && dislikeStr != "" {
-		if thumbsUp == true {
-			//点赞
-			indexDislike, ifDisliked, err := checkIfStrContainsEle(dislikeStr, articleId)
-			if err != nil {
-				return 0, 0, err
-			}
-			if ifDisliked {
-				dislikeList, err := convStrToIntList(dislikeStr)
-				if err != nil {
-					return 0, 0, err
-				}
-				dislikeList = append(dislikeList[:indexDislike], dislikeList[indexDislike+1:]...)
-				newDislikeStr := convIntListToStr(dislikeList)
-				res, err := stmtUpdate.Exec(strconv.Itoa(articleId), newDislikeStr, username)
-				if err != nil {
-					return 0, 0, err
-				}
-				affectUser, err := res.RowsAffected()
-				if err != nil {
-					return 0, 0, err
-				}
-				affectArticle, err := reactionToAnArticle(articleId, 1, -1)
-				if err != nil {
-					return 0, 0, err
-				}
-				return affectUser, affectArticle, nil
-			} else {
-				res, err := stmtUpdateUserLike.Exec(strconv.Itoa(articleId), username)
-				if err != nil {
-					return 0, 0, err
-				}
-				affectUser, err := res.RowsAffected()
-				if err != nil {
-					return 0, 0, err
-				}
-				affectArticle, err := reactionToAnArticle(articleId, 1, 0)
-				if err != nil {
-					return 0, 0, err
-				}
-				return affectUser, affectArticle, nil
-			}
-		} else {
-			//点踩
-			res, err := stmtUpdateUserDislike.Exec(strconv.Itoa(articleId), username)
-			if err != nil {
-				return 0, 0, err
-			}
-			affectUser, err := res.RowsAffected()
-			if err != nil {
-				return 0, 0, err
-			}
-			affectArticle, err := reactionToAnArticle(articleId, 0, 1)
-			if err != nil {
-				return 0, 0, err
-			}
-			return affectUser, affectArticle, nil
-		}
+var errUnknownRole = errors.New("The role must be user, moderator or admin")
+
+// Change the role of an active user, returning sql.ErrNoRows if there is
+// no such user
+func setUserRole(username string, role string) error {
+	if _, ok := roleRanks[role]; !ok {
+		return errUnknownRole
 	}
 
-	if likeStr != "" && dislikeStr != "" {
-		likeList, err := convStrToIntList(likeStr)
-		if err != nil {
-			return 0, 0, err
-		}
-		dislikeList, err := convStrToIntList(dislikeStr)
-		if err != nil {
-			return 0, 0, err
-		}
+	stmt, err := DB.Prepare("UPDATE users SET role = ? WHERE username = ? AND status = 'active'")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
 
-		likeNum := 0
-		dislikeNum := 0
-		newLikeStr := ""
-		newDislikeStr := ""
-
-		if status == 2 && index != -1 && thumbsUp == true {
-			//之前点过踩，要赞，改变用户表中的两个列表，改变文章表中的两个统计数字
-			//从dislike_list中删除，加到like_list中
-			dislikeList = append(dislikeList[:index], dislikeList[index+1:]...)
-			likeList = append(likeList, articleId)
-			//更新文章表中的统计数字
-			likeNum = 1
-			dislikeNum = -1
-		} else if status == 1 && index != -1 && thumbsUp == false {
-			//之前点过赞，要踩
-			//从like_list中删除，加到dislike_list中
-			likeList = append(likeList[:index], likeList[index+1:]...)
-			dislikeList = append(dislikeList, articleId)
-			//更新文章表中的统计数字
-			likeNum = -1
-			dislikeNum = 1
-		} else if status == 0 && index == -1 {
-			//之前什么操作也没做过，要赞/踩
-			if thumbsUp == true {
-				likeList = append(likeList, articleId)
-				likeNum = 1
-			} else {
-				dislikeList = append(dislikeList, articleId)
-				dislikeNum = 1
-			}
-		}
+	result, err := stmt.Exec(role, username)
+	if err != nil {
+		return err
+	}
+	if affect, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affect == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
 
-		newDislikeStr = convIntListToStr(dislikeList)
-		newLikeStr = convIntListToStr(likeList)
-		res, errStmt := stmtUpdate.Exec(newLikeStr, newDislikeStr, username)
-		if errStmt != nil {
-			return 0, 0, errStmt
-		}
-		affectUsers, errRes := res.RowsAffected()
-		if errRes != nil {
-			return 0, 0, errRes
+//一个用户可能对一篇文章点过赞，点过踩，或者没做过操作
+//返回int 状态 未操作:0；赞过:1；踩过:2，出错:-1
+func checkArticleStatus(username string, articleId int) (int, error) {
+	status, err := getReaction(username, "article", articleId)
+	if err != nil {
+		return -1, err
+	}
+	return status, nil
+}
+
+//status: 未操作(取消):0；赞:1；踩:2
+//返回文章新的likes, dislikes, error
+func changeArticleStatus(username string, articleId int, status int) (int, int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	likes, dislikes, err := setReactionTx(tx, username, "article", articleId, status)
+	if err != nil {
+		return 0, 0, err
+	}
+	// Tell the author about a like
+	if status == reactionLike {
+		var author string
+		if err := tx.QueryRow("SELECT COALESCE(author, '') FROM articles WHERE id = ?", articleId).Scan(&author); err != nil {
+			return 0, 0, err
 		}
-		affectArticles, err := reactionToAnArticle(articleId, likeNum, dislikeNum)
-		if err != nil {
+		if err := notifyTx(tx, notification{Recipient: author, Kind: notifyLike, Actor: username, ArticleId: &articleId}); err != nil {
 			return 0, 0, err
 		}
-
-		return affectUsers, affectArticles, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
 	}
 
-	return 0, 0, errors.New("error in changeArticleStatus")
+	events.publish(event{Type: eventReaction, Data: reactionCountEvent{ArticleId: articleId, Likes: likes, Dislikes: dislikes}})
+	return likes, dislikes, nil
 }
 
 //likes received
@@ -675,19 +745,44 @@ func getLikesReceived(username string) (int, error) {
 	return likesReceived, nil
 }
 
+var (
+	errFollowSelf       = errors.New("You can't follow yourself")
+	errAlreadyFollowing = errors.New("You already follow this user")
+)
+
+// Make follower follow star and notify star. Returns errFollowSelf,
+// errAlreadyFollowing, or errBlocked if either of them blocked the other
 func performSubscribe(star string, follower string) error {
-	query := "insert into subscribe (star, follower) values('" + star + "','" + follower + "');"
-	if _, err := DB.Exec(query); err != nil {
-		fmt.Println("?????????????????????????????")
-		fmt.Println(err)
+	if star == follower {
+		return errFollowSelf
+	}
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	blocked, err := isBlockedTx(tx, star, follower)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return errBlocked
+	}
+	if _, err := tx.Exec("INSERT INTO subscribe (star, follower) VALUES (?, ?)", star, follower); err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+			return errAlreadyFollowing
+		}
+		return err
+	}
+	if err := notifyTx(tx, notification{Recipient: star, Kind: notifyFollow, Actor: follower}); err != nil {
 		return err
-	} else {
-		return nil
 	}
+	return tx.Commit()
 }
 
 func getUserStar(username string) ([]subscribe_user, error) {
-	rows, err := DB.Query("SELECT star FROM subscribe where follower='" + username + "';")
+	rows, err := DB.Query("SELECT star FROM subscribe JOIN users ON users.username = subscribe.star WHERE follower = ? AND users.deleted_at IS NULL", username)
 	if err != nil {
 		return nil, err
 	}
@@ -709,7 +804,7 @@ func getUserStar(username string) ([]subscribe_user, error) {
 }
 
 func getUserFollower(username string) ([]subscribe_user, error) {
-	rows, err := DB.Query("SELECT follower FROM subscribe where star='" + username + "';")
+	rows, err := DB.Query("SELECT follower FROM subscribe JOIN users ON users.username = subscribe.follower WHERE star = ? AND users.deleted_at IS NULL", username)
 	if err != nil {
 		return nil, err
 	}
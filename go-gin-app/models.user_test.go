@@ -3,7 +3,9 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -52,7 +54,7 @@ func TestValidUserRegistration(t *testing.T) {
 	//saveLists()
 
 	//newUser := mingleUser{Username: "newuser", Password: "newpass"}
-	newUser := user{Gatorlink: "user1@ufl.edu", GatorPW: "1111", Username: "TestUser", Password: "TestPass", Gender: "unknown"}
+	newUser := user{Gatorlink: "testuser@ufl.edu", Username: "TestUser", Password: "TestPass", Gender: "unknown"}
 	num, err := registerNewUser(newUser)
 	//fmt.Println(num, err)
 	if err != nil || num == 0 {
@@ -75,7 +77,7 @@ func TestInvalidUserRegistration(t *testing.T) {
 
 	// Try to register a user with a used username
 	//usedUser := user{Username: "user1", Password: "pass1"}
-	usedUser := user{Gatorlink: "user1@ufl.edu", GatorPW: "1111", Username: "user1", Password: "pass1"}
+	usedUser := user{Gatorlink: "testuser@ufl.edu", Username: "user1", Password: "pass1"}
 	num, err := registerNewUser(usedUser)
 	if err == nil || num != 0 {
 		t.Fail()
@@ -86,9 +88,16 @@ func TestInvalidUserRegistration(t *testing.T) {
 	//num, err = registerNewUser(invalidUser)
 
 	// Try to register who is not a gator
-	notGator := user{Gatorlink: "someone@ufl.edu", GatorPW: "somepass", Username: "TestUser", Password: "TestPass"}
+	notGator := user{Gatorlink: "someone@gmail.com", Username: "TestUser", Password: "TestPass"}
 	num, err = registerNewUser(notGator)
-	if err == nil || num != 0 {
+	if err != errInvalidGatorlink || num != 0 {
+		t.Fail()
+	}
+
+	// Try to register with the GatorLink of an active account
+	usedGator := user{Gatorlink: "User1", Username: "TestUser", Password: "TestPass"}
+	num, err = registerNewUser(usedGator)
+	if err != errGatorlinkInUse || num != 0 {
 		t.Fail()
 	}
 
@@ -114,7 +123,7 @@ func TestUsernameAvailability(t *testing.T) {
 	}
 
 	// Register a new user
-	newUser := user{Gatorlink: "user2@ufl.edu", GatorPW: "2222", Username: "newuser", Password: "newpass", Gender: "unknown"}
+	newUser := user{Gatorlink: "newuser@ufl.edu", Username: "newuser", Password: "newpass", Gender: "unknown"}
 	affect, err := registerNewUser(newUser)
 	if affect == 0 || err != nil {
 		fmt.Println("TestUsernameAvailability 120 Failure", affect, err)
@@ -142,6 +151,45 @@ func TestUsernameAvailability(t *testing.T) {
 	//restoreLists()
 }
 
+// Test that a plaintext password from before hashing still works and
+// is replaced by a hash on the first successful login
+func TestLegacyPasswordRehash(t *testing.T) {
+	legacyUser := user{Gatorlink: "legacyuser@ufl.edu", Username: "legacyUser", Password: "legacyPass", Gender: "unknown"}
+	registerActiveUser(t, legacyUser)
+	defer deleteUser(legacyUser.Username)
+
+	// Store the password the way it was stored before hashing
+	if _, err := DB.Exec("UPDATE users SET password=? WHERE username=?", legacyUser.Password, legacyUser.Username); err != nil {
+		t.Fatal(err)
+	}
+
+	// A wrong password neither logs in nor rehashes
+	status, err := isUserValid(mingleUser{Username: legacyUser.Username, Password: "wrongPass"})
+	if status || err != nil {
+		t.Fail()
+	}
+	stored, _ := getUserByUsername(legacyUser.Username)
+	if stored.Password != legacyUser.Password {
+		t.Fail()
+	}
+
+	status, err = isUserValid(mingleUser{Username: legacyUser.Username, Password: legacyUser.Password})
+	if !status || err != nil {
+		t.Fail()
+	}
+
+	stored, _ = getUserByUsername(legacyUser.Username)
+	if !strings.HasPrefix(stored.Password, passwordHashV1) {
+		t.Fail()
+	}
+
+	// The rehashed password keeps working
+	status, err = isUserValid(mingleUser{Username: legacyUser.Username, Password: legacyUser.Password})
+	if !status || err != nil {
+		t.Fail()
+	}
+}
+
 //func TestAFunc(t *testing.T) {
 //	str1 := "gender"
 //	str2 := "female"
@@ -262,7 +310,7 @@ func TestUsernameAvailability(t *testing.T) {
 //	}
 //}
 
-//test getUserByUsername, updateUserItem
+//test getUserByUsername, updateUserProfile
 func TestManipulateUserInfo(t *testing.T) {
 	//user_rl
 	originalUserRl, err := getUserByUsername("user_rl")
@@ -272,15 +320,12 @@ func TestManipulateUserInfo(t *testing.T) {
 		t.Fail()
 	}
 
-	content := make(map[string]string)
-	//password, birthday and gender
-	content["password"] = "userRl"
-	content["birthday"] = "2022-04-19"
-	content["gender"] = "female"
-
-	affect, err := updateUserItem("user_rl", content)
-	if int(affect) != len(content) || err != nil {
-		fmt.Println("TestManipulateUserInfo 283 failure", affect, err)
+	//birthday and gender
+	birthday := "2022-04-19"
+	gender := "female"
+	err = updateUserProfile("user_rl", profileUpdate{Birthday: &birthday, Gender: &gender})
+	if err != nil {
+		fmt.Println("TestManipulateUserInfo 283 failure", err)
 		t.Fail()
 	}
 
@@ -289,19 +334,15 @@ func TestManipulateUserInfo(t *testing.T) {
 		fmt.Println("TestManipulateUserInfo 289 failure")
 		t.Fail()
 	}
-	//fmt.Println("updatedUserRl", updatedUserRl)
-	//fmt.Println("ifEqual", updatedUserRl.Birthday == "2022-04-19T00:00:00Z")
-	if updatedUserRl.Password != content["password"] || updatedUserRl.Birthday != "2022-04-19T00:00:00Z" || updatedUserRl.Gender != content["gender"] {
+	if updatedUserRl.Password != originalUserRl.Password || updatedUserRl.Birthday != "2022-04-19T00:00:00Z" || updatedUserRl.Gender != gender {
 		fmt.Println("TestManipulateUserInfo 295 failure")
 		t.Fail()
 	}
 
-	content["password"] = originalUserRl.Password
-	content["birthday"] = "2020-12-30"
-	content["gender"] = originalUserRl.Gender
-	//fmt.Println("还原content", content)
-	affect, err = updateUserItem("user_rl", content)
-	if int(affect) != len(content) || err != nil {
+	//only the birthday changes when the gender is left out
+	birthday = "2020-12-30"
+	err = updateUserProfile("user_rl", profileUpdate{Birthday: &birthday, Gender: &originalUserRl.Gender})
+	if err != nil {
 		fmt.Println("TestManipulateUserInfo 305 failure")
 		t.Fail()
 	}
@@ -312,4 +353,92 @@ func TestManipulateUserInfo(t *testing.T) {
 		fmt.Println("TestManipulateUserInfo 312")
 		t.Fail()
 	}
+
+	//a user that doesn't exist can't be updated
+	if err := updateUserProfile("nobody", profileUpdate{Gender: &gender}); err == nil {
+		t.Fail()
+	}
+}
+
+// Test the validation of PATCH /u/info bodies
+func TestParseProfileUpdate(t *testing.T) {
+	raw := map[string]json.RawMessage{
+		"birthday": json.RawMessage(`"2000-01-31"`),
+		"gender":   json.RawMessage(`"male"`),
+	}
+	update, fieldErrs := parseProfileUpdate(raw)
+	if len(fieldErrs) != 0 || *update.Birthday != "2000-01-31" || *update.Gender != "male" {
+		t.Fail()
+	}
+
+	raw = map[string]json.RawMessage{
+		"birthday":  json.RawMessage(`"2999-01-01"`),
+		"gender":    json.RawMessage(`"robot"`),
+		"password":  json.RawMessage(`"newpass"`),
+		"like_list": json.RawMessage(`"1,2,3"`),
+		"gatorId":   json.RawMessage(`"x@ufl.edu"`),
+	}
+	_, fieldErrs = parseProfileUpdate(raw)
+	for field := range raw {
+		if _, ok := fieldErrs[field]; !ok {
+			t.Error(field, "should have been rejected")
+		}
+	}
+
+	raw = map[string]json.RawMessage{"birthday": json.RawMessage(`"31/01/2000"`)}
+	if _, fieldErrs = parseProfileUpdate(raw); fieldErrs["birthday"] == "" {
+		t.Fail()
+	}
+
+	raw = map[string]json.RawMessage{"gender": json.RawMessage(`1`)}
+	if _, fieldErrs = parseProfileUpdate(raw); fieldErrs["gender"] == "" {
+		t.Fail()
+	}
+
+	if _, fieldErrs = parseProfileUpdate(map[string]json.RawMessage{}); len(fieldErrs) == 0 {
+		t.Fail()
+	}
+
+	raw = map[string]json.RawMessage{"major": json.RawMessage(`" Computer Science "`), "grad_year": json.RawMessage(`2026`)}
+	if update, fieldErrs = parseProfileUpdate(raw); len(fieldErrs) != 0 || *update.Major != "Computer Science" || *update.GradYear != 2026 {
+		t.Errorf("got %+v, %v", update, fieldErrs)
+	}
+	// null clears the graduation year
+	raw = map[string]json.RawMessage{"grad_year": json.RawMessage(`null`)}
+	if update, fieldErrs = parseProfileUpdate(raw); len(fieldErrs) != 0 || *update.GradYear != 0 {
+		t.Errorf("got %+v, %v", update, fieldErrs)
+	}
+	raw = map[string]json.RawMessage{"grad_year": json.RawMessage(`1900`), "major": json.RawMessage(`2`)}
+	if _, fieldErrs = parseProfileUpdate(raw); fieldErrs["grad_year"] == "" || fieldErrs["major"] == "" {
+		t.Errorf("got %v", fieldErrs)
+	}
+}
+
+// Test that the password can only be changed with the old password
+func TestChangeUserPassword(t *testing.T) {
+	testUser := user{Gatorlink: "pwuser@ufl.edu", Username: "pwUser", Password: "oldPass", Gender: "unknown"}
+	registerActiveUser(t, testUser)
+	defer deleteUser(testUser.Username)
+
+	err := changeUserPassword(testUser.Username, passwordChange{OldPassword: "wrongPass", NewPassword: "newPass"})
+	if err != errWrongPassword {
+		t.Fail()
+	}
+
+	err = changeUserPassword(testUser.Username, passwordChange{OldPassword: "oldPass", NewPassword: " "})
+	if err != errEmptyPassword {
+		t.Fail()
+	}
+
+	err = changeUserPassword(testUser.Username, passwordChange{OldPassword: "oldPass", NewPassword: "newPass"})
+	if err != nil {
+		t.Fail()
+	}
+
+	if valid, _ := isUserValid(mingleUser{Username: testUser.Username, Password: "oldPass"}); valid {
+		t.Fail()
+	}
+	if valid, _ := isUserValid(mingleUser{Username: testUser.Username, Password: "newPass"}); !valid {
+		t.Fail()
+	}
 }
@@ -0,0 +1,218 @@
+// models.verification.go
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// How long a verification code can be used
+	verificationLifetime = 30 * time.Minute
+	// Wrong codes accepted before a new code must be requested
+	verificationMaxAttempts = 5
+	// How often a new code can be requested
+	verificationResendInterval = time.Minute
+	// Every GatorLink address ends with this domain
+	gatorlinkDomain = "@ufl.edu"
+)
+
+var (
+	errInvalidGatorlink   = errors.New("The GatorLink must be a UF username or a @ufl.edu address")
+	errGatorlinkInUse     = errors.New("The GatorLink already belongs to an active account")
+	errInvalidCode        = errors.New("The verification code is wrong or has expired")
+	errTooManyAttempts    = errors.New("Too many wrong codes, request a new one")
+	errResendTooSoon      = errors.New("Wait a minute before requesting a new code")
+	errNothingToVerify    = errors.New("There is no account waiting for verification with this username")
+	errAccountNotVerified = errors.New("The account is not verified yet, enter the code sent to your GatorLink")
+)
+
+// The part of a GatorLink address before @ufl.edu
+var gatorlinkPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// Turn "Albert.Gator" or "albert.gator@ufl.edu" into "albert.gator@ufl.edu"
+func normalizeGatorlink(gatorlink string) (string, error) {
+	name := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(gatorlink)), gatorlinkDomain)
+	if !gatorlinkPattern.MatchString(name) {
+		return "", errInvalidGatorlink
+	}
+	return name + gatorlinkDomain, nil
+}
+
+// Check if an active account already uses the GatorLink
+func isGatorlinkInUse(gatorId string) (bool, error) {
+	stmt, err := DB.Prepare("SELECT COUNT(*) FROM users WHERE gatorId = ? AND status = 'active'")
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	var count int
+	if err := stmt.QueryRow(gatorId).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Generate a 6 digit code from crypto/rand
+func generateVerificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// Only a hash of the code is stored. The username is mixed in so that the
+// same code gives different hashes for different users
+func hashVerificationCode(username string, code string) string {
+	sum := sha256.Sum256([]byte(username + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create a new code for a pending user, replacing any previous one.
+// Returns the code and the GatorLink address to send it to
+func startVerification(username string) (string, string, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback()
+
+	var gatorId string
+	var lastSent sql.NullTime
+	sqlErr := tx.QueryRow(`SELECT users.gatorId, email_verifications.created_at FROM users
+		LEFT JOIN email_verifications ON email_verifications.username = users.username
+		WHERE users.username = ? AND users.status = 'pending'`, username).Scan(&gatorId, &lastSent)
+	if sqlErr == sql.ErrNoRows {
+		return "", "", errNothingToVerify
+	}
+	if sqlErr != nil {
+		return "", "", sqlErr
+	}
+
+	now := time.Now().UTC()
+	if lastSent.Valid && now.Sub(lastSent.Time) < verificationResendInterval {
+		return "", "", errResendTooSoon
+	}
+
+	code, err := generateVerificationCode()
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = tx.Exec(`INSERT INTO email_verifications (username, code_hash, attempts, created_at, expires_at) VALUES (?, ?, 0, ?, ?)
+		ON CONFLICT (username) DO UPDATE SET code_hash = excluded.code_hash, attempts = 0, created_at = excluded.created_at, expires_at = excluded.expires_at`,
+		username, hashVerificationCode(username, code), now, now.Add(verificationLifetime))
+	if err != nil {
+		return "", "", err
+	}
+
+	return code, gatorId, tx.Commit()
+}
+
+// Email the code, and a link that enters it, to the GatorLink address
+func sendVerificationEmail(username string, gatorId string, code string) error {
+	link := appConfig.PublicBaseURL + "/u/verify?" + url.Values{"username": {username}, "code": {code}}.Encode()
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"Your UFMingle verification code is %s. It expires in %d minutes.\n\n"+
+		"You can also open this link to verify your account:\n%s\n\n"+
+		"If you did not create an account, you can ignore this email.\n",
+		username, code, int(verificationLifetime.Minutes()), link)
+	return appMailer.Send(gatorId, "Verify your UFMingle account", body)
+}
+
+// Check the code of a pending user and activate the account.
+// Fails with errGatorlinkInUse if another account with the same GatorLink
+// was activated in the meantime
+func verifyUser(username string, code string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var codeHash, gatorId string
+	var attempts int
+	var expiresAt time.Time
+	sqlErr := tx.QueryRow(`SELECT email_verifications.code_hash, email_verifications.attempts, email_verifications.expires_at, users.gatorId
+		FROM email_verifications JOIN users ON users.username = email_verifications.username
+		WHERE users.username = ? AND users.status = 'pending'`, username).Scan(&codeHash, &attempts, &expiresAt, &gatorId)
+	if sqlErr == sql.ErrNoRows {
+		return errNothingToVerify
+	}
+	if sqlErr != nil {
+		return sqlErr
+	}
+
+	if attempts >= verificationMaxAttempts {
+		return errTooManyAttempts
+	}
+	if !time.Now().UTC().Before(expiresAt) {
+		return errInvalidCode
+	}
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(hashVerificationCode(username, code))) != 1 {
+		if _, err := tx.Exec("UPDATE email_verifications SET attempts = attempts + 1 WHERE username = ?", username); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		return errInvalidCode
+	}
+
+	// Activate only if no other account with the GatorLink is active, in
+	// one statement so that two verifications can't both succeed
+	res, err := tx.Exec(`UPDATE users SET status = 'active'
+		WHERE username = ? AND status = 'pending'
+		AND NOT EXISTS (SELECT 1 FROM users WHERE gatorId = ? AND status = 'active')`, username, gatorId)
+	if err != nil {
+		return err
+	}
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affect != 1 {
+		return errGatorlinkInUse
+	}
+
+	if _, err := tx.Exec("DELETE FROM email_verifications WHERE username = ?", username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Remove a pending user whose code has expired, so that the username can
+// be registered again
+func purgeExpiredPendingUser(tx *sql.Tx, username string) error {
+	var expired int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM users LEFT JOIN email_verifications ON email_verifications.username = users.username
+		WHERE users.username = ? AND users.status = 'pending'
+		AND (email_verifications.expires_at IS NULL OR email_verifications.expires_at <= ?)`, username, time.Now().UTC()).Scan(&expired)
+	if err != nil || expired == 0 {
+		return err
+	}
+
+	for _, query := range []string{
+		"DELETE FROM email_verifications WHERE username = ?",
+		"DELETE FROM sessions WHERE username = ?",
+		"DELETE FROM users WHERE username = ? AND status = 'pending'",
+	} {
+		if _, err := tx.Exec(query, username); err != nil {
+			return err
+		}
+	}
+	return nil
+}
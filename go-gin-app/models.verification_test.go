@@ -0,0 +1,118 @@
+// models.verification_test.go
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that GatorLinks are reduced to one form and other addresses refused
+func TestNormalizeGatorlink(t *testing.T) {
+	for input, want := range map[string]string{
+		"albert":                 "albert@ufl.edu",
+		" Albert.Gator@UFL.edu ": "albert.gator@ufl.edu",
+		"a_b-c@ufl.edu":          "a_b-c@ufl.edu",
+	} {
+		if got, err := normalizeGatorlink(input); got != want || err != nil {
+			t.Errorf("normalizeGatorlink(%q) = %q, %v", input, got, err)
+		}
+	}
+
+	for _, input := range []string{"", "@ufl.edu", "someone@gmail.com", "a@b@ufl.edu", "-x@ufl.edu", "x y"} {
+		if _, err := normalizeGatorlink(input); err != errInvalidGatorlink {
+			t.Errorf("normalizeGatorlink(%q) was accepted", input)
+		}
+	}
+}
+
+// Test that only one of two pending accounts of a GatorLink can be activated
+func TestVerifyOneActiveAccountPerGatorlink(t *testing.T) {
+	first := user{Gatorlink: "twice@ufl.edu", Username: "twiceA", Password: "p", Gender: "unknown"}
+	second := user{Gatorlink: "Twice", Username: "twiceB", Password: "p", Gender: "unknown"}
+	for _, u := range []user{first, second} {
+		if _, err := registerNewUser(u); err != nil {
+			t.Fatal(err)
+		}
+		defer deleteUser(u.Username)
+	}
+
+	firstCode, gatorId, err := startVerification(first.Username)
+	if err != nil || gatorId != "twice@ufl.edu" {
+		t.Fatal(gatorId, err)
+	}
+	secondCode, _, err := startVerification(second.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifyUser(second.Username, secondCode); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyUser(first.Username, firstCode); err != errGatorlinkInUse {
+		t.Errorf("the second account was activated: %v", err)
+	}
+	if valid, err := isUserValid(mingleUser{Username: first.Username, Password: "p"}); valid || err != errAccountNotVerified {
+		t.Fail()
+	}
+
+	// No new account can be registered with the GatorLink now
+	if _, err := registerNewUser(user{Gatorlink: "twice", Username: "twiceC", Password: "p", Gender: "unknown"}); err != errGatorlinkInUse {
+		t.Fail()
+	}
+}
+
+// Test that wrong codes are counted and expired codes refused
+func TestVerifyWrongAndExpiredCodes(t *testing.T) {
+	u := user{Gatorlink: "codes@ufl.edu", Username: "codesUser", Password: "p", Gender: "unknown"}
+	if _, err := registerNewUser(u); err != nil {
+		t.Fatal(err)
+	}
+	defer deleteUser(u.Username)
+
+	if err := verifyUser(u.Username, "000000"); err != errNothingToVerify {
+		t.Errorf("verified without a code: %v", err)
+	}
+
+	code, _, err := startVerification(u.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := startVerification(u.Username); err != errResendTooSoon {
+		t.Errorf("a new code was sent right away: %v", err)
+	}
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < verificationMaxAttempts; i++ {
+		if err := verifyUser(u.Username, wrong); err != errInvalidCode {
+			t.Fatal(err)
+		}
+	}
+	// The right code is refused once there were too many wrong ones
+	if err := verifyUser(u.Username, code); err != errTooManyAttempts {
+		t.Errorf("verified after too many attempts: %v", err)
+	}
+
+	// Pretend the last code was sent long ago, then expire the new one
+	if _, err := DB.Exec("UPDATE email_verifications SET created_at = ? WHERE username = ?", time.Now().UTC().Add(-time.Hour), u.Username); err != nil {
+		t.Fatal(err)
+	}
+	code, _, err = startVerification(u.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB.Exec("UPDATE email_verifications SET expires_at = ? WHERE username = ?", time.Now().UTC().Add(-time.Minute), u.Username); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyUser(u.Username, code); err != errInvalidCode {
+		t.Errorf("verified with an expired code: %v", err)
+	}
+
+	// The username of an abandoned registration can be taken again
+	if _, err := registerNewUser(user{Gatorlink: "codes2", Username: u.Username, Password: "p2", Gender: "unknown"}); err != nil {
+		t.Errorf("the expired pending user was kept: %v", err)
+	}
+}
@@ -7,20 +7,23 @@ import (
 	"time"
 
 	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/swaggo/gin-swagger/swaggerFiles"
 )
 
 func initializeRoutes() {
 
+	// Give every request an ID and turn panics and aborted requests into
+	// JSON error bodies
+	router.Use(handleErrors())
+	router.Use(requestLogger())
+
 	// Use the setUserStatus middleware for every route to set a flag
 	// indicating whether the request was from an authenticated user or not
 	router.Use(setUserStatus())
-	router.Use(gin.Logger())
 	//router.Use(cors.Default())
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},
+		AllowOrigins:     appConfig.CORSOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"},
 		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Accept"},
 		AllowCredentials: true,
@@ -55,19 +58,68 @@ func initializeRoutes() {
 		// Ensure that the user is not logged in by using the middleware
 		userRoutes.POST("/register", ensureNotLoggedIn(), register)
 
+		// Activate a registered account with the code sent to its GatorLink,
+		// from the form (POST) or the link in the email (GET)
+		userRoutes.POST("/verify", ensureNotLoggedIn(), verifyAccount)
+		userRoutes.GET("/verify", ensureNotLoggedIn(), verifyAccount)
+		userRoutes.POST("/verify/resend", ensureNotLoggedIn(), resendVerification)
+
 		userRoutes.GET("/info", ensureLoggedIn(), getUserInfo)
 
+		userRoutes.DELETE("/account", ensureLoggedIn(), deleteOwnAccount)
+
 		userRoutes.PATCH("/info", ensureLoggedIn(), updateUserInfo)
+		// Who may see each field of the public profile
+		userRoutes.GET("/info/visibility", ensureLoggedIn(), getProfileVisibilitySettings)
+		userRoutes.PATCH("/info/visibility", ensureLoggedIn(), updateProfileVisibilitySettings)
+		userRoutes.GET("/profile/:username", ensureLoggedIn(), getProfile)
+
+		userRoutes.PATCH("/password", ensureLoggedIn(), updatePassword)
+
+		// Recover an account with a token emailed to its GatorLink
+		userRoutes.POST("/password/forgot", forgotPassword)
+		userRoutes.POST("/password/reset", resetPassword)
 
 		userRoutes.GET("/article/:articleId", ensureLoggedIn(), checkReaction)
 
 		userRoutes.PATCH("/article/:articleId", ensureLoggedIn(), changeReaction)
 
+		userRoutes.DELETE("/article/:articleId", ensureLoggedIn(), clearReaction)
+
+		// The same reactions on comments
+		userRoutes.GET("/comment/:commentId", ensureLoggedIn(), checkCommentReaction)
+		userRoutes.PATCH("/comment/:commentId", ensureLoggedIn(), changeCommentReaction)
+		userRoutes.DELETE("/comment/:commentId", ensureLoggedIn(), clearCommentReaction)
+
 		userRoutes.GET("/likes", ensureLoggedIn(), likesReceivedByUser)
 		userRoutes.POST("/subscribe/:username", ensureLoggedIn(), subscribeSomeone)
 		userRoutes.GET("/getmystars", ensureLoggedIn(), getMyStars)
 		userRoutes.GET("/getmyfollowers", ensureLoggedIn(), getMyFollowers)
 
+		// Mutual interest makes a match, one-sided interest stays private
+		userRoutes.POST("/interest/:username", ensureLoggedIn(), showInterest)
+		userRoutes.POST("/pass/:username", ensureLoggedIn(), passOnSomeone)
+		userRoutes.GET("/matches", ensureLoggedIn(), getMyMatches)
+		userRoutes.DELETE("/matches/:username", ensureLoggedIn(), deleteMatch)
+
+		// Profiles to rate, filtered by the preferences of the user
+		userRoutes.GET("/discover", ensureLoggedIn(), discoverProfiles)
+		userRoutes.GET("/discover/preferences", ensureLoggedIn(), getDiscoverSettings)
+		userRoutes.PUT("/discover/preferences", ensureLoggedIn(), updateDiscoverSettings)
+
+		// Blocked users can't message each other
+		userRoutes.POST("/block/:username", ensureLoggedIn(), blockSomeone)
+		userRoutes.DELETE("/block/:username", ensureLoggedIn(), unblockSomeone)
+		userRoutes.GET("/blocks", ensureLoggedIn(), getMyBlocks)
+
+		// Comments, replies, likes and new followers of the user
+		userRoutes.GET("/notifications", ensureLoggedIn(), listNotifications)
+		userRoutes.GET("/notifications/unread_count", ensureLoggedIn(), getUnreadNotificationCount)
+		userRoutes.POST("/notifications/read", ensureLoggedIn(), readNotifications)
+		userRoutes.POST("/notifications/read_all", ensureLoggedIn(), readAllNotifications)
+		userRoutes.GET("/notifications/preferences", ensureLoggedIn(), getNotificationSettings)
+		userRoutes.PATCH("/notifications/preferences", ensureLoggedIn(), updateNotificationSettings)
+
 	}
 
 	// Group article related routes together
@@ -77,6 +129,9 @@ func initializeRoutes() {
 		//articleRoutes.GET("/view/:article_id", getArticle)
 		articleRoutes.GET("/view/:article_id", ensureLoggedIn(), getArticle)
 
+		// One page of the feed, sorted by time, likes, comments or both
+		articleRoutes.GET("/list", ensureLoggedIn(), listArticles)
+
 		// Handle the GET requests at /article/create
 		// Show the article creation page
 		// Ensure that the user is logged in by using the middleware
@@ -93,8 +148,37 @@ func initializeRoutes() {
 
 		articleRoutes.GET("/pastposts/:username", ensureLoggedIn(), getArticleByUsername)
 		articleRoutes.GET("/personol_comment/:username", ensureLoggedIn(), getCommentByUsername)
+
+		// Edit and delete an article, and see its previous versions
+		articleRoutes.PATCH("/:article_id", ensureLoggedIn(), editArticle)
+		articleRoutes.DELETE("/:article_id", ensureLoggedIn(), deleteArticle)
+		articleRoutes.GET("/:article_id/history", ensureLoggedIn(), getArticleHistory)
+	}
+
+	// Edit and delete a comment
+	commentRoutes := router.Group("/comment")
+	{
+		commentRoutes.PATCH("/:comment_id", ensureLoggedIn(), editComment)
+		commentRoutes.DELETE("/:comment_id", ensureLoggedIn(), deleteComment)
+	}
+
+	// Private messages between two users
+	conversationRoutes := router.Group("/conversations", ensureLoggedIn())
+	{
+		conversationRoutes.GET("", listConversations)
+		conversationRoutes.POST("", createConversation)
+		conversationRoutes.GET("/:conversation_id/messages", listMessages)
+		conversationRoutes.POST("/:conversation_id/messages", postMessage)
+		conversationRoutes.POST("/:conversation_id/read", readConversation)
 	}
 
+	// Push new articles, comments, reactions and messages to the logged-in
+	// users
+	router.GET("/events", ensureLoggedIn(), streamEvents)
+
+	// Full-text search over the articles and comments
+	router.GET("/search", ensureLoggedIn(), search)
+
 	imageRoutes := router.Group("/image")
 	{
 		imageRoutes.GET("/avatar/:username", ensureLoggedIn(), getAvatar)
@@ -104,4 +188,16 @@ func initializeRoutes() {
 		imageRoutes.DELETE("/delete/:filename", ensureLoggedIn(), deleteImage)
 	}
 
+	// Moderation of the accounts, every route checks the role of the user
+	adminRoutes := router.Group("/admin", ensureLoggedIn())
+	{
+		adminRoutes.PATCH("/users/:username/role", ensureRole(roleAdmin), changeUserRole)
+		adminRoutes.DELETE("/users/:username", ensureRole(roleModerator), deleteUserAccount)
+
+		// Bring back what was deleted, until the purge removes it for good
+		adminRoutes.POST("/articles/:article_id/restore", ensureRole(roleModerator), restoreDeletedArticle)
+		adminRoutes.POST("/comments/:comment_id/restore", ensureRole(roleModerator), restoreDeletedComment)
+		adminRoutes.POST("/users/:username/restore", ensureRole(roleModerator), restoreDeletedUser)
+	}
+
 }
@@ -0,0 +1,168 @@
+// routes_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Usernames and IDs that try to break out of a SQL string or number
+var hostileInputs = []string{
+	"' OR '1'='1",
+	"1; DROP TABLE users; --",
+	"1 UNION SELECT username, password FROM users",
+	"user1'--",
+	`"; DELETE FROM subscribe; --`,
+	"user_rl', 'user1'); DELETE FROM subscribe; --",
+	"0 OR 1=1",
+	"../UFMingle.db",
+}
+
+type hostileRequest struct {
+	method string
+	path   string
+	body   string
+	// Send the request with the session cookie of user1
+	loggedIn bool
+}
+
+// Helper function to create the router with every route from routes.go
+func getAppRouter() *gin.Engine {
+	router, _ = newEngine()
+	router.LoadHTMLGlob("templates/*")
+	initializeRoutes()
+	return router
+}
+
+// Helper function to dump the content of every table, so that two dumps
+// can be compared to see if the database has changed
+func snapshotDB(t *testing.T) string {
+	var b strings.Builder
+	for _, table := range []string{"users", "gatorlink", "articles", "comment", "subscribe"} {
+		rows, err := DB.Query("SELECT * FROM " + table)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cols, _ := rows.Columns()
+		values := make([]interface{}, len(cols))
+		pointers := make([]interface{}, len(cols))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		for rows.Next() {
+			if err := rows.Scan(pointers...); err != nil {
+				rows.Close()
+				t.Fatal(err)
+			}
+			fmt.Fprintln(&b, table, values)
+		}
+		rows.Close()
+	}
+	return b.String()
+}
+
+// Build one request per route of routes.go that takes a username or an ID
+func getHostileRequests(input string) []hostileRequest {
+	param := url.PathEscape(input)
+	quoted := strconv.Quote(input)
+
+	return []hostileRequest{
+		{"POST", "/u/login", `{"username": ` + quoted + `, "password": ` + quoted + `}`, false},
+		{"POST", "/u/register", `{"username": ` + quoted + `, "password": "p1", "gender": "unknown", "gatorlink": "user1@ufl.edu"}`, false},
+		{"POST", "/u/register", `{"username": "hostile", "password": "p1", "gender": "unknown", "gatorlink": ` + quoted + `}`, false},
+		{"POST", "/u/verify", `{"username": ` + quoted + `, "code": ` + quoted + `}`, false},
+		{"GET", "/u/verify?" + url.Values{"username": {input}, "code": {input}}.Encode(), "", false},
+		{"POST", "/u/verify/resend", `{"username": ` + quoted + `}`, false},
+		{"PATCH", "/u/info", `{"gender": ` + quoted + `}`, true},
+		{"PATCH", "/u/info", `{` + quoted + `: "female"}`, true},
+		{"PATCH", "/u/info", `{"photos": [` + quoted + `]}`, true},
+		{"PATCH", "/u/info/visibility", `{` + quoted + `: "public"}`, true},
+		{"PATCH", "/u/info/visibility", `{"bio": ` + quoted + `}`, true},
+		{"GET", "/u/profile/" + param, "", true},
+		{"PATCH", "/u/password", `{"old_password": ` + quoted + `, "new_password": "newpass"}`, true},
+		{"POST", "/u/password/reset", `{"token": ` + quoted + `, "new_password": "newpass"}`, false},
+		{"GET", "/u/article/" + param, "", true},
+		{"PATCH", "/u/article/" + param, `{"thumbsup": 1}`, true},
+		{"DELETE", "/u/article/" + param, "", true},
+		{"GET", "/u/comment/" + param, "", true},
+		{"PATCH", "/u/comment/" + param, `{"thumbsup": 1}`, true},
+		{"DELETE", "/u/comment/" + param, "", true},
+		{"POST", "/u/subscribe/" + param, "", true},
+		{"PATCH", "/u/notifications/preferences", `{` + quoted + `: false}`, true},
+		{"POST", "/u/interest/" + param, "", true},
+		{"POST", "/u/pass/" + param, "", true},
+		{"DELETE", "/u/matches/" + param, "", true},
+		{"POST", "/u/block/" + param, "", true},
+		{"DELETE", "/u/block/" + param, "", true},
+		{"POST", "/conversations", `{"username": ` + quoted + `}`, true},
+		{"GET", "/conversations/" + param + "/messages", "", true},
+		{"POST", "/conversations/" + param + "/messages", `{"content": ` + quoted + `, "image": ` + quoted + `}`, true},
+		{"POST", "/conversations/" + param + "/read", "", true},
+		{"GET", "/article/view/" + param, "", true},
+		{"PATCH", "/article/" + param, `{"title": ` + quoted + `}`, true},
+		{"DELETE", "/article/" + param, "", true},
+		{"GET", "/article/" + param + "/history", "", true},
+		{"GET", "/article/comment_view/" + param, "", true},
+		{"PATCH", "/comment/" + param, `{"content": ` + quoted + `}`, true},
+		{"DELETE", "/comment/" + param, "", true},
+		{"POST", "/article/comment/" + param, `{"content": "Test Comment Content"}`, true},
+		{"GET", "/article/pastposts/" + param, "", true},
+		{"GET", "/article/personol_comment/" + param, "", true},
+		{"GET", "/image/avatar/" + param, "", true},
+		{"POST", "/image/avatar/" + param, "", true},
+		{"GET", "/image/download/" + param, "", true},
+		{"DELETE", "/image/delete/" + param, "", true},
+		{"DELETE", "/u/account", `{"password": ` + quoted + `}`, true},
+		{"PATCH", "/admin/users/" + param + "/role", `{"role": ` + quoted + `}`, true},
+		{"DELETE", "/admin/users/" + param, "", true},
+		{"POST", "/admin/articles/" + param + "/restore", "", true},
+		{"POST", "/admin/comments/" + param + "/restore", "", true},
+		{"POST", "/admin/users/" + param + "/restore", "", true},
+	}
+}
+
+// Test that hostile usernames and IDs sent to any route are answered with
+// a client error and never change the database
+func TestHostileInputsThroughEveryRoute(t *testing.T) {
+	r := getAppRouter()
+	cookie := getSessionCookie(t, "user1")
+	before := snapshotDB(t)
+
+	for _, input := range hostileInputs {
+		for _, hr := range getHostileRequests(input) {
+			req, _ := http.NewRequest(hr.method, hr.path, strings.NewReader(hr.body))
+			req.Header.Add("Content-Type", "application/json")
+			if hr.loggedIn {
+				req.AddCookie(cookie)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code < 400 || w.Code >= 500 {
+				t.Errorf("%s %s with %q: got status %d, want 4xx", hr.method, hr.path, input, w.Code)
+			}
+
+			// Every error follows the apiError contract
+			var body apiError
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code == "" || body.Message == "" || body.RequestID != w.Header().Get(requestIDHeader) {
+				t.Errorf("%s %s with %q: got body %s, want an apiError", hr.method, hr.path, input, w.Body)
+			}
+		}
+	}
+
+	if after := snapshotDB(t); after != before {
+		t.Error("the database was changed by hostile requests")
+	}
+}